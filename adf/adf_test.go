@@ -0,0 +1,103 @@
+package adf
+
+import (
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"bytes"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// file builds an ArtWorx file around body with a palette whose entry i is
+// the gray level i.
+func file(body []byte) []byte {
+	data := []byte{1}
+	for i := 0; i < 64; i++ {
+		data = append(data, byte(i), byte(i), byte(i))
+	}
+	data = append(data, make([]byte, fontSize)...)
+	return append(data, body...)
+}
+
+func TestDetect(t *testing.T) {
+	bright := file(nil)
+	bright[10] = 0x40
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{"artworx", file(nil), true},
+		{"artworx with art", file([]byte{'a', 0x07}), true},
+		{"other version", append([]byte{2}, file(nil)[1:]...), false},
+		{"palette out of range", bright, false},
+		{"short", file(nil)[:100], false},
+		{"text", bytes.Repeat([]byte("hello "), 100), false},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.head) > 0; got != tt.want {
+			t.Errorf("%s: Detect = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	body := bytes.Repeat([]byte{'a', 0x1F}, Width)
+	body = append(body, 'b', 0x8E, 'c')
+	c, err := NewParser(bytes.NewReader(file(body))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width() != Width || len(c.Grid) != 2 {
+		t.Fatalf("size = %dx%d, want %dx2", c.Width(), len(c.Grid), Width)
+	}
+
+	// The attribute colors come from the EGA palette registers.
+	gray := func(i int) color.RGBA { return xbin.DecodePalette([]byte{byte(i), byte(i), byte(i)})[0] }
+	if c.Palette[6] != gray(20) || c.Palette[8] != gray(56) || c.Palette[15] != gray(63) {
+		t.Errorf("palette = %v, want the EGA register colors", c.Palette)
+	}
+	attrs := xbin.Attributes{Palette: c.Palette, ICE: true}
+	if got, want := c.Grid[0][Width-1], attrs.Cell('a', 0x1F); got != want {
+		t.Errorf("cell 0,%d = %+v, want %+v", Width-1, got, want)
+	}
+	if got, want := c.Grid[1][0], attrs.Cell('b', 0x8E); got != want {
+		t.Errorf("cell 1,0 = %+v, want %+v", got, want)
+	}
+	if c.Grid[1][1].Char == 'c' {
+		t.Error("odd trailing byte was drawn")
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	if _, err := NewParser(bytes.NewReader(file(nil)[:headerSize-1])).Parse(); err == nil {
+		t.Error("no error for a truncated header")
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want []string
+	}{
+		{"clean", []byte{'a', 0x07, 'b', 0x1f}, nil},
+		{"odd byte", []byte{'a', 0x07, 'b'}, []string{fmt.Sprintf("1:2 (byte %d): error: odd byte at end of data", headerSize+2)}},
+	}
+	for _, tt := range tests {
+		p := NewParser(bytes.NewReader(file(tt.body)))
+		p.Diagnostics = &diag.Collector{}
+		if _, err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
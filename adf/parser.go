@@ -0,0 +1,90 @@
+// Package adf reads ArtWorx (.adf) files: a version byte, a 64-color EGA
+// palette, a font and 80-column binary text.
+package adf
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"errors"
+	"image/color"
+	"io"
+)
+
+// Width is the fixed width of ArtWorx art.
+const Width = 80
+
+const (
+	paletteSize = 64 * 3
+	fontSize    = 256 * 16
+	headerSize  = 1 + paletteSize + fontSize
+)
+
+// egaIndex maps the 16 attribute colors to their entries in the 64-color
+// palette, as the EGA's default palette registers do.
+var egaIndex = [16]int{0, 1, 2, 3, 4, 5, 20, 7, 56, 57, 58, 59, 60, 61, 62, 63}
+
+// Detect recognizes the ArtWorx header: version 1 followed by a palette of
+// 6-bit DAC values. ArtWorx has no signature and no SAUCE file type, so this
+// scores below the formats with a magic number.
+func Detect(head []byte) int {
+	if len(head) < 1+paletteSize || head[0] != 1 {
+		return 0
+	}
+	for _, b := range head[1 : 1+paletteSize] {
+		if b > 0x3F {
+			return 0
+		}
+	}
+	return 60
+}
+
+// Parser reads an ArtWorx stream.
+type Parser struct {
+	reader io.Reader
+
+	// Diagnostics, if not nil, collects the problems found in the data.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new ArtWorx parser.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{reader: r}
+}
+
+// Parse reads the whole file into a new canvas, with the embedded palette and
+// font attached to it. ArtWorx always uses iCE colors.
+func (p *Parser) Parse() (*canvas.Canvas, error) {
+	data, err := io.ReadAll(p.reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize {
+		return nil, errors.New("ArtWorx file is truncated")
+	}
+
+	ega := xbin.DecodePalette(data[1 : 1+paletteSize])
+	pal := make([]color.RGBA, 16)
+	for i, idx := range egaIndex {
+		pal[i] = ega[idx]
+	}
+
+	c := canvas.NewCanvas(Width)
+	c.Font = canvas.NewFont(16, data[1+paletteSize:headerSize])
+	c.Palette = pal
+	attrs := xbin.Attributes{Palette: pal, ICE: true}
+	body := data[headerSize:]
+	for i := 0; i+1 < len(body); i += 2 {
+		c.Put(attrs.Cell(body[i], body[i+1]))
+	}
+	if len(body)%2 != 0 {
+		p.Diagnostics.Add(diag.Diagnostic{
+			Offset:   int64(len(data) - 1),
+			Row:      c.Cursor.Row,
+			Col:      c.Cursor.Col,
+			Severity: diag.Error,
+			Message:  "odd byte at end of data",
+		})
+	}
+	return c, nil
+}
@@ -1,8 +1,9 @@
 package ansi
 
 import (
+	"a2m2a/canvas"
+	"a2m2a/palette"
 	"image/color"
-	"math"
 )
 
 // AnsiPalette is the standard 16-color ANSI palette.
@@ -25,32 +26,78 @@ var AnsiPalette = []color.RGBA{
 	{0xff, 0xff, 0xff, 0xff}, // 15 - Bright White
 }
 
-// colorDistance calculates the Euclidean distance between two colors.
-func colorDistance(c1, c2 color.RGBA) float64 {
-	r1, g1, b1, _ := c1.RGBA()
-	r2, g2, b2, _ := c2.RGBA()
-	rd := float64(r1) - float64(r2)
-	gd := float64(g1) - float64(g2)
-	bd := float64(b1) - float64(b2)
-	return math.Sqrt(rd*rd + gd*gd + bd*bd)
+// PCOrder maps a PC text attribute color (blue is 1, red is 4) to its ANSI
+// color index (red is 1, blue is 4).
+var PCOrder = [16]int{0, 4, 2, 6, 1, 5, 3, 7, 8, 12, 10, 14, 9, 13, 11, 15}
+
+// PCPalette is AnsiPalette in PC attribute order, as indexed by the
+// attribute bytes of binary formats and BBS color codes.
+var PCPalette = buildPC(AnsiPalette)
+
+func buildPC(base []color.RGBA) []color.RGBA {
+	p := make([]color.RGBA, len(PCOrder))
+	for i, a := range PCOrder {
+		p[i] = base[a]
+	}
+	return p
+}
+
+// Palette256 is the xterm 256-color palette: the 16 ANSI colors followed by
+// a 6x6x6 color cube and a 24-step grayscale ramp.
+var Palette256 = build256(AnsiPalette)
+
+func build256(base []color.RGBA) []color.RGBA {
+	p := make([]color.RGBA, 0, 256)
+	p = append(p, base[:16]...)
+	levels := []uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				p = append(p, color.RGBA{levels[r], levels[g], levels[b], 0xff})
+			}
+		}
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + 10*i)
+		p = append(p, color.RGBA{v, v, v, 0xff})
+	}
+	return p
 }
 
-// FindClosestAnsiColor finds the closest color in the 16-color ANSI palette.
+// SetPalette replaces the 16 ANSI colors, e.g. with a terminal's palette
+// loaded through the palette package. Shorter palettes only override the
+// leading entries. The canvas defaults follow the new black and light grey,
+// so it must be called before any canvas is created.
+func SetPalette(p []color.RGBA) {
+	merged := make([]color.RGBA, len(AnsiPalette))
+	copy(merged, AnsiPalette)
+	copy(merged, p)
+	AnsiPalette = merged
+	PCPalette = buildPC(AnsiPalette)
+	Palette256 = build256(AnsiPalette)
+	canvas.DefaultFg = AnsiPalette[7]
+	canvas.DefaultBg = AnsiPalette[0]
+}
+
+// FindClosestAnsiColor finds the closest color in the 16-color ANSI palette
+// using the metric selected with palette.SetMetric.
 // It returns the color and its index in the palette.
 func FindClosestAnsiColor(c color.RGBA) (color.RGBA, int) {
 	if c.A == 0 {
 		return AnsiPalette[0], 0 // Transparent is black
 	}
 
-	closestIndex := 0
-	minDist := math.MaxFloat64
+	closestIndex := palette.Nearest(AnsiPalette, c)
+	return AnsiPalette[closestIndex], closestIndex
+}
 
-	for i, ansiColor := range AnsiPalette {
-		dist := colorDistance(c, ansiColor)
-		if dist < minDist {
-			minDist = dist
-			closestIndex = i
-		}
+// FindClosest256Color finds the closest color in the 256-color palette.
+// It returns the color and its index in the palette.
+func FindClosest256Color(c color.RGBA) (color.RGBA, int) {
+	if c.A == 0 {
+		return Palette256[0], 0
 	}
-	return AnsiPalette[closestIndex], closestIndex
+
+	closestIndex := palette.Nearest(Palette256, c)
+	return Palette256[closestIndex], closestIndex
 }
@@ -0,0 +1,39 @@
+package ansi
+
+import "strings"
+
+// ANSI music, as played by BBS terminals (BananaCom, SyncTERM), is an
+// ESC[M or ESC[N followed by a BASIC PLAY string and a ^N, e.g.
+// "ESC[MFT120L8CDEC^N". ESC[M without parameters is also Delete Line, so a
+// sequence only counts as music if a ^N follows soon, with nothing but
+// music characters before it.
+
+// maxMusic is how far ahead the parser looks for the ^N ending music.
+const maxMusic = 1024
+
+// musicChars are the characters a PLAY string is made of.
+const musicChars = "ABCDEFGLMNOPST0123456789#+-.<> "
+
+// skipMusic consumes the music string at the reader's position, if there is
+// one, and reports whether it did.
+func (p *Parser) skipMusic() bool {
+	head, _ := p.reader.Peek(maxMusic)
+	for i, b := range head {
+		if b == '\x0e' {
+			p.music = append(p.music, string(head[:i]))
+			p.reader.Discard(i + 1)
+			p.offset += int64(i + 1)
+			return true
+		}
+		if b >= 0x80 || !strings.ContainsRune(musicChars, rune(b)) && !strings.ContainsRune(strings.ToLower(musicChars), rune(b)) {
+			return false
+		}
+	}
+	return false
+}
+
+// Music returns the ANSI music strings found while parsing, in order. They
+// are not drawn on the canvas.
+func (p *Parser) Music() []string {
+	return p.music
+}
@@ -0,0 +1,60 @@
+package ansi
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestPabloDrawColors(t *testing.T) {
+	orange := color.RGBA{255, 128, 0, 255}
+	navy := color.RGBA{0, 0, 64, 255}
+	tests := []struct {
+		name   string
+		input  string
+		fg, bg color.RGBA
+	}{
+		{"foreground", "\x1b[1;255;128;0tx", orange, AnsiPalette[0]},
+		{"background", "\x1b[0;0;0;64tx", AnsiPalette[7], navy},
+		{"both", "\x1b[1;255;128;0t\x1b[0;0;0;64tx", orange, navy},
+		{"clamped", "\x1b[1;999;128;0tx", orange, AnsiPalette[0]},
+		{"SGR after", "\x1b[1;255;128;0t\x1b[32mx", AnsiPalette[2], AnsiPalette[0]},
+		{"reset", "\x1b[1;255;128;0t\x1b[0;0;0;64t\x1b[0mx", AnsiPalette[7], AnsiPalette[0]},
+		{"window manipulation", "\x1b[8;25;80tx", AnsiPalette[7], AnsiPalette[0]},
+		{"other selector", "\x1b[2;255;128;0tx", AnsiPalette[7], AnsiPalette[0]},
+	}
+	for _, tt := range tests {
+		_, c := parse(t, tt.input, 8)
+		cell := c.Grid[0][0]
+		if cell.Char != 'x' || cell.Fg != tt.fg || cell.Bg != tt.bg {
+			t.Errorf("%s: cell = %q %v on %v, want 'x' %v on %v", tt.name, cell.Char, cell.Fg, cell.Bg, tt.fg, tt.bg)
+		}
+	}
+}
+
+func TestMusic(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		text  string
+		music []string
+	}{
+		{"ESC[M music", "a\x1b[MFT120L8CDEC\x0eb", "ab", []string{"FT120L8CDEC"}},
+		{"ESC[N music", "a\x1b[Nmf o3 c#d\x0eb", "ab", []string{"mf o3 c#d"}},
+		{"several", "\x1b[MCD\x0ea\x1b[MEF\x0eb", "ab", []string{"CD", "EF"}},
+		{"empty", "a\x1b[M\x0eb", "ab", []string{""}},
+		{"delete line", "ab\r\ncd\x1b[A\x1b[Mx", "cdx\n", nil},
+		{"delete line with a count", "ab\r\ncd\x1b[A\x1b[1MCD\x0e", "cdCD\x0e\n", nil},
+		{"no ^N", "ab\r\ncd\x1b[A\x1b[MCDEF", "cdCDEF\n", nil},
+		{"not music characters", "ab\r\ncd\x1b[A\x1b[Mhi!\x0e", "cdhi!\x0e\n", nil},
+	}
+	for _, tt := range tests {
+		p, c := parse(t, tt.input, 8)
+		if got := text(c); got != tt.text {
+			t.Errorf("%s: text = %q, want %q", tt.name, got, tt.text)
+		}
+		if got := p.Music(); !reflect.DeepEqual(got, tt.music) {
+			t.Errorf("%s: music = %q, want %q", tt.name, got, tt.music)
+		}
+	}
+}
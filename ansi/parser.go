@@ -2,26 +2,69 @@ package ansi
 
 import (
 	"a2m2a/canvas"
+	"a2m2a/diag"
 	"bufio"
 	"image/color"
 	"io"
-	"strconv"
-	"strings"
 
 	"golang.org/x/text/encoding/charmap"
 )
 
+// graphics is the current graphic rendition.
+type graphics struct {
+	fg        color.RGBA
+	bg        color.RGBA
+	bold      bool
+	bright    bool
+	ice       bool
+	underline bool
+}
+
+func defaultGraphics() graphics {
+	return graphics{
+		fg:   canvas.DefaultFg,
+		bg:   canvas.DefaultBg,
+		bold: canvas.DefaultBold,
+		ice:  canvas.DefaultIce,
+	}
+}
+
+// savedState is what DECSC (ESC 7) saves.
+type savedState struct {
+	cursor canvas.Point
+	graphics
+}
+
 // Parser holds the state for parsing an ANSI stream.
 type Parser struct {
 	canvas      *canvas.Canvas
 	reader      *bufio.Reader
-	savedCursor canvas.Point // For DECSC and DECRC
-	// Current graphic rendition attributes
-	fg     color.RGBA
-	bg     color.RGBA
-	bold   bool
-	bright bool
-	ice    bool
+	savedCursor canvas.Point // For SCOSC and SCORC
+	saved       savedState   // For DECSC and DECRC
+	graphics
+	// autowrap is DEC mode 7: when off, the last column is overwritten.
+	autowrap bool
+	// iceColors is SyncTERM mode 33: blinking cells get a bright background.
+	iceColors bool
+
+	// music holds the ANSI music strings skipped so far.
+	music []string
+
+	// Diagnostics, if not nil, collects the unsupported and malformed
+	// sequences found.
+	Diagnostics *diag.Collector
+
+	// State machine and the control sequence being collected.
+	state    vtState
+	params   []int
+	param    int
+	hasParam bool
+	clamped  bool
+	private  rune
+	// offset counts the input bytes read; seqStart is the offset of the ESC
+	// starting the current sequence.
+	offset   int64
+	seqStart int64
 }
 
 // NewParser creates a new ANSI parser.
@@ -35,14 +78,10 @@ func NewParser(c *canvas.Canvas, r io.Reader, dataSize int64) *Parser {
 	// The input stream is decoded from CP437 to UTF-8.
 	decodedReader := charmap.CodePage437.NewDecoder().Reader(limitedReader)
 	return &Parser{
-		canvas:      c,
-		reader:      bufio.NewReader(decodedReader),
-		savedCursor: canvas.Point{Row: 0, Col: 0},
-		fg:          canvas.DefaultFg,
-		bg:          canvas.DefaultBg,
-		bold:        canvas.DefaultBold,
-		bright:      false,
-		ice:         canvas.DefaultIce,
+		canvas:   c,
+		reader:   bufio.NewReader(decodedReader),
+		graphics: defaultGraphics(),
+		autowrap: true,
 	}
 }
 
@@ -52,82 +91,58 @@ func (p *Parser) Parse() error {
 		r, _, err := p.reader.ReadRune()
 		if err != nil {
 			if err == io.EOF {
+				p.finish()
 				return nil
 			}
 			return err
 		}
-
-		switch r {
-		case '\x1b': // Escape character
-			if err := p.handleEscape(); err != nil {
-				return err
-			}
-		case '\n':
-			if p.canvas.Cursor.Col != 0 {
-				p.canvas.NewLine()
-			}
-		case '\r':
-			p.canvas.Cursor.Col = 0
-		case '\t':
-			// In the C code, tab size is configurable. We'll hardcode 8 for now.
-			const tabSize = 8
-			for i := 0; i < tabSize; i++ {
-				p.canvas.SetCell(' ', p.fg, p.bg, p.bold, p.bright, p.ice)
-			}
-		case '\x1a': // SAUCE separator. Should be handled by LimitReader now, but we keep this for safety.
+		// The CP437 decoder turns every byte into one rune.
+		p.offset++
+		if p.advance(r) {
 			return nil
-		default:
-			p.canvas.SetCell(r, p.fg, p.bg, p.bold, p.bright, p.ice)
 		}
 	}
 }
 
-func (p *Parser) handleEscape() error {
-	r, _, err := p.reader.ReadRune()
-	if err != nil {
-		return err
+// cell builds a canvas cell from the current graphic rendition.
+func (p *Parser) cell(r rune) canvas.Cell {
+	bg := p.bg
+	if p.iceColors && p.ice {
+		bg = brightBg(bg)
 	}
-
-	if r == '[' { // This is a Control Sequence Introducer (CSI)
-		return p.handleCSI()
+	return canvas.Cell{
+		Char:      r,
+		Fg:        p.fg,
+		Bg:        bg,
+		Bold:      p.bold,
+		Bright:    p.bright,
+		Ice:       p.ice,
+		Underline: p.underline,
 	}
-
-	// Other escape sequences are not supported for now.
-	return nil
 }
 
-func (p *Parser) handleCSI() error {
-	var params []int
-	var currentParam strings.Builder
-	var cmd rune
-
-	for {
-		r, _, err := p.reader.ReadRune()
-		if err != nil {
-			return err
-		}
-
-		if r >= '0' && r <= '9' {
-			currentParam.WriteRune(r)
-		} else {
-			if currentParam.Len() > 0 {
-				val, _ := strconv.Atoi(currentParam.String())
-				params = append(params, val)
-				currentParam.Reset()
-			}
-			if r == ';' {
-				if len(params) == 0 {
-					params = append(params, 0)
-				}
-				continue
-			}
-			cmd = r
-			break
+// brightBg returns the bright counterpart of a dark ANSI color, which blink
+// selects in iCE color mode.
+func brightBg(c color.RGBA) color.RGBA {
+	for i := 0; i < 8; i++ {
+		if AnsiPalette[i] == c {
+			return AnsiPalette[i+8]
 		}
 	}
+	return c
+}
 
-	p.executeCommand(cmd, params)
-	return nil
+// blank is the cell erased areas are filled with: a space in the current
+// colors.
+func (p *Parser) blank() canvas.Cell {
+	return canvas.Cell{
+		Char:   ' ',
+		Fg:     p.fg,
+		Bg:     p.bg,
+		Bold:   p.bold,
+		Bright: p.bright,
+		Ice:    p.ice,
+	}
 }
 
 func (p *Parser) executeCommand(cmd rune, params []int) {
@@ -137,32 +152,49 @@ func (p *Parser) executeCommand(cmd rune, params []int) {
 		}
 		return defaultValue
 	}
+	// getCount reads a repeat count, for which 0 means 1.
+	getCount := func(index int) int {
+		return max(getParam(index, 1), 1)
+	}
 
 	switch cmd {
 	case 'm': // Select Graphic Rendition (SGR)
 		if len(params) == 0 {
 			params = []int{0} // Treat `[m` as `[0m`
 		}
-		for _, param := range params {
+		for i := 0; i < len(params); i++ {
+			param := params[i]
 			switch {
 			case param == 0: // Reset
-				p.fg = canvas.DefaultFg
-				p.bg = canvas.DefaultBg
-				p.bold = canvas.DefaultBold
-				p.bright = false
-				p.ice = canvas.DefaultIce
+				p.graphics = defaultGraphics()
 			case param == 1:
 				p.bold = true
+			case param == 4:
+				p.underline = true
 			case param == 5:
 				p.ice = true
 			case param == 22:
 				p.bold = false
 				p.bright = false
+			case param == 24:
+				p.underline = false
 			case param == 25:
 				p.ice = false
 			case param >= 30 && param <= 37:
 				p.fg = AnsiPalette[param-30]
 				p.bright = false // Standard colors are not bright
+			case param == 38 || param == 48: // Extended color: 5;n or 2;r;g;b
+				c, n, ok := extendedColor(params[i+1:])
+				i += n
+				if !ok {
+					p.report(diag.Error, "invalid extended color in %s", p.sequence(cmd))
+					continue
+				}
+				if param == 38 {
+					p.fg = c
+				} else {
+					p.bg = c
+				}
 			case param == 39:
 				p.fg = canvas.DefaultFg
 			case param >= 40 && param <= 47:
@@ -175,6 +207,8 @@ func (p *Parser) executeCommand(cmd rune, params []int) {
 			case param >= 100 && param <= 107: // high intensity background
 				p.bg = AnsiPalette[param-100+8]
 				p.ice = true
+			default:
+				p.report(diag.Warning, "unsupported SGR parameter %d", param)
 			}
 		}
 	case 'H', 'f': // Cursor Position
@@ -189,22 +223,106 @@ func (p *Parser) executeCommand(cmd rune, params []int) {
 		p.canvas.MoveForward(getParam(0, 1))
 	case 'D': // Cursor Backward
 		p.canvas.MoveBackward(getParam(0, 1))
+	case 'E': // Cursor Next Line
+		p.canvas.MoveDown(getCount(0))
+		p.canvas.Cursor.Col = 0
+	case 'F': // Cursor Previous Line
+		p.canvas.MoveUp(getCount(0))
+		p.canvas.Cursor.Col = 0
+	case 'G': // Cursor Horizontal Absolute
+		p.canvas.SetCursor(p.canvas.Cursor.Row, min(getParam(0, 1), p.canvas.Width())-1)
+	case 'd': // Line Position Absolute
+		p.canvas.SetCursor(getParam(0, 1)-1, p.canvas.Cursor.Col)
 	case 'J': // Erase in Display
 		mode := getParam(0, 0)
-		switch mode {
-		case 2: // Erase entire screen and move cursor to home
-			p.canvas.Clear(canvas.Cell{
-				Char:   ' ',
-				Fg:     p.fg,
-				Bg:     p.bg,
-				Bold:   p.bold,
-				Bright: p.bright,
-				Ice:    p.ice,
-			})
+		if mode == 2 {
+			// ANSI.SYS also homes the cursor, and art relies on it.
+			p.canvas.Clear(p.blank())
+		} else {
+			p.canvas.EraseInDisplay(mode, p.blank())
+		}
+	case 'K': // Erase in Line
+		p.canvas.EraseInLine(getParam(0, 0), p.blank())
+	case '@': // Insert Character
+		p.canvas.InsertChars(getCount(0), p.blank())
+	case 'P': // Delete Character
+		p.canvas.DeleteChars(getCount(0), p.blank())
+	case 'L': // Insert Line
+		p.canvas.InsertLines(getCount(0), p.blank())
+	case 'M': // Delete Line, unless it starts ANSI music.
+		if len(params) == 0 && p.skipMusic() {
+			break
+		}
+		p.canvas.DeleteLines(getCount(0), p.blank())
+	case 'N': // ANSI music (BANSI).
+		if len(params) == 0 {
+			p.skipMusic()
+		}
+	case 'S': // Scroll Up
+		p.canvas.ScrollUp(getCount(0), p.blank())
+	case 'T': // Scroll Down
+		p.canvas.ScrollDown(getCount(0), p.blank())
+	case 'I': // Cursor Horizontal Tab
+		p.canvas.Tab(getCount(0))
+	case 'Z': // Cursor Backward Tab
+		p.canvas.BackTab(getCount(0))
+	case 'g': // Tab Clear: 0 at the cursor, 3 everywhere.
+		switch getParam(0, 0) {
+		case 0:
+			p.canvas.ClearTabStop()
+		case 3:
+			p.canvas.ClearTabStops()
+		}
+	case 't': // PabloDraw 24-bit color: 0;r;g;b for the background, 1;r;g;b for the foreground.
+		if len(params) != 4 || params[0] > 1 {
+			break // Window manipulation (XTWINOPS) with the same final byte.
+		}
+		c := color.RGBA{clamp8(params[1]), clamp8(params[2]), clamp8(params[3]), 0xff}
+		if params[0] == 1 {
+			p.fg = c
+		} else {
+			p.bg = c
 		}
 	case 's': // Save Cursor Position (SCOSC/DECSC)
 		p.savedCursor = p.canvas.Cursor
 	case 'u': // Restore Cursor Position (SCORC/DECRC)
 		p.canvas.Cursor = p.savedCursor
+	default:
+		p.report(diag.Warning, "unsupported control sequence %s", p.sequence(cmd))
+	}
+}
+
+// extendedColor decodes the arguments of SGR 38/48: "5;n" selects from the
+// 256-color palette, "2;r;g;b" is a direct RGB color. It returns the color
+// and how many parameters it consumed.
+func extendedColor(args []int) (color.RGBA, int, bool) {
+	if len(args) == 0 {
+		return color.RGBA{}, 0, false
+	}
+	switch args[0] {
+	case 5:
+		if len(args) < 2 {
+			return color.RGBA{}, len(args), false
+		}
+		if args[1] < 0 || args[1] >= len(Palette256) {
+			return color.RGBA{}, 2, false
+		}
+		return Palette256[args[1]], 2, true
+	case 2:
+		if len(args) < 4 {
+			return color.RGBA{}, len(args), false
+		}
+		return color.RGBA{clamp8(args[1]), clamp8(args[2]), clamp8(args[3]), 0xff}, 4, true
+	}
+	return color.RGBA{}, 1, false
+}
+
+func clamp8(v int) uint8 {
+	if v > 255 {
+		return 255
+	}
+	if v < 0 {
+		return 0
 	}
+	return uint8(v)
 }
@@ -0,0 +1,78 @@
+package ansi
+
+import (
+	"a2m2a/canvas"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// parse reads input into a canvas width columns wide.
+func parse(t *testing.T, input string, width int) (*Parser, *canvas.Canvas) {
+	t.Helper()
+	c := canvas.NewCanvas(width)
+	p := NewParser(c, strings.NewReader(input), 0)
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return p, c
+}
+
+// text returns the characters of the canvas, one line per row, with
+// trailing spaces trimmed.
+func text(c *canvas.Canvas) string {
+	var lines []string
+	for _, row := range c.Grid {
+		var line strings.Builder
+		for _, cell := range row {
+			line.WriteRune(cell.Char)
+		}
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestEditCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"erase to end of line", "abcd\x1b[3D\x1b[K", "a"},
+		{"erase to start of line", "abcd\x1b[2D\x1b[1K", "   d"},
+		{"erase line", "abcd\x1b[2K", ""},
+		{"erase to end of display", "ab\r\ncd\x1b[A\x1b[J", "ab\n"},
+		{"erase to start of display", "ab\r\ncde\x1b[2D\x1b[1J", "\n  e"},
+		{"clear homes the cursor", "ab\r\ncd\x1b[2Jx", "x\n"},
+		{"column absolute", "abcd\x1b[2Gx", "axcd"},
+		{"column absolute past the edge", "\x1b[99Gx", "       x"},
+		{"row absolute", "a\x1b[3dx", "a\n\n x"},
+		{"next line", "ab\x1b[2Ex", "ab\n\nx"},
+		{"previous line", "a\r\n\r\nbc\x1b[2Fx", "x\n\nbc"},
+		{"insert chars", "abcd\x1b[3D\x1b[2@", "a  bcd"},
+		{"delete chars", "abcd\x1b[3D\x1b[2P", "ad"},
+		{"insert line", "ab\r\ncd\x1b[A\x1b[L", "\nab\ncd"},
+		{"delete line", "ab\r\ncd\x1b[A\x1b[M", "cd\n"},
+		{"scroll up", "ab\r\ncd\x1b[S", "cd\n"},
+		{"scroll down", "ab\r\ncd\x1b[2T", "\n\nab\ncd"},
+	}
+	for _, tt := range tests {
+		_, c := parse(t, tt.input, 8)
+		if got := text(c); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditLimits(t *testing.T) {
+	for _, cmd := range []string{"E", "B", "L", "T"} {
+		input := strings.Repeat("\x1b[65535"+cmd, 100) + "x"
+		_, c := parse(t, input, 80)
+		if len(c.Grid) > canvas.MaxRows {
+			t.Errorf("ESC[n%s: canvas grew to %d rows", cmd, len(c.Grid))
+		}
+		if err := c.Err(); !errors.Is(err, canvas.ErrTooLarge) {
+			t.Errorf("ESC[n%s: Err() = %v, want ErrTooLarge", cmd, err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package ansi
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The parser runs the input through a state machine modeled on the DEC VT
+// parser (https://vt100.net/emu/dec_ansi_parser): every escape sequence is
+// consumed in full, including the ones that are not applied, so that their
+// payload never ends up on the canvas.
+
+// vtState is the state of the escape sequence state machine.
+type vtState int
+
+const (
+	stateGround vtState = iota
+	// stateEscape follows an ESC.
+	stateEscape
+	// stateEscapeIntermediate consumes ESC sequences with intermediate
+	// bytes, e.g. the character set designations ESC ( B.
+	stateEscapeIntermediate
+	// stateCSI collects the parameters of a control sequence.
+	stateCSI
+	// stateCSIIntermediate follows intermediate bytes in a control sequence.
+	stateCSIIntermediate
+	// stateCSIIgnore consumes a malformed control sequence up to its final
+	// byte.
+	stateCSIIgnore
+	// stateOSC consumes an operating system command (ESC ] ... BEL or ST),
+	// e.g. a window title.
+	stateOSC
+	// stateString consumes DCS, SOS, PM and APC payloads up to ST.
+	stateString
+	// stateStringEscape follows an ESC inside a string, which is either the
+	// ST (ESC \) ending it or the start of a new sequence.
+	stateStringEscape
+)
+
+// maxParam caps parameter values, so that absurd values can't overflow.
+const maxParam = 1 << 16
+
+// advance feeds one rune to the state machine. It reports true when the
+// input is over (a SAUCE separator was reached).
+func (p *Parser) advance(r rune) bool {
+	if r == '\x1a' { // SAUCE separator. Should be handled by LimitReader now, but we keep this for safety.
+		p.finish()
+		return true
+	}
+
+	switch p.state {
+	case stateGround:
+		p.ground(r)
+	case stateEscape:
+		p.escape(r)
+	case stateEscapeIntermediate:
+		if r == '\x1b' {
+			p.report(diag.Error, "escape sequence interrupted by ESC")
+			p.startEscape()
+		} else if r >= 0x30 && r <= 0x7e {
+			p.state = stateGround
+		}
+	case stateCSI, stateCSIIntermediate, stateCSIIgnore:
+		p.csi(r)
+	case stateOSC:
+		switch r {
+		case '\a':
+			p.state = stateGround
+		case '\x1b':
+			p.state = stateStringEscape
+		}
+	case stateString:
+		if r == '\x1b' {
+			p.state = stateStringEscape
+		}
+	case stateStringEscape:
+		if r == '\\' {
+			p.state = stateGround
+		} else {
+			p.report(diag.Error, "unterminated string sequence")
+			p.seqStart = p.offset - 2
+			p.escape(r)
+		}
+	}
+	return false
+}
+
+// finish reports a sequence left open at the end of the input.
+func (p *Parser) finish() {
+	if p.state != stateGround {
+		p.report(diag.Error, "truncated escape sequence at end of input")
+	}
+}
+
+// startEscape enters the escape state for the ESC just read.
+func (p *Parser) startEscape() {
+	p.state = stateEscape
+	p.seqStart = p.offset - 1
+}
+
+// report records a diagnostic for the sequence being parsed, at the cursor.
+func (p *Parser) report(sev diag.Severity, format string, args ...any) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   p.seqStart,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *Parser) ground(r rune) {
+	switch r {
+	case '\x1b':
+		p.startEscape()
+	case '\n':
+		// A full line followed by a line break is a single line unless the
+		// canvas uses ANSI.SYS immediate wrapping.
+		p.canvas.NewLine()
+	case '\r':
+		p.canvas.Cursor.Col = 0
+	case '\t':
+		p.canvas.Tab(1)
+	default:
+		p.put(p.cell(r))
+	}
+}
+
+// escape handles the byte after an ESC.
+func (p *Parser) escape(r rune) {
+	p.state = stateGround
+	switch {
+	case r == '[':
+		p.state = stateCSI
+		p.params = p.params[:0]
+		p.param, p.hasParam, p.clamped = 0, false, false
+		p.private = 0
+	case r == ']':
+		p.state = stateOSC
+	case r == 'P' || r == 'X' || r == '^' || r == '_': // DCS, SOS, PM, APC
+		p.state = stateString
+	case r == '\x1b':
+		p.report(diag.Error, "escape sequence interrupted by ESC")
+		p.startEscape()
+	case r >= 0x20 && r <= 0x2f:
+		p.state = stateEscapeIntermediate
+	case r == '7': // DECSC: save the cursor and the graphic rendition.
+		p.saved = savedState{cursor: p.canvas.Cursor, graphics: p.graphics}
+	case r == '8': // DECRC
+		p.canvas.Cursor = p.saved.cursor
+		p.graphics = p.saved.graphics
+	case r == 'H': // HTS: set a tab stop.
+		p.canvas.SetTabStop()
+	case r == 'D': // IND: index.
+		p.canvas.MoveDown(1)
+	case r == 'E': // NEL: next line.
+		p.canvas.NewLine()
+	case r == 'M': // RI: reverse index, scrolling at the top.
+		if p.canvas.Cursor.Row == 0 {
+			p.canvas.ScrollDown(1, p.blank())
+		} else {
+			p.canvas.MoveUp(1)
+		}
+	case r == 'c': // RIS: reset to the initial state.
+		p.graphics = defaultGraphics()
+		p.autowrap, p.iceColors = true, false
+		p.canvas.Clear(p.blank())
+	default:
+		p.report(diag.Warning, "unsupported escape sequence ESC %q", r)
+	}
+}
+
+// csi collects a control sequence: an optional private marker (< = > ?),
+// parameters separated by ; or :, intermediate bytes and a final byte.
+func (p *Parser) csi(r rune) {
+	switch {
+	case r == '\x1b':
+		p.report(diag.Error, "control sequence %s interrupted by ESC", p.sequence(0))
+		p.startEscape()
+	case r >= 0x40 && r <= 0x7e: // Final byte.
+		if p.state == stateCSIIntermediate {
+			p.report(diag.Warning, "unsupported control sequence with intermediate bytes ending in %q", r)
+		}
+		if p.state == stateCSI {
+			if p.hasParam || len(p.params) > 0 {
+				p.params = append(p.params, p.param)
+			}
+			if p.private != 0 {
+				p.executePrivate(p.private, r, p.params)
+			} else {
+				p.executeCommand(r, p.params)
+			}
+		}
+		p.state = stateGround
+	case p.state == stateCSIIgnore:
+	case r >= 0x20 && r <= 0x2f: // Intermediate bytes: no such sequence is applied.
+		p.state = stateCSIIntermediate
+	case p.state == stateCSIIntermediate:
+		if r >= 0x30 && r <= 0x3f {
+			p.report(diag.Error, "malformed control sequence: parameter after intermediate bytes")
+			p.state = stateCSIIgnore
+		}
+	case r >= '0' && r <= '9':
+		if p.param = p.param*10 + int(r-'0'); p.param > maxParam {
+			if !p.clamped {
+				p.report(diag.Warning, "parameter larger than %d", maxParam)
+			}
+			p.param, p.clamped = maxParam, true
+		}
+		p.hasParam = true
+	case r == ';' || r == ':':
+		p.params = append(p.params, p.param)
+		p.param, p.hasParam = 0, false
+	case r >= '<' && r <= '?':
+		if p.private != 0 || p.hasParam || len(p.params) > 0 {
+			p.report(diag.Error, "malformed control sequence: misplaced %q", r)
+			p.state = stateCSIIgnore
+		} else {
+			p.private = r
+		}
+	default:
+		// A control or non-ASCII character breaks the sequence; it is
+		// dropped along with it.
+		p.report(diag.Error, "control sequence %s interrupted by %q", p.sequence(0), r)
+		p.state = stateGround
+	}
+}
+
+// executePrivate applies the DEC (?) and ANSI.SYS (=) private modes that
+// matter for art. Other private sequences are consumed without effect.
+func (p *Parser) executePrivate(private, cmd rune, params []int) {
+	if cmd != 'h' && cmd != 'l' {
+		return
+	}
+	on := cmd == 'h'
+	for _, mode := range params {
+		switch {
+		case mode == 7 && (private == '?' || private == '='): // Autowrap.
+			p.autowrap = on
+		case mode == 33 && private == '?': // SyncTERM: iCE colors.
+			p.iceColors = on
+		}
+	}
+}
+
+// put writes a cell at the cursor. With autowrap off, characters past the
+// last column overwrite it instead of wrapping.
+func (p *Parser) put(cell canvas.Cell) {
+	last := p.canvas.Width() - 1
+	if p.autowrap || p.canvas.Cursor.Col < last {
+		p.canvas.Put(cell)
+		return
+	}
+	p.canvas.SetCursor(p.canvas.Cursor.Row, last)
+	p.canvas.Grid[p.canvas.Cursor.Row][last] = cell
+}
+
+// sequence spells out the control sequence collected so far, followed by the
+// final byte if it is not 0, for messages.
+func (p *Parser) sequence(final rune) string {
+	var b strings.Builder
+	b.WriteString("ESC[")
+	if p.private != 0 {
+		b.WriteRune(p.private)
+	}
+	for i, v := range p.params {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(strconv.Itoa(v))
+	}
+	if final != 0 {
+		b.WriteRune(final)
+	}
+	return b.String()
+}
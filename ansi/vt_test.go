@@ -0,0 +1,125 @@
+package ansi
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"strings"
+	"testing"
+)
+
+func TestEscapes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"save and restore cursor", "ab\x1b7cd\r\nef\x1b8x", "abxd\nef"},
+		{"SCO save and restore cursor", "ab\x1b[scd\x1b[ux", "abxd"},
+		{"OSC ended by BEL", "a\x1b]0;title\ab", "ab"},
+		{"OSC ended by ST", "a\x1b]2;title\x1b\\b", "ab"},
+		{"DCS", "a\x1bPq#0;2;0;0;0\x1b\\b", "ab"},
+		{"SOS", "a\x1bXpayload\x1b\\b", "ab"},
+		{"PM and APC", "a\x1b^pm\x1b\\\x1b_apc\x1b\\b", "ab"},
+		{"character set designation", "a\x1b(Bb\x1b)0c", "abc"},
+		{"intermediate bytes", "a\x1b[1 qb", "ab"},
+		{"private sequence", "a\x1b[?25lb\x1b[>0cc", "abc"},
+		{"ANSI.SYS mode", "a\x1b[=255hb", "ab"},
+		{"index", "ab\x1bDx", "ab\n  x"},
+		{"next line", "ab\x1bEx", "ab\nx"},
+		{"reverse index", "a\r\nb\x1bMx", "ax\nb"},
+		{"reverse index scrolls at the top", "ab\x1bMx", "  x\nab"},
+		{"reset", "ab\r\ncd\x1bcx", "x\n"},
+		{"tab stop", "\x1b[3g\x1b[5G\x1bH\rab\tx", "ab  x"},
+		{"string ended by a new sequence", "a\x1bPpayload\x1b[1mb", "ab"},
+		{"interrupted sequence", "a\x1b[3\x1b[1mb", "ab"},
+		{"control character breaks a sequence", "a\x1b[3\nb", "ab"},
+		{"misplaced private marker", "a\x1b[1?5hb", "ab"},
+		{"parameter after intermediate", "a\x1b[ 1qb", "ab"},
+	}
+	for _, tt := range tests {
+		_, c := parse(t, tt.input, 8)
+		if got := text(c); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreGraphics(t *testing.T) {
+	_, c := parse(t, "\x1b[31m\x1b7\x1b[32ma\x1b8b", 8)
+	if got := c.Grid[0][0].Fg; got != AnsiPalette[1] {
+		t.Errorf("DECRC: fg = %v, want red", got)
+	}
+	// SCORC only restores the cursor.
+	_, c = parse(t, "\x1b[31m\x1b[s\x1b[32ma\x1b[ub", 8)
+	if got := c.Grid[0][0].Fg; got != AnsiPalette[2] {
+		t.Errorf("SCORC: fg = %v, want green", got)
+	}
+}
+
+func TestPrivateModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"autowrap", "abcdef", "abcd\nef"},
+		{"autowrap off", "\x1b[?7labcdef", "abcf"},
+		{"ANSI.SYS autowrap off", "\x1b[=7labcdef", "abcf"},
+		{"autowrap back on", "\x1b[?7labcdef\x1b[?7hgh", "abcg\nh"},
+		{"several modes", "\x1b[?25;7labcdef", "abcf"},
+	}
+	for _, tt := range tests {
+		_, c := parse(t, tt.input, 4)
+		if got := text(c); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	ice := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{"blink", "\x1b[5;44mx", 4},
+		{"iCE colors", "\x1b[?33h\x1b[5;44mx", 12},
+		{"iCE colors off", "\x1b[?33h\x1b[?33l\x1b[5;44mx", 4},
+		{"reset turns iCE colors off", "\x1b[?33h\x1bc\x1b[5;44mx", 4},
+	}
+	for _, tt := range ice {
+		_, c := parse(t, tt.input, 4)
+		if got := c.Grid[0][0].Bg; got != AnsiPalette[tt.want] {
+			t.Errorf("%s: bg = %v, want palette color %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStateMachineDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"clean", "\x1b[1;31ma\x1b]0;t\a\x1b(B", nil},
+		{"unsupported escape", "\x1bZ", []string{"1:1 (byte 0): warning: unsupported escape sequence ESC 'Z'"}},
+		{"interrupted", "a\x1b[3\x1b[m", []string{"1:2 (byte 1): error: control sequence ESC[ interrupted by ESC"}},
+		{"truncated", "a\x1b[3", []string{"1:2 (byte 1): error: truncated escape sequence at end of input"}},
+		{"unterminated string", "\x1bPq\x1b[m", []string{"1:1 (byte 0): error: unterminated string sequence"}},
+		{"large parameter", "\x1b[99999999C", []string{"1:1 (byte 0): warning: parameter larger than 65536"}},
+		{"misplaced marker", "\x1b[1?h", []string{"1:1 (byte 0): error: malformed control sequence: misplaced '?'"}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		p := NewParser(c, strings.NewReader(tt.input), 0)
+		p.Diagnostics = &diag.Collector{}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -2,30 +2,41 @@ package ansi
 
 import (
 	"a2m2a/canvas"
+	"a2m2a/cp437"
 	"fmt"
 	"image/color"
 	"io"
 	"strings"
 )
 
+// Options controls ANSI output.
+type Options struct {
+	// Colors is the size of the palette colors are snapped to: 16 (the
+	// default) for classic ANSI art, or 256 to also use xterm's extended
+	// colors (SGR 38;5 and 48;5).
+	Colors int
+}
+
 // Writer converts a canvas to an ANSI formatted string.
 type Writer struct {
 	canvas *canvas.Canvas
 	writer io.Writer
+	opts   Options
 }
 
 // NewWriter creates a new ANSI writer.
-func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+func NewWriter(c *canvas.Canvas, w io.Writer, opts Options) *Writer {
 	return &Writer{
 		canvas: c,
 		writer: w,
+		opts:   opts,
 	}
 }
 
 // Write generates the ANSI output from the canvas.
 func (w *Writer) Write() error {
 	var prevFg, prevBg color.RGBA
-	var prevBold bool
+	var prevBold, prevUnderline bool
 
 	_, maxRow, _, _ := w.canvas.GetContentBounds()
 
@@ -46,17 +57,16 @@ func (w *Writer) Write() error {
 
 		// Reset attributes at the start of each line for clean state.
 		prevFg, prevBg = color.RGBA{}, color.RGBA{}
-		prevBold = false
+		prevBold, prevUnderline = false, false
 		fmt.Fprint(w.writer, "\x1b[0m")
 
 		for i := 0; i <= lastCharIndex; i++ {
 			cell := row[i]
-			if cell.Fg != prevFg || cell.Bg != prevBg || cell.Bold != prevBold {
+			if cell.Fg != prevFg || cell.Bg != prevBg || cell.Bold != prevBold || cell.Underline != prevUnderline {
 				var params []string
 
 				// Find the closest ANSI color index for FG and BG
-				_, fgIndex := FindClosestAnsiColor(cell.Fg)
-				_, bgIndex := FindClosestAnsiColor(cell.Bg)
+				fgIndex, bgIndex := w.colorIndex(cell.Fg), w.colorIndex(cell.Bg)
 
 				// Determine if the colors are in the "bright" range (8-15)
 				fgIsBright := fgIndex >= 8
@@ -68,13 +78,23 @@ func (w *Writer) Write() error {
 					params = append(params, "22") // Non-bold
 				}
 
-				if fgIsBright {
+				if cell.Underline {
+					params = append(params, "4")
+				} else if prevUnderline {
+					params = append(params, "24")
+				}
+
+				if fgIndex >= 16 {
+					params = append(params, fmt.Sprintf("38;5;%d", fgIndex))
+				} else if fgIsBright {
 					params = append(params, fmt.Sprintf("%d", (fgIndex-8)+90))
 				} else {
 					params = append(params, fmt.Sprintf("%d", fgIndex+30))
 				}
 
-				if bgIsBright {
+				if bgIndex >= 16 {
+					params = append(params, fmt.Sprintf("48;5;%d", bgIndex))
+				} else if bgIsBright {
 					params = append(params, fmt.Sprintf("%d", (bgIndex-8)+100))
 				} else {
 					params = append(params, fmt.Sprintf("%d", bgIndex+40))
@@ -85,8 +105,9 @@ func (w *Writer) Write() error {
 				prevFg = cell.Fg
 				prevBg = cell.Bg
 				prevBold = cell.Bold
+				prevUnderline = cell.Underline
 			}
-			if _, err := w.writer.Write([]byte(string(cell.Char))); err != nil {
+			if _, err := w.writer.Write([]byte{encode(cell.Char)}); err != nil {
 				return err
 			}
 		}
@@ -95,3 +116,24 @@ func (w *Writer) Write() error {
 
 	return nil
 }
+
+// encode returns the CP437 byte written for r, the encoding the parser reads.
+// Characters outside CP437, and glyphs whose code the parser would read as a
+// control (ESC, line breaks, tab and the SAUCE separator), become '?'.
+func encode(r rune) byte {
+	b, ok := cp437.Encode(r)
+	if !ok || b == '\x1b' || b == '\n' || b == '\r' || b == '\t' || b == '\x1a' {
+		return '?'
+	}
+	return b
+}
+
+// colorIndex maps a color to its index in the output palette.
+func (w *Writer) colorIndex(c color.RGBA) int {
+	if w.opts.Colors == 256 {
+		_, idx := FindClosest256Color(c)
+		return idx
+	}
+	_, idx := FindClosestAnsiColor(c)
+	return idx
+}
@@ -0,0 +1,49 @@
+package ansi
+
+import (
+	"bytes"
+	"testing"
+
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string // As read back; "" means the same as text.
+	}{
+		{"ascii", "Hello, world", ""},
+		{"blocks", "█▓▒░▀▄▌▐", ""},
+		{"box drawing", "╔═╗║╚╝┌─┐", ""},
+		{"pictographs", "☺♥♦♣♠", ""},
+		{"outside cp437", "a€b", "a?b"},
+		{"control glyphs", "◙♪→○←", "?????"},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want == "" {
+			want = tt.text
+		}
+		c := canvas.NewCanvas(80)
+		for _, r := range tt.text {
+			c.Put(canvas.Cell{Char: r, Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+		}
+		var out bytes.Buffer
+		if err := NewWriter(c, &out, Options{}).Write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		back := canvas.NewCanvas(80)
+		if err := NewParser(back, &out, 0).Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []rune
+		for _, cell := range back.Grid[0][:len([]rune(want))] {
+			got = append(got, cp437.ToUnicode(cell.Char))
+		}
+		if string(got) != want {
+			t.Errorf("%s: read back %q, want %q", tt.name, string(got), want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Package artpack converts and renders every piece of art inside an artpack
+// ZIP straight from the archive, without extracting it to disk.
+package artpack
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/convert"
+	"a2m2a/sauce"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// artExtensions are the extensions commonly used for art in artpacks, in
+// addition to the extensions of all registered formats.
+var artExtensions = map[string]bool{
+	".ans": true,
+	".asc": true,
+	".bin": true,
+	".xb":  true,
+	".nfo": true,
+}
+
+// DefaultMaxEntrySize is the default limit on the uncompressed size of an
+// archive member.
+const DefaultMaxEntrySize = 16 << 20
+
+// Options controls how an artpack is processed.
+type Options struct {
+	// OutDir receives the rendered PNGs, thumbnails and the index files.
+	OutDir string
+	// Decode is applied to every entry; the SAUCE record of each entry is
+	// filled in automatically.
+	Decode convert.DecodeOptions
+	// ThumbScale is the render scale of thumbnails; zero means 0.5.
+	ThumbScale float64
+	// MaxEntrySize limits the uncompressed size of a member, so that a zip
+	// bomb can't exhaust memory; zero means DefaultMaxEntrySize. Larger
+	// members are recorded in the index with an error.
+	MaxEntrySize int64
+}
+
+// Entry describes the result of processing a single archive member.
+type Entry struct {
+	Name      string `json:"name"`
+	Format    string `json:"format,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Group     string `json:"group,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Columns   int    `json:"columns,omitempty"`
+	Rows      int    `json:"rows,omitempty"`
+	Image     string `json:"image,omitempty"`
+	Thumbnail string `json:"thumbnail,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Index lists everything found in an artpack.
+type Index struct {
+	Archive     string  `json:"archive"`
+	Description string  `json:"description,omitempty"` // From FILE_ID.DIZ.
+	Entries     []Entry `json:"entries"`
+}
+
+// Open processes the artpack at zipPath; see Process.
+func Open(ctx context.Context, zipPath string, opts Options) (*Index, error) {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return Process(ctx, &zr.Reader, filepath.Base(zipPath), opts)
+}
+
+// Process renders every art entry of the archive to a PNG and a thumbnail in
+// opts.OutDir and returns the index. Entries that fail to parse are recorded
+// in the index with their error instead of aborting the run.
+func Process(ctx context.Context, zr *zip.Reader, name string, opts Options) (*Index, error) {
+	if opts.ThumbScale <= 0 {
+		opts.ThumbScale = 0.5
+	}
+	if opts.MaxEntrySize <= 0 {
+		opts.MaxEntrySize = DefaultMaxEntrySize
+	}
+	if err := os.MkdirAll(opts.OutDir, 0755); err != nil {
+		return nil, err
+	}
+
+	index := &Index{Archive: name}
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return index, err
+		}
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+
+		if strings.EqualFold(path.Base(zf.Name), "FILE_ID.DIZ") {
+			data, err := readEntry(zf, opts.MaxEntrySize)
+			if err == nil {
+				index.Description = decodeText(data)
+			}
+			continue
+		}
+		if !isArt(zf.Name) {
+			continue
+		}
+		index.Entries = append(index.Entries, processEntry(ctx, zf, opts))
+	}
+	return index, nil
+}
+
+// processEntry parses a single archive member and renders it.
+func processEntry(ctx context.Context, zf *zip.File, opts Options) Entry {
+	entry := Entry{Name: zf.Name}
+	fail := func(err error) Entry {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	data, err := readEntry(zf, opts.MaxEntrySize)
+	if err != nil {
+		return fail(err)
+	}
+
+	decodeOpts := opts.Decode
+	decodeOpts.Sauce, _ = sauce.Get(bytes.NewReader(data))
+	if rec := decodeOpts.Sauce; rec != nil {
+		entry.Title = trimField(rec.Title)
+		entry.Author = trimField(rec.Author)
+		entry.Group = trimField(rec.Group)
+		entry.Date = trimField(rec.Date)
+	}
+
+	// Detect the format like the single-file path does: .asc and .nfo
+	// members often contain color codes anyway, so the content decides, and
+	// only formats without a signature are taken from the extension.
+	c, f, err := convert.Decode(ctx, bytes.NewReader(data), convert.InputFormat("", zf.Name), decodeOpts)
+	if err != nil {
+		return fail(err)
+	}
+	entry.Format = f.Name
+	minRow, maxRow, minCol, maxCol := c.GetContentBounds()
+	entry.Columns = maxCol - minCol + 1
+	entry.Rows = maxRow - minRow + 1
+
+	base, err := outputBase(zf.Name)
+	if err != nil {
+		return fail(err)
+	}
+	entry.Image = base + ".png"
+	entry.Thumbnail = base + "_thumb.png"
+	if err := writeImage(ctx, filepath.Join(opts.OutDir, filepath.FromSlash(entry.Image)), c, 1.0); err != nil {
+		return fail(err)
+	}
+	if err := writeImage(ctx, filepath.Join(opts.OutDir, filepath.FromSlash(entry.Thumbnail)), c, opts.ThumbScale); err != nil {
+		return fail(err)
+	}
+	return entry
+}
+
+// isArt reports whether an archive member looks like art by its extension.
+func isArt(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	if artExtensions[ext] {
+		return true
+	}
+	f := convert.ForPath(name)
+	return f != nil && f.Decoder != nil && !f.Image
+}
+
+// outputBase turns an archive member name into a slash-separated path
+// relative to the output directory. Cleaning it as an absolute path drops any
+// leading "../", so entries cannot escape the output directory. The original
+// extension is kept so that "art.ans" and "art.bin" do not collide.
+func outputBase(name string) (string, error) {
+	clean := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	if clean == "" {
+		return "", fmt.Errorf("invalid entry name %q", name)
+	}
+	return clean, nil
+}
+
+// readEntry reads an archive member of at most limit bytes. The size in the
+// header is checked first, so that large members are not even decompressed.
+func readEntry(zf *zip.File, limit int64) ([]byte, error) {
+	tooLarge := fmt.Errorf("entry is larger than %d bytes", limit)
+	if zf.UncompressedSize64 > uint64(limit) {
+		return nil, tooLarge
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, tooLarge
+	}
+	return data, nil
+}
+
+// writeImage renders the canvas to a PNG file, creating parent directories.
+func writeImage(ctx context.Context, path string, c *canvas.Canvas, scale float64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := convert.Encode(ctx, file, c, "png", convert.EncodeOptions{Scale: scale}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// decodeText converts CP437 text such as FILE_ID.DIZ to UTF-8.
+func decodeText(data []byte) string {
+	if i := bytes.IndexByte(data, 0x1a); i >= 0 {
+		data = data[:i] // Drop any SAUCE record.
+	}
+	text, err := charmap.CodePage437.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return strings.TrimRight(strings.ReplaceAll(string(text), "\r\n", "\n"), "\n")
+}
+
+// trimField strips the space and NUL padding of SAUCE string fields.
+func trimField(s string) string {
+	return strings.TrimRight(s, " \x00")
+}
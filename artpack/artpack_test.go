@@ -0,0 +1,129 @@
+package artpack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type member struct {
+	name string
+	data []byte
+}
+
+// buildZip creates an in-memory archive with the given members.
+func buildZip(t *testing.T, members []member) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		w, err := zw.Create(m.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(m.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestProcess(t *testing.T) {
+	const limit = 1 << 10
+	zr := buildZip(t, []member{
+		{name: "FILE_ID.DIZ", data: []byte("Test pack\r\n\xb0\xb1\xb2\r\n")},
+		{name: "art/one.ans", data: []byte("\x1b[31mONE\x1b[0m")},
+		{name: "../escape.ans", data: []byte("\x1b[32mTWO")},
+		{name: "colors.asc", data: []byte("\x1b[1;33mYELLOW\x1b[0m")},
+		{name: "plain.nfo", data: []byte("just text\r\n")},
+		{name: "readme.doc", data: []byte("not art")},
+		{name: "bomb.ans", data: bytes.Repeat([]byte{' '}, 2*limit)},
+	})
+	out := t.TempDir()
+	index, err := Process(context.Background(), zr, "pack.zip", Options{OutDir: out, MaxEntrySize: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.Description != "Test pack\n░▒▓" {
+		t.Errorf("Description = %q", index.Description)
+	}
+
+	entries := map[string]Entry{}
+	for _, e := range index.Entries {
+		entries[e.Name] = e
+	}
+	if len(entries) != 5 {
+		t.Errorf("got %d entries, want 5: %+v", len(entries), index.Entries)
+	}
+	for _, name := range []string{"art/one.ans", "../escape.ans"} {
+		e := entries[name]
+		if e.Error != "" || e.Format != "ansi" {
+			t.Errorf("%s: %+v", name, e)
+			continue
+		}
+		for _, file := range []string{e.Image, e.Thumbnail} {
+			if strings.Contains(file, "..") {
+				t.Errorf("%s: output %q escapes the output directory", name, file)
+			}
+			if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(file))); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	if e := entries["art/one.ans"]; e.Columns != 3 || e.Rows != 1 {
+		t.Errorf("art/one.ans is %dx%d, want 3x1", e.Columns, e.Rows)
+	}
+	// Text extensions don't force the plain format over the content.
+	if e := entries["colors.asc"]; e.Format != "ansi" || e.Columns != 6 {
+		t.Errorf("colors.asc: %+v, want 6 columns of ansi", e)
+	}
+	if e := entries["plain.nfo"]; e.Format != "plain" {
+		t.Errorf("plain.nfo: format %q, want plain", e.Format)
+	}
+	if e := entries["bomb.ans"]; !strings.Contains(e.Error, "larger than") {
+		t.Errorf("bomb.ans: error = %q, want a size error", e.Error)
+	}
+
+	if err := index.Save(out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Index
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved.Entries) != len(index.Entries) {
+		t.Errorf("index.json does not round-trip: %v", err)
+	}
+}
+
+func TestOutputBase(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"art.ans", "art.ans", false},
+		{"dir/art.ans", "dir/art.ans", false},
+		{"../../art.ans", "art.ans", false},
+		{`dir\..\..\art.ans`, "art.ans", false},
+		{"/abs/art.ans", "abs/art.ans", false},
+		{"/", "", true},
+	}
+	for _, tt := range tests {
+		got, err := outputBase(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("outputBase(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
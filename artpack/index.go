@@ -0,0 +1,75 @@
+package artpack
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// contactSheet is the HTML template for the artpack overview page.
+var contactSheet = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Archive}}</title>
+<style>
+body { background: #111; color: #ccc; font-family: monospace; margin: 2em; }
+pre.diz { color: #aaa; }
+.grid { display: flex; flex-wrap: wrap; gap: 1.5em; }
+.entry { width: 340px; }
+.entry img { max-width: 320px; image-rendering: pixelated; border: 1px solid #333; }
+.entry .meta { font-size: 0.85em; margin-top: 0.3em; }
+.entry .error { color: #f55; }
+a { color: #5cf; }
+</style>
+</head>
+<body>
+<h1>{{.Archive}}</h1>
+{{if .Description}}<pre class="diz">{{.Description}}</pre>{{end}}
+<div class="grid">
+{{range .Entries}}<div class="entry">
+{{if .Error}}<div>{{.Name}}</div><div class="error">{{.Error}}</div>
+{{else}}<a href="{{.Image}}"><img src="{{.Thumbnail}}" alt="{{.Name}}"></a>
+<div class="meta"><a href="{{.Image}}">{{.Name}}</a> ({{.Format}}, {{.Columns}}x{{.Rows}})<br>
+{{if .Title}}{{.Title}}{{end}}{{if .Author}} by {{.Author}}{{end}}{{if .Group}} / {{.Group}}{{end}}</div>
+{{end}}</div>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// WriteJSON writes the index as indented JSON.
+func (ix *Index) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ix)
+}
+
+// WriteHTML writes a contact sheet of all thumbnails, each linking to the
+// full-size rendering.
+func (ix *Index) WriteHTML(w io.Writer) error {
+	return contactSheet.Execute(w, ix)
+}
+
+// Save writes index.json and index.html into dir.
+func (ix *Index) Save(dir string) error {
+	for name, write := range map[string]func(io.Writer) error{
+		"index.json": ix.WriteJSON,
+		"index.html": ix.WriteHTML,
+	} {
+		file, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if err := write(file); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package avatar
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newCanvas(lines ...string) *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	for i, line := range lines {
+		if i > 0 {
+			c.NewLine()
+		}
+		for j, r := range line {
+			c.Put(canvas.Cell{Char: r, Fg: ansi.PCPalette[j%16], Bg: ansi.PCPalette[(j/3)%16]})
+		}
+	}
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := newCanvas(
+		"Hello, world! ░░░░░░▒▒▓▓████",
+		"",
+		"    indented      and spaced",
+		// Glyphs stored as control codes: ◙ ♪ → ♀ ▬ ↓.
+		"◙♪→♀▬↓ ◙◙◙◙◙◙",
+	)
+	var out bytes.Buffer
+	if err := NewWriter(c, &out).Write(); err != nil {
+		t.Fatal(err)
+	}
+	got := canvas.NewCanvas(80)
+	if err := NewParser(got, &out).Parse(); err != nil {
+		t.Fatal(err)
+	}
+	_, maxRow, _, _ := c.GetContentBounds()
+	for r := 0; r <= maxRow; r++ {
+		for col, want := range c.Grid[r] {
+			if g := got.Grid[r][col]; g.Char != want.Char || want.Char != ' ' && (g.Fg != want.Fg || g.Bg != want.Bg) {
+				t.Fatalf("cell %d,%d = %q %v on %v, want %q %v on %v", r, col, g.Char, g.Fg, g.Bg, want.Char, want.Fg, want.Bg)
+			}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	grey := "\x16\x01\x07"
+	tests := []struct {
+		name string
+		c    *canvas.Canvas
+		want string
+	}{
+		{"text", textCanvas("ab"), grey + "ab\r\n"},
+		{"run", textCanvas("xxxxx"), grey + "\x19x\x05\r\n"},
+		{"short run", textCanvas("xxx"), grey + "xxx\r\n"},
+		{"control glyphs", textCanvas("a◙♪→♀▬↓"), grey + "a\x19\x0a\x01\x19\x0d\x01\x19\x1a\x01\x19\x0c\x01\x19\x16\x01\x19\x19\x01\r\n"},
+		{"blink", blinkCanvas(), "\x16\x01\x17\x16\x02b\r\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := NewWriter(tt.c, &out).Write(); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func textCanvas(s string) *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	for _, r := range s {
+		c.Put(canvas.Cell{Char: r, Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+	}
+	return c
+}
+
+func blinkCanvas() *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	c.Put(canvas.Cell{Char: 'b', Fg: ansi.PCPalette[7], Bg: ansi.PCPalette[9]})
+	return c
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		attr byte // Of the cell before the cursor.
+	}{
+		{"attribute", "\x16\x01\x1fhi", "hi", 0x1f},
+		{"blink", "\x16\x01\x1f\x16\x02x", "x", 0x9f},
+		{"repeat", "\x19z\x04", "zzzz", 0x07},
+		{"repeat control glyph", "\x19\x0a\x02", "◙◙", 0x07},
+		{"clear", "ab\x0cc", "c", defaultAttribute},
+		{"goto", "\x16\x08\x01\x05x", "    x", 0x07},
+		{"cursor right and left", "a\x16\x06\x16\x06b\x16\x05\x16\x05c", "a cb", 0x07},
+		{"clear to end of line", "abcd\x16\x05\x16\x05\x16\x07", "ab", 0x07},
+		{"truncated command", "ab\x16\x01", "ab", 0x07},
+		{"truncated repeat", "ab\x19z", "ab", 0x07},
+		{"sauce", "ab\x1acd", "ab", 0x07},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		if err := NewParser(c, strings.NewReader(tt.in)).Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []rune
+		for _, cell := range c.Grid[0] {
+			got = append(got, cell.Char)
+		}
+		if s := strings.TrimRight(string(got), " "); s != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, s, tt.want)
+		}
+		cell := c.Grid[0][len([]rune(tt.want))-1]
+		if cell.Fg != ansi.PCPalette[tt.attr&0x0F] || cell.Bg != ansi.PCPalette[tt.attr>>4] {
+			t.Errorf("%s: colors %v on %v, want attribute %02x", tt.name, cell.Fg, cell.Bg, tt.attr)
+		}
+	}
+}
+
+func TestWrapModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		wrap  canvas.WrapMode
+		want  []string
+	}{
+		{"pending full line", "abcd\r\nef", canvas.PendingWrap, []string{"abcd", "ef"}},
+		{"immediate full line", "abcd\r\nef", canvas.ImmediateWrap, []string{"abcd", "", "ef"}},
+		{"pending run to the edge", "\x19-\x04\r\nef", canvas.PendingWrap, []string{"----", "ef"}},
+		{"immediate run to the edge", "\x19-\x04\r\nef", canvas.ImmediateWrap, []string{"----", "", "ef"}},
+		{"run past the edge", "\x19-\x06\r\nef", canvas.PendingWrap, []string{"----", "--", "ef"}},
+		{"attribute after a full line", "abcd\x16\x01\x1f\r\nef", canvas.PendingWrap, []string{"abcd", "ef"}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(4)
+		c.Wrap = tt.wrap
+		if err := NewParser(c, strings.NewReader(tt.input)).Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, row := range c.Grid {
+			var line []rune
+			for _, cell := range row {
+				line = append(line, cell.Char)
+			}
+			got = append(got, strings.TrimRight(string(line), " "))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want int
+	}{
+		{"attributes", "\x16\x01\x1fa\x16\x01\x07b", 2},
+		{"attributes and repeats", "\x16\x01\x1f\x19a\x05\x19b\x09", 3},
+		{"repeats alone", "\x19a\x05\x19b\x09\x19c\x0a", 0},
+		{"binary data", strings.Repeat("\x19\x19\x19\x19", 100), 0},
+		{"repeat of one", "\x16\x01\x1f\x19a\x01", 1},
+		{"text", "hello world", 0},
+	}
+	for _, tt := range tests {
+		if got := Detect([]byte(tt.head)); got != tt.want {
+			t.Errorf("%s: Detect = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"clean", "\x16\x01\x1fab\x19c\x03\x16\x08\x02\x01\x0c", nil},
+		{"truncated command", "ab\x16", []string{"1:3 (byte 2): error: truncated command at end of input"}},
+		{"truncated argument", "ab\x16\x01", []string{"1:3 (byte 2): error: truncated command at end of input"}},
+		{"truncated repeat", "\x19a", []string{"1:1 (byte 0): error: truncated command at end of input"}},
+		{"unsupported command", "a\x16\x0ab", []string{"1:2 (byte 1): warning: unsupported command ^V 0x0a"}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		p := NewParser(c, strings.NewReader(tt.input))
+		p.Diagnostics = &diag.Collector{}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package avatar reads and writes Avatar/0 (.avt) files, the FidoNet
+// terminal emulation that drives the screen with ^V commands and compresses
+// runs of a character with ^Y.
+package avatar
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/diag"
+	"a2m2a/internal/stream"
+	"fmt"
+	"io"
+)
+
+// Control codes.
+const (
+	ctrlClear   = 0x0C // ^L: clear the screen.
+	ctrlCommand = 0x16 // ^V: introduces a command.
+	ctrlRepeat  = 0x19 // ^Y <char> <count>: repeat a character.
+)
+
+// Commands following ^V.
+const (
+	cmdAttribute = 0x01 // <attr>
+	cmdBlink     = 0x02
+	cmdUp        = 0x03
+	cmdDown      = 0x04
+	cmdLeft      = 0x05
+	cmdRight     = 0x06
+	cmdClearEOL  = 0x07
+	cmdGoto      = 0x08 // <row> <col>
+)
+
+// defaultAttribute is cyan on black, which ^L resets to.
+const defaultAttribute = 0x03
+
+// Detect counts the ^V^A attribute and ^Y repeat sequences in head. ^Y is a
+// common byte in binary data, so repeats only count alongside at least one
+// attribute command.
+func Detect(head []byte) int {
+	attrs, repeats := 0, 0
+	for i := 0; i+2 < len(head); i++ {
+		switch {
+		case head[i] == ctrlCommand && head[i+1] == cmdAttribute:
+			attrs++
+			i += 2
+		case head[i] == ctrlRepeat && head[i+2] > 1:
+			repeats++
+			i += 2
+		}
+	}
+	if attrs == 0 {
+		return 0
+	}
+	return attrs + repeats
+}
+
+// Parser holds the state for parsing an Avatar stream.
+type Parser struct {
+	canvas *canvas.Canvas
+	reader *stream.Reader
+	attr   byte
+
+	// Diagnostics, if not nil, collects the truncated and unsupported
+	// commands found.
+	Diagnostics *diag.Collector
+	// seqStart is the offset of the command being parsed.
+	seqStart int64
+}
+
+// NewParser creates a new Avatar parser.
+func NewParser(c *canvas.Canvas, r io.Reader) *Parser {
+	return &Parser{
+		canvas: c,
+		reader: stream.NewReader(r),
+		attr:   0x07,
+	}
+}
+
+// Parse reads the Avatar stream and updates the canvas. A truncated command
+// at the end of the stream is reported and otherwise ignored.
+func (p *Parser) Parse() error {
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		p.seqStart = p.reader.Offset() - 1
+		switch b {
+		case ctrlCommand:
+			if err := p.handleCommand(); err != nil {
+				return p.truncated(err)
+			}
+		case ctrlRepeat:
+			args, err := p.reader.ReadN(2)
+			if err != nil {
+				return p.truncated(err)
+			}
+			for i := 0; i < int(args[1]); i++ {
+				p.put(args[0])
+			}
+		case ctrlClear:
+			p.attr = defaultAttribute
+			p.canvas.Clear(p.cell(' '))
+		case '\n':
+			p.canvas.NewLine()
+		case '\r':
+			p.canvas.Cursor.Col = 0
+		case '\x1a': // SAUCE separator.
+			return nil
+		default:
+			p.put(b)
+		}
+	}
+}
+
+func (p *Parser) handleCommand() error {
+	cmd, err := p.reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	cur := p.canvas.Cursor
+	switch cmd {
+	case cmdAttribute:
+		args, err := p.reader.ReadN(1)
+		if err != nil {
+			return err
+		}
+		p.attr = args[0]
+	case cmdBlink:
+		p.attr |= 0x80
+	case cmdUp:
+		p.canvas.MoveUp(1)
+	case cmdDown:
+		p.canvas.MoveDown(1)
+	case cmdLeft:
+		p.canvas.MoveBackward(1)
+	case cmdRight:
+		p.canvas.MoveForward(1)
+	case cmdClearEOL:
+		if cur.Row < len(p.canvas.Grid) {
+			row := p.canvas.Grid[cur.Row]
+			for col := cur.Col; col < len(row); col++ {
+				row[col] = p.cell(' ')
+			}
+		}
+	case cmdGoto:
+		args, err := p.reader.ReadN(2)
+		if err != nil {
+			return err
+		}
+		p.canvas.SetCursor(int(args[0])-1, int(args[1])-1)
+	default:
+		p.report(diag.Warning, "unsupported command ^V 0x%02x", cmd)
+	}
+	return nil
+}
+
+// truncated reports a command cut off by the end of the input, which ends
+// the parse without an error. Other read errors are returned.
+func (p *Parser) truncated(err error) error {
+	if !stream.IsEOF(err) {
+		return err
+	}
+	p.report(diag.Error, "truncated command at end of input")
+	return nil
+}
+
+// report records a diagnostic for the command being parsed, at the cursor.
+func (p *Parser) report(sev diag.Severity, format string, args ...any) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   p.seqStart,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// put draws a CP437 byte. Control bytes that are not commands, and the
+// characters of ^Y runs, show as their pictographs.
+func (p *Parser) put(b byte) {
+	p.canvas.Put(p.cell(cp437.Decode(b)))
+}
+
+// cell builds a canvas cell from the current attribute. The blink bit shows
+// as a bright background, like iCE colors.
+func (p *Parser) cell(r rune) canvas.Cell {
+	fg, bg := int(p.attr&0x0F), int(p.attr>>4)
+	return canvas.Cell{
+		Char:   r,
+		Fg:     ansi.PCPalette[fg],
+		Bg:     ansi.PCPalette[bg],
+		Bright: fg >= 8,
+		Ice:    bg >= 8,
+	}
+}
+
+// isCommand reports whether b is read as a control code rather than drawn.
+func isCommand(b byte) bool {
+	switch b {
+	case ctrlClear, ctrlCommand, ctrlRepeat, '\n', '\r', '\x1a':
+		return true
+	}
+	return false
+}
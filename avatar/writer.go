@@ -0,0 +1,84 @@
+package avatar
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/palette"
+	"bufio"
+	"io"
+)
+
+// minRepeat is the shortest run worth a three-byte ^Y sequence.
+const minRepeat = 4
+
+// Writer converts a canvas to Avatar/0.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+}
+
+// NewWriter creates a new Avatar writer.
+func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+	}
+}
+
+// Write generates the Avatar output. Colors are snapped to the 16 PC colors,
+// runs of a character are compressed, and lines end in CR LF. Glyphs whose
+// CP437 byte is a control code are written as one-character ^Y repeats,
+// whose argument is always drawn.
+func (w *Writer) Write() error {
+	bw := bufio.NewWriter(w.writer)
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	attr := -1
+
+	for r := 0; r <= maxRow; r++ {
+		row := w.canvas.Grid[r]
+		lastCharIndex := -1
+		for i := len(row) - 1; i >= 0; i-- {
+			if row[i].Char != ' ' || row[i].Bg != canvas.DefaultBg {
+				lastCharIndex = i
+				break
+			}
+		}
+
+		for i := 0; i <= lastCharIndex; {
+			cellAttr := attribute(row[i])
+			if cellAttr != attr {
+				// ^V^A can't set the blink bit; ^V^B adds it.
+				bw.Write([]byte{ctrlCommand, cmdAttribute, byte(cellAttr & 0x7F)})
+				if cellAttr&0x80 != 0 {
+					bw.Write([]byte{ctrlCommand, cmdBlink})
+				}
+				attr = cellAttr
+			}
+			ch, ok := cp437.Encode(row[i].Char)
+			if !ok {
+				ch = '?'
+			}
+
+			run := 1
+			for i+run <= lastCharIndex && run < 255 && row[i+run].Char == row[i].Char && attribute(row[i+run]) == attr {
+				run++
+			}
+			if run >= minRepeat || isCommand(ch) {
+				bw.Write([]byte{ctrlRepeat, ch, byte(run)})
+			} else {
+				for j := 0; j < run; j++ {
+					bw.WriteByte(ch)
+				}
+			}
+			i += run
+		}
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+// attribute returns the PC text attribute closest to a cell's colors.
+func attribute(cell canvas.Cell) int {
+	return palette.Nearest(ansi.PCPalette, cell.Bg)<<4 | palette.Nearest(ansi.PCPalette, cell.Fg)
+}
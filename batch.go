@@ -0,0 +1,272 @@
+package main
+
+import (
+	"a2m2a/convert"
+	"a2m2a/sauce"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// thumbTarget is the pseudo output format for thumbnails in batch mode.
+const thumbTarget = "thumb"
+
+// batchJob is a single input file and its path relative to the output root.
+type batchJob struct {
+	inPath  string
+	relPath string
+}
+
+// batchResult records what happened to a single job.
+type batchResult struct {
+	job     batchJob
+	outputs []string
+	err     error
+}
+
+// batchConfig holds the settings shared by every job of a batch run.
+type batchConfig struct {
+	outDir     string
+	from       string
+	targets    []string // Format names, plus thumbTarget.
+	workers    int
+	decodeOpts convert.DecodeOptions
+	// inputs holds the absolute paths of every input of the run, which are
+	// never overwritten by an output.
+	inputs map[string]bool
+}
+
+// parseTargets validates a comma-separated list of output formats.
+func parseTargets(list string) ([]string, error) {
+	var targets []string
+	for _, t := range strings.Split(list, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if t != thumbTarget {
+			f, err := convert.Lookup(t)
+			if err != nil {
+				return nil, err
+			}
+			if f.Encoder == nil {
+				return nil, fmt.Errorf("format %q cannot be used as output", f.Name)
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// collectBatchJobs expands directories (recursively) and glob patterns into
+// the list of files to convert. Files found by walking a directory are only
+// included if their extension belongs to a readable format; files named
+// explicitly or matched by a glob are always included. A file reached by
+// more than one input is only listed once.
+func collectBatchJobs(inputs []string) ([]batchJob, error) {
+	var jobs []batchJob
+	seen := map[string]bool{}
+	add := func(job batchJob) {
+		if key := absPath(job.inPath); !seen[key] {
+			seen[key] = true
+			jobs = append(jobs, job)
+		}
+	}
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err == nil && info.IsDir() {
+			err := filepath.WalkDir(input, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					return nil
+				}
+				if f := convert.ForPath(path); f == nil || f.Decoder == nil || f.Image {
+					return nil
+				}
+				rel, err := filepath.Rel(input, path)
+				if err != nil {
+					return err
+				}
+				add(batchJob{inPath: path, relPath: rel})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", input)
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				add(batchJob{inPath: m, relPath: filepath.Base(m)})
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// runBatch converts every job with a bounded pool of workers. Failures are
+// reported as they happen and do not stop the run; a summary is printed at
+// the end and an error is returned if any file failed.
+func runBatch(ctx context.Context, jobs []batchJob, cfg batchConfig) error {
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+	if err := checkBatchOutputs(jobs, cfg.outDir); err != nil {
+		return err
+	}
+	cfg.inputs = inputSet(jobs)
+
+	results := make([]batchResult, len(jobs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < cfg.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				outputs, err := processBatchJob(ctx, jobs[i], cfg)
+				results[i] = batchResult{job: jobs[i], outputs: outputs, err: err}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", jobs[i].inPath, err)
+				} else {
+					fmt.Printf("ok   %s\n", jobs[i].inPath)
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	converted, outputs := 0, 0
+	var failed []batchResult
+	for _, r := range results {
+		if r.err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		converted++
+		outputs += len(r.outputs)
+	}
+
+	fmt.Printf("\nBatch summary: %d files, %d converted, %d failed, %d outputs written to %s\n",
+		len(jobs), converted, len(failed), outputs, cfg.outDir)
+	for _, r := range failed {
+		fmt.Printf("  failed: %s: %v\n", r.job.inPath, r.err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed", len(failed), len(jobs))
+	}
+	return nil
+}
+
+// checkBatchOutputs fails if two jobs would write the same outputs, e.g.
+// same-named files matched by globs in different directories, or art.ans and
+// art.mrc side by side.
+func checkBatchOutputs(jobs []batchJob, outDir string) error {
+	seen := map[string]string{}
+	for _, job := range jobs {
+		base := absPath(outputBase(outDir, job))
+		if prev, ok := seen[base]; ok {
+			return fmt.Errorf("%s and %s would be written to the same output %s.*; convert them separately", prev, job.inPath, base)
+		}
+		seen[base] = job.inPath
+	}
+	return nil
+}
+
+// inputSet returns the absolute paths of the inputs of jobs, which outputs
+// must not replace.
+func inputSet(jobs []batchJob) map[string]bool {
+	inputs := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		inputs[absPath(job.inPath)] = true
+	}
+	return inputs
+}
+
+// outputBase is the output path of a job without the extension.
+func outputBase(outDir string, job batchJob) string {
+	return filepath.Join(outDir, strings.TrimSuffix(job.relPath, filepath.Ext(job.relPath)))
+}
+
+// absPath makes a path absolute for comparison, falling back to the cleaned
+// path.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// processBatchJob parses a single file and writes every target for it.
+func processBatchJob(ctx context.Context, job batchJob, cfg batchConfig) ([]string, error) {
+	file, err := os.Open(job.inPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	opts := cfg.decodeOpts
+	opts.Sauce, _ = sauce.Get(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	c, inFormat, err := convert.Decode(ctx, file, convert.InputFormat(cfg.from, job.inPath), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := cfg.targets
+	if len(targets) == 0 {
+		targets = []string{defaultOutputFormat(inFormat).Name}
+	}
+
+	base := outputBase(cfg.outDir, job)
+	if err := os.MkdirAll(filepath.Dir(base), 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, t := range targets {
+		name, path, encodeOpts := t, "", convert.EncodeOptions{}
+		if t == thumbTarget {
+			name, path, encodeOpts.Scale = "png", base+"_thumb.png", 0.5
+		}
+		f, err := convert.Lookup(name)
+		if err != nil {
+			return written, err
+		}
+		if path == "" {
+			path = base + "." + f.Name
+			if len(f.Extensions) > 0 {
+				path = base + f.Extensions[0]
+			}
+		}
+		if abs := absPath(path); abs == absPath(job.inPath) || cfg.inputs[abs] {
+			return written, fmt.Errorf("%s: refusing to overwrite an input file", path)
+		}
+		if err := writeFile(ctx, path, c, f, encodeOpts); err != nil {
+			return written, fmt.Errorf("%s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates files with the given contents under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCollectBatchJobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"in/a.ans":       "\x1b[31ma",
+		"in/sub/b.mrc":   "\x034b",
+		"in/photo.png":   "",
+		"in/notes.xyz":   "",
+		"other/c.ans":    "\x1b[31mc",
+		"other/skip.xyz": "",
+	})
+	in := filepath.Join(dir, "in")
+	jobs, err := collectBatchJobs([]string{
+		in,
+		filepath.Join(dir, "other", "*.ans"),
+		filepath.Join(in, "a.ans"), // Already found by walking in.
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, job := range jobs {
+		got[job.relPath] = job.inPath
+	}
+	want := map[string]string{
+		"a.ans":                       filepath.Join(in, "a.ans"),
+		filepath.Join("sub", "b.mrc"): filepath.Join(in, "sub", "b.mrc"),
+		"c.ans":                       filepath.Join(dir, "other", "c.ans"),
+	}
+	if len(got) != len(want) || len(jobs) != len(want) {
+		t.Fatalf("jobs = %v, want %v", jobs, want)
+	}
+	for rel, path := range want {
+		if got[rel] != path {
+			t.Errorf("job %s = %q, want %q", rel, got[rel], path)
+		}
+	}
+
+	if _, err := collectBatchJobs([]string{filepath.Join(dir, "*.none")}); err == nil {
+		t.Error("a pattern matching nothing is not an error")
+	}
+}
+
+func TestCheckBatchOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    []batchJob
+		wantErr bool
+	}{
+		{
+			name: "distinct",
+			jobs: []batchJob{{"a/x.ans", "x.ans"}, {"a/y.ans", "y.ans"}, {"a/sub/x.ans", "sub/x.ans"}},
+		},
+		{
+			name:    "same name from two directories",
+			jobs:    []batchJob{{"a/x.ans", "x.ans"}, {"b/x.ans", "x.ans"}},
+			wantErr: true,
+		},
+		{
+			name:    "same base name, different extensions",
+			jobs:    []batchJob{{"a/x.ans", "x.ans"}, {"a/x.mrc", "x.mrc"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		err := checkBatchOutputs(tt.jobs, "out")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"in/a.ans":     "\x1b[31mred\x1b[0m",
+		"in/sub/b.mrc": "\x034red",
+	})
+	jobs, err := collectBatchJobs([]string{filepath.Join(dir, "in")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	cfg := batchConfig{outDir: out, targets: []string{"plain", "ansi"}, workers: 2}
+	if err := runBatch(context.Background(), jobs, cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "a.ans", "sub/b.txt", "sub/b.ans"} {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Errorf("missing output %s: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), "red") {
+			t.Errorf("output %s = %q, want the art", name, data)
+		}
+	}
+}
+
+func TestRunBatchKeepsInputs(t *testing.T) {
+	dir := t.TempDir()
+	const art = "\x1b[31mred\x1b[0m"
+	writeFiles(t, dir, map[string]string{"a.ans": art})
+	jobs, err := collectBatchJobs([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writing ANSI next to the input would replace it.
+	cfg := batchConfig{outDir: dir, targets: []string{"ansi"}}
+	if err := runBatch(context.Background(), jobs, cfg); err == nil {
+		t.Error("overwriting an input is not an error")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.ans")); string(data) != art {
+		t.Errorf("input was changed to %q", data)
+	}
+}
@@ -0,0 +1,235 @@
+package bbs
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// line is a run of text in PC attribute colors.
+type line struct {
+	text   string
+	fg, bg int
+}
+
+func newCanvas(runs ...line) *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	for _, run := range runs {
+		for _, r := range run.text {
+			if r == '\n' {
+				c.NewLine()
+				continue
+			}
+			c.Put(canvas.Cell{Char: r, Fg: ansi.PCPalette[run.fg], Bg: ansi.PCPalette[run.bg]})
+		}
+	}
+	return c
+}
+
+func text(c *canvas.Canvas) string {
+	var b strings.Builder
+	_, maxRow, _, _ := c.GetContentBounds()
+	for r := 0; r <= maxRow; r++ {
+		row := c.Grid[r]
+		end := len(row)
+		for end > 0 && row[end-1].Char == ' ' {
+			end--
+		}
+		for _, cell := range row[:end] {
+			b.WriteRune(cell.Char)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tricky := []line{
+		{"plain ", 7, 0},
+		{"@X1F @1F@ @CLS@ @pos:3@ |12 |CL |b |S |", 14, 1},
+		{"a@", 7, 0},
+		{"X1F", 12, 4},
+		{"|", 15, 0},
+		{"07 mail@example.com a|b\n", 3, 0},
+		{"bright bg", 0, 7},
+		{" @", 2, 0},
+	}
+	for _, d := range Dialects {
+		c := newCanvas(tricky...)
+		var out bytes.Buffer
+		if err := NewWriter(c, &out, d).Write(); err != nil {
+			t.Fatal(err)
+		}
+		got := canvas.NewCanvas(80)
+		if err := NewParser(got, &out, d).Parse(); err != nil {
+			t.Fatal(err)
+		}
+		if text(got) != text(c) {
+			t.Errorf("%s: text\n%q\nwant\n%q", d, text(got), text(c))
+			continue
+		}
+		for r := 0; r < 2; r++ {
+			for col, want := range c.Grid[r] {
+				if g := got.Grid[r][col]; want.Char != ' ' && (g.Fg != want.Fg || g.Bg != want.Bg) {
+					t.Errorf("%s: cell %d,%d %q has colors %v on %v, want %v on %v", d, r, col, want.Char, g.Fg, g.Bg, want.Fg, want.Bg)
+				}
+			}
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		runs    []line
+		want    string
+	}{
+		{PCBoard, []line{{"a", 15, 1}, {"b", 14, 1}}, "@X1Fa@X1Eb\r\n"},
+		{Wildcat, []line{{"a", 15, 1}}, "@1F@a\r\n"},
+		{Pipe, []line{{"a", 15, 1}, {"b", 14, 1}}, "|15|17a|14b\r\n"},
+		{Celerity, []line{{"a", 15, 1}, {"b", 14, 1}}, "|S|b|S|Wa|Yb\r\n"},
+		// Escapes only where the next byte would continue a code.
+		{PCBoard, []line{{"@X @ x@", 7, 0}}, "@X07@@X07X @ x@\r\n"},
+		{Wildcat, []line{{"@1@ @", 7, 0}}, "@07@@@07@1@ @\r\n"},
+		{Pipe, []line{{"|1|x", 7, 0}}, "|07|16||07|161|x\r\n"},
+		{Celerity, []line{{"|b|1", 7, 0}}, "|S|k|S|w||S|k|S|wb|1\r\n"},
+		// A color change after the introducer is escape enough.
+		{PCBoard, []line{{"@", 7, 0}, {"X1F", 15, 0}}, "@X07@@X0FX1F\r\n"},
+		// Line breaks and the end of file marker can't be written.
+		{PCBoard, []line{{"◙♪→♫", 7, 0}}, "@X07???\x0e\r\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := NewWriter(newCanvas(tt.runs...), &out, tt.dialect).Write(); err != nil {
+			t.Fatal(err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s %v: got %q, want %q", tt.dialect, tt.runs, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		in      string
+		want    string
+		wantFg  int
+		wantBg  int
+	}{
+		{PCBoard, "@X1Fhi", "hi\n", 15, 1},
+		{PCBoard, "@x4eh", "h\n", 14, 4},
+		{PCBoard, "ab@CLS@c", "c\n", 7, 0},
+		{PCBoard, "a@POS:5@b", "a   b\n", 7, 0},
+		{PCBoard, "@XZZ@", "@XZZ@\n", 7, 0},
+		{Wildcat, "@1F@hi", "hi\n", 15, 1},
+		{Wildcat, "@1F x", "@1F x\n", 7, 0},
+		{Pipe, "|15|17hi", "hi\n", 15, 1},
+		{Pipe, "|32x", "|32x\n", 7, 0},
+		{Pipe, "ab|CLc", "c\n", 7, 0},
+		{Celerity, "|S|b|S|Whi", "hi\n", 15, 1},
+		{Celerity, "|x|", "|x|\n", 7, 0},
+		{PCBoard, "a\r\nb\x1ac", "a\nb\n", 7, 0},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		if err := NewParser(c, strings.NewReader(tt.in), tt.dialect).Parse(); err != nil {
+			t.Fatal(err)
+		}
+		if got := text(c); got != tt.want {
+			t.Errorf("%s %q: text %q, want %q", tt.dialect, tt.in, got, tt.want)
+		}
+		last := c.Grid[c.Cursor.Row][max(0, c.Cursor.Col-1)]
+		if last.Fg != ansi.PCPalette[tt.wantFg] || last.Bg != ansi.PCPalette[tt.wantBg] {
+			t.Errorf("%s %q: colors %v on %v, want %d on %d", tt.dialect, tt.in, last.Fg, last.Bg, tt.wantFg, tt.wantBg)
+		}
+	}
+}
+
+func TestWrapModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		wrap  canvas.WrapMode
+		want  string
+	}{
+		{"pending full line", "@X1Fabcd\r\nef", canvas.PendingWrap, "abcd\nef\n"},
+		{"immediate full line", "@X1Fabcd\r\nef", canvas.ImmediateWrap, "abcd\n\nef\n"},
+		{"pending long line", "abcdef\r\ng", canvas.PendingWrap, "abcd\nef\ng\n"},
+		{"immediate long line", "abcdef\r\ng", canvas.ImmediateWrap, "abcd\nef\ng\n"},
+		{"color code after a full line", "abcd@X2E\r\nef", canvas.PendingWrap, "abcd\nef\n"},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(4)
+		c.Wrap = tt.wrap
+		if err := NewParser(c, strings.NewReader(tt.input), PCBoard).Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := text(c); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	art := func(code string) []byte {
+		return []byte(strings.Repeat(code+"██▓▒░ ", 20))
+	}
+	tests := []struct {
+		name    string
+		head    []byte
+		dialect Dialect
+		want    bool
+	}{
+		{"pcboard", art("@X1F"), PCBoard, true},
+		{"wildcat", art("@1F@"), Wildcat, true},
+		{"pipe", art("|12"), Pipe, true},
+		{"celerity", art("|B"), Celerity, true},
+		{"pipe out of range", art("|45"), Pipe, false},
+		{"celerity S only", art("|S"), Celerity, false},
+		{"few pipes", []byte("a|12b|13c"), Pipe, false},
+		{"shell pipeline", []byte("cat file |grep x | sort |wc -l\n" + strings.Repeat("plain text ", 100)), Celerity, false},
+		{"sparse pipes", []byte("|12 |13 |14 " + strings.Repeat("plain text ", 100)), Pipe, false},
+		{"single pcboard code", []byte("@X1Fhello"), PCBoard, true},
+	}
+	for _, tt := range tests {
+		if got := tt.dialect.Detect(tt.head) > 0; got != tt.want {
+			t.Errorf("%s: %s.Detect = %d, want a match %v", tt.name, tt.dialect, tt.dialect.Detect(tt.head), tt.want)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		input   string
+		want    []string
+	}{
+		{"clean", PCBoard, "@X1Fab@CLS@@POS:3@ x@y.com", nil},
+		{"malformed color code", PCBoard, "ab@XZZ", []string{"1:3 (byte 2): warning: malformed color code @XZZ"}},
+		{"truncated color code", PCBoard, "@X1", []string{"1:1 (byte 0): warning: malformed color code @X1"}},
+		{"malformed position", PCBoard, "@POS:x@", []string{"1:1 (byte 0): warning: malformed position code @POS:x@"}},
+		{"pipe out of range", Pipe, "a|07b|45", []string{"1:3 (byte 5): warning: pipe code |45 out of range"}},
+		{"pipe text", Pipe, "a | b |x", nil},
+		{"celerity text", Celerity, "|k| |!", nil},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		p := NewParser(c, strings.NewReader(tt.input), tt.dialect)
+		p.Diagnostics = &diag.Collector{}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
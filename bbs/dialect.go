@@ -0,0 +1,132 @@
+// Package bbs reads and writes the color code dialects BBS display files use
+// instead of ANSI escapes: PCBoard @X codes, Wildcat @..@ codes, Renegade and
+// Mystic pipe codes, and Celerity letter codes. Colors are PC attribute
+// colors (blue is 1, red is 4), indexing ansi.PCPalette.
+package bbs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect selects a color code family.
+type Dialect int
+
+const (
+	// PCBoard writes @X followed by the background and foreground as hex
+	// digits, e.g. @X1F for white on blue.
+	PCBoard Dialect = iota
+	// Wildcat writes the two hex digits between @ signs, e.g. @1F@.
+	Wildcat
+	// Pipe is the Renegade/Mystic family: |00-|15 set the foreground,
+	// |16-|23 the background and |24-|31 a blinking (iCE) background.
+	Pipe
+	// Celerity writes | and a letter: kbgcrmyw for the dark colors and
+	// KBGCRMYW for the bright ones. |S toggles whether letters set the
+	// foreground or the background.
+	Celerity
+)
+
+// Dialects lists every dialect, in the order formats are registered.
+var Dialects = []Dialect{PCBoard, Wildcat, Pipe, Celerity}
+
+// celerityColors are the Celerity color letters in PC color order.
+const celerityColors = "kbgcrmyw"
+
+// Pipe and Celerity codes ("|12", "|b") also turn up in ordinary text, so
+// Detect only counts them in files with at least minCodes codes and one code
+// per codeSpacing bytes.
+const (
+	minCodes    = 3
+	codeSpacing = 200
+)
+
+// String returns the dialect's format name.
+func (d Dialect) String() string {
+	switch d {
+	case PCBoard:
+		return "pcboard"
+	case Wildcat:
+		return "wildcat"
+	case Pipe:
+		return "pipe"
+	case Celerity:
+		return "celerity"
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// Detect counts the color codes of the dialect head contains.
+func (d Dialect) Detect(head []byte) int {
+	count := 0
+	for i := 0; i < len(head); i++ {
+		switch d {
+		case PCBoard:
+			if i+3 < len(head) && head[i] == '@' && (head[i+1] == 'X' || head[i+1] == 'x') && isHex(head[i+2]) && isHex(head[i+3]) {
+				count++
+			}
+		case Wildcat:
+			if i+3 < len(head) && head[i] == '@' && isHex(head[i+1]) && isHex(head[i+2]) && head[i+3] == '@' {
+				count++
+			}
+		case Pipe:
+			if i+2 < len(head) && head[i] == '|' && isDigit(head[i+1]) && isDigit(head[i+2]) && (head[i+1]-'0')*10+head[i+2]-'0' < 32 {
+				count++
+			}
+		case Celerity:
+			if i+1 < len(head) && head[i] == '|' && isCelerityColor(head[i+1]) {
+				count++
+			}
+		}
+	}
+	if (d == Pipe || d == Celerity) && (count < minCodes || count*codeSpacing < len(head)) {
+		return 0
+	}
+	return count
+}
+
+// introducer returns the byte that starts the dialect's codes.
+func (d Dialect) introducer() byte {
+	if d == Pipe || d == Celerity {
+		return '|'
+	}
+	return '@'
+}
+
+// continuesCode reports whether b, right after the code introducer, may be
+// read as part of a code, so that a literal introducer before it must be
+// escaped.
+func (d Dialect) continuesCode(b byte) bool {
+	switch d {
+	case PCBoard:
+		// @X codes and the @CLS@ and @POS:n@ macros.
+		return strings.IndexByte("XxCcPp", b) >= 0
+	case Wildcat:
+		return isHex(b)
+	case Pipe:
+		return isDigit(b) || b == 'C'
+	}
+	return isCelerityColor(b) || b == 'S'
+}
+
+func isCelerityColor(b byte) bool {
+	return b != 0 && strings.IndexByte(celerityColors+strings.ToUpper(celerityColors), b) >= 0
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isHex(b byte) bool {
+	return isDigit(b) || b >= 'A' && b <= 'F' || b >= 'a' && b <= 'f'
+}
+
+func hexValue(b byte) int {
+	switch {
+	case isDigit(b):
+		return int(b - '0')
+	case b >= 'a':
+		return int(b-'a') + 10
+	}
+	return int(b-'A') + 10
+}
@@ -0,0 +1,205 @@
+package bbs
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/internal/stream"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Parser holds the state for parsing a BBS display file.
+type Parser struct {
+	canvas  *canvas.Canvas
+	reader  *stream.Reader
+	dialect Dialect
+	// Current PC attribute colors.
+	fg, bg int
+	// celerityBg is set while Celerity letters select the background.
+	celerityBg bool
+
+	// Diagnostics, if not nil, collects the malformed codes found. They
+	// are drawn as text.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new parser for the given dialect.
+func NewParser(c *canvas.Canvas, r io.Reader, d Dialect) *Parser {
+	return &Parser{
+		canvas:  c,
+		reader:  stream.NewReader(r),
+		dialect: d,
+		fg:      7,
+		bg:      0,
+	}
+}
+
+// Parse reads the stream and updates the canvas.
+func (p *Parser) Parse() error {
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch b {
+		case '@':
+			if p.dialect == PCBoard || p.dialect == Wildcat {
+				if p.handleAt() {
+					continue
+				}
+			}
+		case '|':
+			if p.dialect == Pipe && p.handlePipe() || p.dialect == Celerity && p.handleCelerity() {
+				continue
+			}
+		case '\n':
+			p.canvas.NewLine()
+			continue
+		case '\r':
+			p.canvas.Cursor.Col = 0
+			continue
+		case '\x1a': // SAUCE separator.
+			return nil
+		}
+		p.canvas.Put(p.cell(charmap.CodePage437.DecodeByte(b)))
+	}
+}
+
+// cell builds a canvas cell from the current colors.
+func (p *Parser) cell(r rune) canvas.Cell {
+	return canvas.Cell{
+		Char:   r,
+		Fg:     ansi.PCPalette[p.fg],
+		Bg:     ansi.PCPalette[p.bg],
+		Bright: p.fg >= 8,
+		Ice:    p.bg >= 8,
+	}
+}
+
+// handleAt handles the PCBoard and Wildcat codes after an @. It reports
+// false, consuming nothing, if the @ does not start a code.
+func (p *Parser) handleAt() bool {
+	if p.dialect == Wildcat {
+		code := p.reader.Peek(3)
+		if len(code) == 3 && isHex(code[0]) && isHex(code[1]) && code[2] == '@' {
+			p.setAttribute(code[0], code[1])
+			p.reader.Discard(3)
+			return true
+		}
+		return false
+	}
+
+	code := p.reader.Peek(3)
+	if len(code) == 3 && (code[0] == 'X' || code[0] == 'x') && isHex(code[1]) && isHex(code[2]) {
+		p.setAttribute(code[1], code[2])
+		p.reader.Discard(3)
+		return true
+	}
+	if len(code) > 0 && code[0] == 'X' {
+		p.report("malformed color code @%s", code)
+		return false
+	}
+	// @CLS@ clears the screen and @POS:n@ moves to column n.
+	macro := p.reader.Peek(8)
+	end := bytes.IndexByte(macro, '@')
+	if end < 0 {
+		return false
+	}
+	name := strings.ToUpper(string(macro[:end]))
+	switch {
+	case name == "CLS":
+		p.canvas.Clear(p.cell(' '))
+	case strings.HasPrefix(name, "POS:"):
+		col, err := strconv.Atoi(name[4:])
+		if err != nil || col < 1 {
+			p.report("malformed position code @%s@", macro[:end])
+			return false
+		}
+		p.canvas.SetCursor(p.canvas.Cursor.Row, col-1)
+	default:
+		return false
+	}
+	p.reader.Discard(end + 1)
+	return true
+}
+
+// report records a warning for the code after the byte just read, at the
+// cursor.
+func (p *Parser) report(format string, args ...any) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   p.reader.Offset() - 1,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: diag.Warning,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// setAttribute applies a background and foreground hex digit pair.
+func (p *Parser) setAttribute(bg, fg byte) {
+	p.bg, p.fg = hexValue(bg), hexValue(fg)
+}
+
+// handlePipe handles |nn color codes and the |CL clear screen code.
+func (p *Parser) handlePipe() bool {
+	code := p.reader.Peek(2)
+	if len(code) < 2 {
+		return false
+	}
+	if string(code) == "CL" {
+		p.canvas.Clear(p.cell(' '))
+		p.reader.Discard(2)
+		return true
+	}
+	if !isDigit(code[0]) || !isDigit(code[1]) {
+		return false
+	}
+	switch n := int(code[0]-'0')*10 + int(code[1]-'0'); {
+	case n < 16:
+		p.fg = n
+	case n < 32:
+		p.bg = n - 16
+	default:
+		p.report("pipe code |%s out of range", code)
+		return false
+	}
+	p.reader.Discard(2)
+	return true
+}
+
+// handleCelerity handles | followed by a color letter or S.
+func (p *Parser) handleCelerity() bool {
+	code := p.reader.Peek(1)
+	if len(code) < 1 {
+		return false
+	}
+	if code[0] == 'S' {
+		p.celerityBg = !p.celerityBg
+		p.reader.Discard(1)
+		return true
+	}
+	color := strings.IndexByte(celerityColors, code[0])
+	if color < 0 {
+		if color = strings.IndexByte(strings.ToUpper(celerityColors), code[0]); color < 0 {
+			return false
+		}
+		color += 8
+	}
+	if p.celerityBg {
+		p.bg = color
+	} else {
+		p.fg = color
+	}
+	p.reader.Discard(1)
+	return true
+}
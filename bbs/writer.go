@@ -0,0 +1,132 @@
+package bbs
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/palette"
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writer converts a canvas to a BBS display file in CP437.
+type Writer struct {
+	canvas  *canvas.Canvas
+	writer  io.Writer
+	dialect Dialect
+}
+
+// NewWriter creates a new writer for the given dialect.
+func NewWriter(c *canvas.Canvas, w io.Writer, d Dialect) *Writer {
+	return &Writer{
+		canvas:  c,
+		writer:  w,
+		dialect: d,
+	}
+}
+
+// Write generates the output from the canvas. Colors are snapped to the 16
+// PC colors; lines end in CR LF as board software expects. A literal code
+// introducer (@ or |) that would run into a code is escaped by repeating the
+// current colors after it, and glyphs whose CP437 byte is a line break or
+// the end of file marker are written as '?'.
+func (w *Writer) Write() error {
+	bw := bufio.NewWriter(w.writer)
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	fg, bg := -1, -1
+	celerityBg := false
+
+	for r := 0; r <= maxRow; r++ {
+		row := w.canvas.Grid[r]
+		lastCharIndex := -1
+		for i := len(row) - 1; i >= 0; i-- {
+			if row[i].Char != ' ' || row[i].Bg != canvas.DefaultBg {
+				lastCharIndex = i
+				break
+			}
+		}
+
+		cells := make([]pcCell, lastCharIndex+1)
+		for i := range cells {
+			cells[i] = toPC(row[i])
+		}
+		for i, cell := range cells {
+			if cell.fg != fg || cell.bg != bg {
+				celerityBg = w.writeColors(bw, cell.fg, cell.bg, fg, bg, celerityBg)
+				fg, bg = cell.fg, cell.bg
+			}
+			bw.WriteByte(cell.b)
+			if cell.b == w.dialect.introducer() && i+1 < len(cells) {
+				next := cells[i+1]
+				if next.fg == fg && next.bg == bg && w.dialect.continuesCode(next.b) {
+					celerityBg = w.writeColors(bw, fg, bg, -1, -1, celerityBg)
+				}
+			}
+		}
+		bw.WriteString("\r\n")
+	}
+	return bw.Flush()
+}
+
+// pcCell is a cell as written: a CP437 byte in PC attribute colors.
+type pcCell struct {
+	b      byte
+	fg, bg int
+}
+
+func toPC(cell canvas.Cell) pcCell {
+	b, ok := cp437.Encode(cell.Char)
+	if !ok || b == '\n' || b == '\r' || b == '\x1a' {
+		b = '?'
+	}
+	return pcCell{
+		b:  b,
+		fg: palette.Nearest(ansi.PCPalette, cell.Fg),
+		bg: palette.Nearest(ansi.PCPalette, cell.Bg),
+	}
+}
+
+// writeColors emits the codes changing the colors from (prevFg, prevBg) to
+// (fg, bg). It returns the Celerity background mode after the codes.
+func (w *Writer) writeColors(bw *bufio.Writer, fg, bg, prevFg, prevBg int, celerityBg bool) bool {
+	switch w.dialect {
+	case PCBoard:
+		fmt.Fprintf(bw, "@X%X%X", bg, fg)
+	case Wildcat:
+		fmt.Fprintf(bw, "@%X%X@", bg, fg)
+	case Pipe:
+		if fg != prevFg {
+			fmt.Fprintf(bw, "|%02d", fg)
+		}
+		if bg != prevBg {
+			fmt.Fprintf(bw, "|%02d", 16+bg)
+		}
+	case Celerity:
+		// Set the background first, so the mode ends up on the foreground.
+		if bg != prevBg {
+			if !celerityBg {
+				bw.WriteString("|S")
+			}
+			bw.WriteString("|" + celerityLetter(bg))
+			celerityBg = true
+		}
+		if fg != prevFg {
+			if celerityBg {
+				bw.WriteString("|S")
+				celerityBg = false
+			}
+			bw.WriteString("|" + celerityLetter(fg))
+		}
+	}
+	return celerityBg
+}
+
+func celerityLetter(color int) string {
+	letter := celerityColors[color%8 : color%8+1]
+	if color >= 8 {
+		return strings.ToUpper(letter)
+	}
+	return letter
+}
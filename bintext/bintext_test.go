@@ -0,0 +1,126 @@
+package bintext
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// art builds BinaryText data of rows x width cells whose attributes mostly
+// repeat the row above, as in real art: only an edge moving across the rows
+// changes.
+func art(width, rows int) []byte {
+	var data []byte
+	for r := 0; r < rows; r++ {
+		for col := 0; col < width; col++ {
+			attr := byte(col%16) << 4
+			if col < 3*r {
+				attr |= 0x0F
+			}
+			data = append(data, byte('A'+(r+col)%26), attr)
+		}
+	}
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, width := range []int{80, 160} {
+		data := art(width, 4)
+		c, err := NewParser(bytes.NewReader(data), width, true).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := NewWriter(c, &out).Write(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Errorf("width %d: round trip changed the data", width)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	attrs := xbin.Attributes{Palette: ansi.PCPalette}
+	tests := []struct {
+		name  string
+		data  []byte
+		width int
+		ice   bool
+		want  []canvas.Cell
+	}{
+		{"cells", []byte{'a', 0x1F, 'b', 0x4E}, 2, false, []canvas.Cell{attrs.Cell('a', 0x1F), attrs.Cell('b', 0x4E)}},
+		{"odd byte dropped", []byte{'a', 0x07, 'b'}, 2, false, []canvas.Cell{attrs.Cell('a', 0x07)}},
+		{"blink", []byte{'a', 0x9F}, 1, false, []canvas.Cell{{Char: 'a', Fg: ansi.PCPalette[15], Bg: ansi.PCPalette[1], Bright: true, Ice: true}}},
+		{"ice", []byte{'a', 0x9F}, 1, true, []canvas.Cell{{Char: 'a', Fg: ansi.PCPalette[15], Bg: ansi.PCPalette[9], Bright: true, Ice: true}}},
+		{"control glyphs", []byte{0x01, 0x07}, 1, false, []canvas.Cell{attrs.Cell(0x01, 0x07)}},
+	}
+	for _, tt := range tests {
+		c, err := NewParser(bytes.NewReader(tt.data), tt.width, tt.ice).Parse()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i, want := range tt.want {
+			if got := c.Grid[0][i]; got != want {
+				t.Errorf("%s: cell %d = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestInferWidth(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"160 columns", art(160, 25), 160},
+		{"80 columns", art(80, 50), 80},
+		{"132 columns", art(132, 10), 132},
+		{"no whole rows", art(80, 1)[:10], DefaultWidth},
+		{"empty", nil, DefaultWidth},
+	}
+	for _, tt := range tests {
+		if got := InferWidth(tt.data); got != tt.want {
+			t.Errorf("%s: InferWidth = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTooLarge(t *testing.T) {
+	r := io.MultiReader(strings.NewReader(strings.Repeat("a\x07", MaxSize/2)), strings.NewReader("b\x07"))
+	if _, err := NewParser(r, 160, false).Parse(); !errors.Is(err, canvas.ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"clean", "a\x07b\x07", nil},
+		{"odd byte", "a\x07b\x07c", []string{"1:3 (byte 4): error: odd byte at end of data"}},
+	}
+	for _, tt := range tests {
+		p := NewParser(strings.NewReader(tt.data), 80, false)
+		p.Diagnostics = &diag.Collector{}
+		if _, err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Package bintext reads and writes BinaryText (.bin) files: a raw dump of
+// VGA text memory, one character byte and one attribute byte per cell.
+package bintext
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"fmt"
+	"io"
+)
+
+// DefaultWidth is the most common BinaryText width, used when inference has
+// nothing to go on.
+const DefaultWidth = 160
+
+// MaxSize is the largest input Parse reads: two bytes for every cell a canvas
+// can hold.
+const MaxSize = 2 * canvas.MaxCells
+
+// candidateWidths are the widths InferWidth considers, in order of
+// preference for ties.
+var candidateWidths = []int{160, 80, 132, 100, 120, 40, 64, 128, 256, 320}
+
+// Parser reads a BinaryText stream.
+type Parser struct {
+	reader io.Reader
+	width  int
+	ice    bool
+
+	// Diagnostics, if not nil, collects the problems found in the data.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new BinaryText parser. A width of 0 infers it from the
+// data. ice selects iCE colors instead of blinking for the high background
+// bit.
+func NewParser(r io.Reader, width int, ice bool) *Parser {
+	return &Parser{
+		reader: r,
+		width:  width,
+		ice:    ice,
+	}
+}
+
+// Parse reads the whole stream into a new canvas.
+func (p *Parser) Parse() (*canvas.Canvas, error) {
+	data, err := io.ReadAll(io.LimitReader(p.reader, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("%w: BinaryText data exceeds %d bytes", canvas.ErrTooLarge, MaxSize)
+	}
+	width := p.width
+	if width <= 0 {
+		width = InferWidth(data)
+	}
+
+	c := canvas.NewCanvas(width)
+	attrs := xbin.Attributes{Palette: ansi.PCPalette, ICE: p.ice}
+	for i := 0; i+1 < len(data); i += 2 {
+		c.Put(attrs.Cell(data[i], data[i+1]))
+	}
+	if len(data)%2 != 0 {
+		p.Diagnostics.Add(diag.Diagnostic{
+			Offset:   int64(len(data) - 1),
+			Row:      c.Cursor.Row,
+			Col:      c.Cursor.Col,
+			Severity: diag.Error,
+			Message:  "odd byte at end of data",
+		})
+	}
+	return c, nil
+}
+
+// InferWidth guesses the width of headerless BinaryText. Art is mostly
+// vertically coherent, so among the widths that divide the data into whole
+// rows it picks the one where attributes most often repeat the row above.
+func InferWidth(data []byte) int {
+	cells := len(data) / 2
+	best, bestScore := DefaultWidth, -1.0
+	for _, w := range candidateWidths {
+		if cells%w != 0 || cells < 2*w {
+			continue
+		}
+		same := 0
+		for i := w; i < cells; i++ {
+			if data[2*i+1] == data[2*(i-w)+1] {
+				same++
+			}
+		}
+		if score := float64(same) / float64(cells-w); score > bestScore {
+			best, bestScore = w, score
+		}
+	}
+	return best
+}
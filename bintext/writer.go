@@ -0,0 +1,40 @@
+package bintext
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/xbin"
+	"bufio"
+	"io"
+)
+
+// Writer converts a canvas to BinaryText.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+}
+
+// NewWriter creates a new BinaryText writer.
+func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+	}
+}
+
+// Write dumps every row up to the last one with content at the full canvas
+// width, with colors snapped to the ANSI palette and iCE backgrounds.
+func (w *Writer) Write() error {
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	attrs := xbin.Attributes{Palette: ansi.PCPalette, ICE: true}
+
+	bw := bufio.NewWriter(w.writer)
+	for r := 0; r <= maxRow; r++ {
+		for _, cell := range w.canvas.Grid[r] {
+			ch, attr := attrs.Bytes(cell)
+			bw.WriteByte(ch)
+			bw.WriteByte(attr)
+		}
+	}
+	return bw.Flush()
+}
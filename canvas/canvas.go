@@ -1,6 +1,11 @@
 package canvas
 
-import "image/color"
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+)
 
 var (
 	// These are standard VGA colors, which are the basis for ANSI color.
@@ -13,8 +18,20 @@ const (
 	DefaultBold  = false
 	DefaultIce   = false
 	DefaultWidth = 80
+	// DefaultTabWidth is the interval of the initial tab stops.
+	DefaultTabWidth = 8
+
+	// MaxRows and MaxCells bound how far a canvas grows, so that a few
+	// bytes of cursor movement can't allocate gigabytes. Art rarely has
+	// more than a few thousand rows.
+	MaxRows  = 20000
+	MaxCells = 4 << 20
 )
 
+// ErrTooLarge is reported by Err when the input tried to grow the canvas past
+// MaxRows or MaxCells.
+var ErrTooLarge = errors.New("canvas too large")
+
 // Point represents a coordinate on the canvas.
 type Point struct {
 	Row int
@@ -29,6 +46,34 @@ type Cell struct {
 	Bold   bool // For font weight (SGR 1)
 	Bright bool // For high-intensity colors (SGR 90-97)
 	Ice    bool // For high-intensity backgrounds (iCE Color / SGR 5)
+	// Underline is set by SGR 4 and mIRC ^_. Only some outputs show it.
+	Underline bool
+}
+
+// WrapMode selects what happens when a character is written to the last
+// column.
+type WrapMode int
+
+const (
+	// PendingWrap leaves the cursor past the last column, as VT terminals
+	// do; only the next character wraps. A line break right after a full
+	// line therefore doesn't leave an empty line.
+	PendingWrap WrapMode = iota
+	// ImmediateWrap moves the cursor to the next line right away, as
+	// ANSI.SYS does, so a full line followed by a line break leaves an
+	// empty line.
+	ImmediateWrap
+)
+
+// ParseWrapMode parses a wrap mode name: "pending" or "immediate".
+func ParseWrapMode(s string) (WrapMode, error) {
+	switch strings.ToLower(s) {
+	case "", "pending", "vt":
+		return PendingWrap, nil
+	case "immediate", "ansi.sys", "dos":
+		return ImmediateWrap, nil
+	}
+	return 0, fmt.Errorf("unknown wrap mode %q (want pending or immediate)", s)
 }
 
 // Canvas represents the grid of characters.
@@ -36,6 +81,19 @@ type Canvas struct {
 	Grid   [][]Cell
 	Cursor Point
 	width  int
+	// Wrap is the line wrapping behavior of Put.
+	Wrap WrapMode
+	// tabs marks the tab stop columns.
+	tabs []bool
+	// Font is the bitmap font embedded in the input, if any. The renderer
+	// draws with it instead of its TrueType font.
+	Font *Font
+	// Palette is the palette embedded in the input, if any. Cells already
+	// hold the resolved colors; writers of formats with their own palette
+	// use it to write the colors back unchanged.
+	Palette []color.RGBA
+	// err records that the canvas stopped growing at its limits.
+	err error
 }
 
 // NewCanvas creates a new canvas of a given width.
@@ -43,10 +101,23 @@ func NewCanvas(width int) *Canvas {
 	c := &Canvas{
 		width: width,
 	}
+	c.SetTabInterval(DefaultTabWidth)
 	c.addRow()
 	return c
 }
 
+// Width returns the number of columns of the canvas.
+func (c *Canvas) Width() int {
+	return c.width
+}
+
+// Err returns an error wrapping ErrTooLarge if the canvas reached its size
+// limits. Once full, the canvas stops growing and the cursor stays on the
+// last row, so parsers can carry on and check Err when they are done.
+func (c *Canvas) Err() error {
+	return c.err
+}
+
 // SetCursor moves the cursor to an absolute position.
 func (c *Canvas) SetCursor(row, col int) {
 	if row < 0 {
@@ -55,16 +126,13 @@ func (c *Canvas) SetCursor(row, col int) {
 	if col < 0 {
 		col = 0
 	}
-	// Ensure enough rows exist
-	for row >= len(c.Grid) {
-		c.addRow()
-	}
-	c.Cursor.Row = row
+	c.Cursor.Row = c.grow(row)
 	c.Cursor.Col = col
 }
 
 // MoveUp moves the cursor up by n rows.
 func (c *Canvas) MoveUp(n int) {
+	c.cancelWrap()
 	c.Cursor.Row -= n
 	if c.Cursor.Row < 0 {
 		c.Cursor.Row = 0
@@ -73,10 +141,8 @@ func (c *Canvas) MoveUp(n int) {
 
 // MoveDown moves the cursor down by n rows.
 func (c *Canvas) MoveDown(n int) {
-	c.Cursor.Row += n
-	for c.Cursor.Row >= len(c.Grid) {
-		c.addRow()
-	}
+	c.cancelWrap()
+	c.Cursor.Row = c.grow(c.Cursor.Row + n)
 }
 
 // MoveForward moves the cursor forward by n columns.
@@ -89,14 +155,39 @@ func (c *Canvas) MoveForward(n int) {
 
 // MoveBackward moves the cursor backward by n columns.
 func (c *Canvas) MoveBackward(n int) {
+	c.cancelWrap()
 	c.Cursor.Col -= n
 	if c.Cursor.Col < 0 {
 		c.Cursor.Col = 0
 	}
 }
 
-// addRow adds a new row to the canvas grid.
-func (c *Canvas) addRow() {
+// cancelWrap moves a cursor left past the last column by a pending wrap
+// back onto it, as cursor movement does on a terminal.
+func (c *Canvas) cancelWrap() {
+	if c.Cursor.Col >= c.width {
+		c.Cursor.Col = c.width - 1
+	}
+}
+
+// grow adds rows until row exists, as far as the limits allow. It returns
+// row, or the last row if the canvas is full.
+func (c *Canvas) grow(row int) int {
+	for row >= len(c.Grid) {
+		if !c.addRow() {
+			return len(c.Grid) - 1
+		}
+	}
+	return row
+}
+
+// addRow adds a new row to the canvas grid. It returns false, and records
+// the error, if the canvas is full; the first row is always added.
+func (c *Canvas) addRow() bool {
+	if len(c.Grid) >= c.maxRows() {
+		c.full()
+		return false
+	}
 	newRow := make([]Cell, c.width)
 	for i := range newRow {
 		newRow[i] = Cell{
@@ -109,40 +200,56 @@ func (c *Canvas) addRow() {
 		}
 	}
 	c.Grid = append(c.Grid, newRow)
+	return true
+}
+
+// maxRows is the number of rows the limits allow at the canvas width, at
+// least one.
+func (c *Canvas) maxRows() int {
+	return max(min(MaxRows, MaxCells/c.width), 1)
+}
+
+// full records that the canvas reached its limits.
+func (c *Canvas) full() {
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: more than %d rows or %d cells", ErrTooLarge, MaxRows, MaxCells)
+	}
 }
 
 // NewLine moves the cursor to the beginning of the next line.
 func (c *Canvas) NewLine() {
 	c.Cursor.Col = 0
-	c.Cursor.Row++
-	if c.Cursor.Row >= len(c.Grid) {
-		c.addRow()
-	}
+	c.Cursor.Row = c.grow(c.Cursor.Row + 1)
 }
 
 // SetCell places a character at the current cursor position and advances the cursor.
 func (c *Canvas) SetCell(char rune, fg, bg color.RGBA, bold, bright, ice bool) {
-	if c.Cursor.Row >= len(c.Grid) {
-		c.addRow()
-	}
-
-	// This check prevents writing past the last column, which can happen
-	// with some ANSI files that don't respect their own width.
-	if c.Cursor.Col >= c.width {
-		c.NewLine()
-	}
-
-	c.Grid[c.Cursor.Row][c.Cursor.Col] = Cell{
+	c.Put(Cell{
 		Char:   char,
 		Fg:     fg,
 		Bg:     bg,
 		Bold:   bold,
 		Bright: bright,
 		Ice:    ice,
+	})
+}
+
+// Put places a complete cell at the current cursor position and advances the
+// cursor, like SetCell. Writing the last column wraps according to Wrap.
+func (c *Canvas) Put(cell Cell) {
+	c.Cursor.Row = c.grow(c.Cursor.Row)
+
+	// This wraps a pending line, and also prevents writing past the last
+	// column, which can happen with some ANSI files that don't respect
+	// their own width.
+	if c.Cursor.Col >= c.width {
+		c.NewLine()
 	}
 
+	c.Grid[c.Cursor.Row][c.Cursor.Col] = cell
+
 	c.Cursor.Col++
-	if c.Cursor.Col >= c.width {
+	if c.Cursor.Col >= c.width && c.Wrap == ImmediateWrap {
 		c.Cursor.Col = 0
 		c.Cursor.Row++
 	}
@@ -160,6 +267,18 @@ func (c *Canvas) Clear(cell Cell) {
 	c.Cursor.Col = 0
 }
 
+// MapColors replaces the foreground and background color of every cell with
+// the result of fn, e.g. to swap one palette for another after parsing.
+func (c *Canvas) MapColors(fn func(color.RGBA) color.RGBA) {
+	for r := range c.Grid {
+		for col := range c.Grid[r] {
+			cell := &c.Grid[r][col]
+			cell.Fg = fn(cell.Fg)
+			cell.Bg = fn(cell.Bg)
+		}
+	}
+}
+
 // GetContentBounds finds the minimal bounding box of content on the canvas.
 func (c *Canvas) GetContentBounds() (minRow, maxRow, minCol, maxCol int) {
 	minRow, maxRow, minCol, maxCol = len(c.Grid), -1, c.width, -1
@@ -0,0 +1,96 @@
+package canvas
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		width   int
+		move    func(c *Canvas)
+		wantErr bool
+	}{
+		{"small", 80, func(c *Canvas) { c.SetCursor(100, 0) }, false},
+		{"max rows", 80, func(c *Canvas) { c.SetCursor(MaxRows-1, 0) }, false},
+		{"set cursor", 80, func(c *Canvas) { c.SetCursor(MaxRows, 0) }, true},
+		{"move down", 80, func(c *Canvas) {
+			for range 100 {
+				c.MoveDown(1 << 16)
+			}
+		}, true},
+		{"new lines", 80, func(c *Canvas) {
+			for range MaxRows + 10 {
+				c.NewLine()
+			}
+		}, true},
+		{"wide", 1000, func(c *Canvas) { c.SetCursor(MaxCells/1000, 0) }, true},
+	}
+	for _, tt := range tests {
+		c := NewCanvas(tt.width)
+		tt.move(c)
+		err := c.Err()
+		if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrTooLarge)) {
+			t.Errorf("%s: Err() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if len(c.Grid) > MaxRows || len(c.Grid)*tt.width > MaxCells {
+			t.Errorf("%s: canvas grew to %d rows", tt.name, len(c.Grid))
+		}
+		if c.Cursor.Row >= len(c.Grid) {
+			t.Errorf("%s: cursor row %d past the last row %d", tt.name, c.Cursor.Row, len(c.Grid)-1)
+		}
+		// Writing on a full canvas stays on its last row.
+		c.SetCell('x', DefaultFg, DefaultBg, false, false, false)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    WrapMode
+		input   string
+		wantRow int
+		wantCol int
+	}{
+		{"pending at the last column", PendingWrap, "abcd", 0, 4},
+		{"pending wraps on the next character", PendingWrap, "abcde", 1, 1},
+		{"pending line break", PendingWrap, "abcd\n", 1, 0},
+		{"immediate at the last column", ImmediateWrap, "abcd", 1, 0},
+		{"immediate line break", ImmediateWrap, "abcd\n", 2, 0},
+		{"short line", ImmediateWrap, "ab\n", 1, 0},
+	}
+	for _, tt := range tests {
+		c := NewCanvas(4)
+		c.Wrap = tt.mode
+		for _, r := range tt.input {
+			if r == '\n' {
+				c.NewLine()
+				continue
+			}
+			c.Put(Cell{Char: r})
+		}
+		if c.Cursor.Row != tt.wantRow || c.Cursor.Col != tt.wantCol {
+			t.Errorf("%s: cursor at %d,%d, want %d,%d", tt.name, c.Cursor.Row, c.Cursor.Col, tt.wantRow, tt.wantCol)
+		}
+	}
+}
+
+func TestParseWrapMode(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    WrapMode
+		wantErr bool
+	}{
+		{"", PendingWrap, false},
+		{"pending", PendingWrap, false},
+		{"immediate", ImmediateWrap, false},
+		{"sometimes", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWrapMode(tt.s)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseWrapMode(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package canvas
+
+import "slices"
+
+// The editing primitives below follow the VT100/ANSI erase, insert and delete
+// controls. The canvas has no fixed height, so "the screen" is every row the
+// canvas has so far; blank is the cell erased areas are filled with, usually
+// a space in the current colors.
+
+// EraseInLine erases part of the cursor's row: mode 0 from the cursor to the
+// end, mode 1 from the start through the cursor, mode 2 the whole row.
+func (c *Canvas) EraseInLine(mode int, blank Cell) {
+	c.ensureRow(c.Cursor.Row)
+	col := c.cursorCol()
+	switch mode {
+	case 0:
+		c.fill(c.Cursor.Row, col, c.width, blank)
+	case 1:
+		c.fill(c.Cursor.Row, 0, col+1, blank)
+	case 2:
+		c.fill(c.Cursor.Row, 0, c.width, blank)
+	}
+}
+
+// EraseInDisplay erases part of the canvas without moving the cursor: mode 0
+// from the cursor to the end, mode 1 from the start through the cursor, mode
+// 2 everything.
+func (c *Canvas) EraseInDisplay(mode int, blank Cell) {
+	c.ensureRow(c.Cursor.Row)
+	switch mode {
+	case 0:
+		c.EraseInLine(0, blank)
+		for r := c.Cursor.Row + 1; r < len(c.Grid); r++ {
+			c.fill(r, 0, c.width, blank)
+		}
+	case 1:
+		for r := 0; r < c.Cursor.Row; r++ {
+			c.fill(r, 0, c.width, blank)
+		}
+		c.EraseInLine(1, blank)
+	case 2:
+		for r := range c.Grid {
+			c.fill(r, 0, c.width, blank)
+		}
+	}
+}
+
+// InsertChars shifts the rest of the cursor's row n columns to the right,
+// dropping what is pushed past the edge, and blanks the gap.
+func (c *Canvas) InsertChars(n int, blank Cell) {
+	c.ensureRow(c.Cursor.Row)
+	row, col := c.Grid[c.Cursor.Row], c.cursorCol()
+	if n = min(n, c.width-col); n <= 0 {
+		return
+	}
+	copy(row[col+n:], row[col:])
+	c.fill(c.Cursor.Row, col, col+n, blank)
+}
+
+// DeleteChars removes n cells at the cursor, shifting the rest of the row
+// left and blanking the end.
+func (c *Canvas) DeleteChars(n int, blank Cell) {
+	c.ensureRow(c.Cursor.Row)
+	row, col := c.Grid[c.Cursor.Row], c.cursorCol()
+	if n = min(n, c.width-col); n <= 0 {
+		return
+	}
+	copy(row[col:], row[col+n:])
+	c.fill(c.Cursor.Row, c.width-n, c.width, blank)
+}
+
+// InsertLines inserts n blank rows at the cursor's row, pushing the rows
+// below down. The canvas grows instead of losing the bottom rows.
+func (c *Canvas) InsertLines(n int, blank Cell) {
+	c.insertRows(c.Cursor.Row, n, blank)
+}
+
+// DeleteLines removes n rows at the cursor's row, pulling the rows below up
+// and adding blank rows at the bottom.
+func (c *Canvas) DeleteLines(n int, blank Cell) {
+	c.deleteRows(c.Cursor.Row, n, blank)
+}
+
+// ScrollUp moves the content up n rows, discarding the top rows and adding
+// blank rows at the bottom. The cursor stays put.
+func (c *Canvas) ScrollUp(n int, blank Cell) {
+	c.deleteRows(0, n, blank)
+}
+
+// ScrollDown moves the content down n rows, adding blank rows at the top.
+// The cursor stays put.
+func (c *Canvas) ScrollDown(n int, blank Cell) {
+	c.insertRows(0, n, blank)
+}
+
+// insertRows inserts n blank rows at row at. On a full canvas the rows
+// pushed past the limits are lost, as at the bottom of a terminal screen,
+// and reused for the blank rows.
+func (c *Canvas) insertRows(at, n int, blank Cell) {
+	c.ensureRow(at)
+	at = min(at, len(c.Grid)-1)
+	limit := c.maxRows()
+	if n = min(n, limit-at); n <= 0 {
+		return
+	}
+	var spare [][]Cell
+	if over := len(c.Grid) + n - limit; over > 0 {
+		spare = c.Grid[len(c.Grid)-over:]
+		c.Grid = c.Grid[:len(c.Grid)-over]
+		c.full()
+	}
+	rows := make([][]Cell, n)
+	for i := range rows {
+		if i < len(spare) {
+			rows[i] = spare[i]
+			for col := range rows[i] {
+				rows[i][col] = blank
+			}
+		} else {
+			rows[i] = c.blankRow(blank)
+		}
+	}
+	c.Grid = slices.Insert(c.Grid, at, rows...)
+}
+
+func (c *Canvas) deleteRows(at, n int, blank Cell) {
+	c.ensureRow(at)
+	n = min(n, len(c.Grid)-at)
+	if n <= 0 {
+		return
+	}
+	c.Grid = append(c.Grid[:at], c.Grid[at+n:]...)
+	for i := 0; i < n; i++ {
+		c.Grid = append(c.Grid, c.blankRow(blank))
+	}
+}
+
+func (c *Canvas) blankRow(blank Cell) []Cell {
+	row := make([]Cell, c.width)
+	for i := range row {
+		row[i] = blank
+	}
+	return row
+}
+
+// fill sets the cells [from, to) of a row to blank.
+func (c *Canvas) fill(row, from, to int, blank Cell) {
+	for col := max(from, 0); col < to && col < c.width; col++ {
+		c.Grid[row][col] = blank
+	}
+}
+
+// ensureRow adds rows until row exists. If the canvas is full, a cursor past
+// the last row is moved onto it.
+func (c *Canvas) ensureRow(row int) {
+	if c.grow(row) < row && c.Cursor.Row >= len(c.Grid) {
+		c.Cursor.Row = len(c.Grid) - 1
+	}
+}
+
+// cursorCol is the cursor column clamped to the canvas, since the cursor may
+// sit just past the last column.
+func (c *Canvas) cursorCol() int {
+	return min(max(c.Cursor.Col, 0), c.width-1)
+}
@@ -0,0 +1,113 @@
+package canvas
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// rows builds a canvas from lines of text, all as wide as the first, with
+// the cursor at row, col.
+func rows(row, col int, lines ...string) *Canvas {
+	c := NewCanvas(len(lines[0]))
+	for _, line := range lines {
+		for _, r := range line {
+			c.Put(Cell{Char: r})
+		}
+	}
+	c.SetCursor(row, col)
+	return c
+}
+
+// text returns the characters of the canvas, one line per row.
+func text(c *Canvas) string {
+	var lines []string
+	for _, row := range c.Grid {
+		var line strings.Builder
+		for _, cell := range row {
+			line.WriteRune(cell.Char)
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestEdit(t *testing.T) {
+	blank := Cell{Char: '.'}
+	tests := []struct {
+		name string
+		c    *Canvas
+		edit func(c *Canvas)
+		want string
+	}{
+		{"erase to end of line", rows(0, 1, "abc", "def"), func(c *Canvas) { c.EraseInLine(0, blank) }, "a..\ndef"},
+		{"erase to start of line", rows(0, 1, "abc", "def"), func(c *Canvas) { c.EraseInLine(1, blank) }, "..c\ndef"},
+		{"erase line", rows(1, 1, "abc", "def"), func(c *Canvas) { c.EraseInLine(2, blank) }, "abc\n..."},
+		{"erase line at pending wrap", rows(0, 3, "abc"), func(c *Canvas) { c.EraseInLine(0, blank) }, "ab."},
+		{"erase to end of display", rows(0, 2, "abc", "def"), func(c *Canvas) { c.EraseInDisplay(0, blank) }, "ab.\n..."},
+		{"erase to start of display", rows(1, 0, "abc", "def"), func(c *Canvas) { c.EraseInDisplay(1, blank) }, "...\n.ef"},
+		{"erase display", rows(1, 0, "abc", "def"), func(c *Canvas) { c.EraseInDisplay(2, blank) }, "...\n..."},
+		{"insert chars", rows(0, 1, "abcd"), func(c *Canvas) { c.InsertChars(2, blank) }, "a..b"},
+		{"insert chars past the edge", rows(0, 1, "abcd"), func(c *Canvas) { c.InsertChars(100, blank) }, "a..."},
+		{"delete chars", rows(0, 1, "abcd"), func(c *Canvas) { c.DeleteChars(2, blank) }, "ad.."},
+		{"delete chars past the edge", rows(0, 1, "abcd"), func(c *Canvas) { c.DeleteChars(100, blank) }, "a..."},
+		{"insert lines grows", rows(1, 0, "ab", "cd"), func(c *Canvas) { c.InsertLines(1, blank) }, "ab\n..\ncd"},
+		{"delete lines", rows(0, 0, "ab", "cd", "ef"), func(c *Canvas) { c.DeleteLines(2, blank) }, "ef\n..\n.."},
+		{"delete lines past the end", rows(1, 0, "ab", "cd"), func(c *Canvas) { c.DeleteLines(100, blank) }, "ab\n.."},
+		{"scroll up", rows(1, 1, "ab", "cd"), func(c *Canvas) { c.ScrollUp(1, blank) }, "cd\n.."},
+		{"scroll down", rows(1, 1, "ab", "cd"), func(c *Canvas) { c.ScrollDown(1, blank) }, "..\nab\ncd"},
+		{"edit below the last row", rows(0, 0, "ab"), func(c *Canvas) { c.Cursor.Row = 2; c.EraseInLine(2, blank) }, "ab\n  \n.."},
+	}
+	for _, tt := range tests {
+		tt.edit(tt.c)
+		if got := text(tt.c); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEditLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Canvas)
+	}{
+		{"insert lines", func(c *Canvas) {
+			for range 100 {
+				c.InsertLines(1<<16, Cell{})
+			}
+		}},
+		{"scroll down", func(c *Canvas) {
+			for range 100 {
+				c.ScrollDown(1<<16, Cell{})
+			}
+		}},
+		{"insert lines on the last row", func(c *Canvas) {
+			c.SetCursor(MaxRows, 0)
+			c.InsertLines(10, Cell{})
+		}},
+	}
+	for _, tt := range tests {
+		c := NewCanvas(80)
+		tt.edit(c)
+		if len(c.Grid) > MaxRows {
+			t.Errorf("%s: canvas grew to %d rows", tt.name, len(c.Grid))
+		}
+		if err := c.Err(); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: Err() = %v, want ErrTooLarge", tt.name, err)
+		}
+	}
+
+	// Rows pushed off a full canvas are lost, not the ones above them.
+	c := NewCanvas(80)
+	c.SetCursor(MaxRows-1, 0)
+	c.Put(Cell{Char: 'z'})
+	c.SetCursor(0, 0)
+	c.Put(Cell{Char: 'a'})
+	c.ScrollDown(1, Cell{Char: '.'})
+	if c.Grid[0][0].Char != '.' || c.Grid[1][0].Char != 'a' {
+		t.Errorf("scroll down on a full canvas: rows start %q, %q", c.Grid[0][0].Char, c.Grid[1][0].Char)
+	}
+	if len(c.Grid) != MaxRows {
+		t.Errorf("scroll down on a full canvas: %d rows, want %d", len(c.Grid), MaxRows)
+	}
+}
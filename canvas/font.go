@@ -0,0 +1,54 @@
+package canvas
+
+import "a2m2a/cp437"
+
+// GlyphBase is the first private-use rune standing for a glyph of an
+// embedded font that has no CP437 equivalent: glyph i of the second bank of
+// a 512-character font is stored as GlyphBase+i.
+const GlyphBase = 0xE000
+
+// Font is a bitmap font with one glyph per character code, as embedded in
+// XBin, iCE Draw and ArtWorx files.
+type Font struct {
+	Width, Height int
+	// Glyphs holds 256 or 512 bitmaps of Height rows, one byte per row with
+	// the leftmost pixel in the most significant bit.
+	Glyphs [][]byte
+}
+
+// NewFont splits raw font data of 8-pixel-wide glyphs, height bytes each,
+// into a Font.
+func NewFont(height int, data []byte) *Font {
+	f := &Font{Width: 8, Height: height}
+	for i := 0; i+height <= len(data); i += height {
+		f.Glyphs = append(f.Glyphs, data[i:i+height])
+	}
+	return f
+}
+
+// GlyphRune returns the rune a cell stores for glyph i.
+func GlyphRune(i int) rune {
+	if i < 256 {
+		return cp437.Decode(byte(i))
+	}
+	return GlyphBase + rune(i)
+}
+
+// GlyphIndex is the inverse of GlyphRune. It reports false for runes that
+// are neither in CP437 nor private-use glyphs.
+func GlyphIndex(r rune) (int, bool) {
+	if r >= GlyphBase+256 && r < GlyphBase+512 {
+		return int(r - GlyphBase), true
+	}
+	b, ok := cp437.Encode(r)
+	return int(b), ok
+}
+
+// Glyph returns the bitmap drawn for r, or nil if the font has none.
+func (f *Font) Glyph(r rune) []byte {
+	i, ok := GlyphIndex(r)
+	if !ok || i >= len(f.Glyphs) {
+		return nil
+	}
+	return f.Glyphs[i]
+}
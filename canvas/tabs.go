@@ -0,0 +1,58 @@
+package canvas
+
+// SetTabInterval replaces the tab stops with one every n columns.
+func (c *Canvas) SetTabInterval(n int) {
+	c.tabs = make([]bool, c.width)
+	if n <= 0 {
+		return
+	}
+	for col := n; col < c.width; col += n {
+		c.tabs[col] = true
+	}
+}
+
+// SetTabStop sets a tab stop at the cursor column (HTS).
+func (c *Canvas) SetTabStop() {
+	if col := c.Cursor.Col; col < c.width {
+		c.tabs[col] = true
+	}
+}
+
+// ClearTabStop clears the tab stop at the cursor column (TBC 0).
+func (c *Canvas) ClearTabStop() {
+	if col := c.Cursor.Col; col < c.width {
+		c.tabs[col] = false
+	}
+}
+
+// ClearTabStops clears every tab stop (TBC 3).
+func (c *Canvas) ClearTabStops() {
+	clear(c.tabs)
+}
+
+// Tab moves the cursor forward to the n-th next tab stop, or to the last
+// column if there are not that many. Cells passed over are left as they
+// are.
+func (c *Canvas) Tab(n int) {
+	c.cancelWrap()
+	for ; n > 0; n-- {
+		col := c.Cursor.Col + 1
+		for col < c.width-1 && !c.tabs[col] {
+			col++
+		}
+		c.Cursor.Col = min(col, c.width-1)
+	}
+}
+
+// BackTab moves the cursor back to the n-th previous tab stop, or to the
+// first column.
+func (c *Canvas) BackTab(n int) {
+	c.cancelWrap()
+	for ; n > 0; n-- {
+		col := c.Cursor.Col - 1
+		for col > 0 && !c.tabs[col] {
+			col--
+		}
+		c.Cursor.Col = max(col, 0)
+	}
+}
@@ -0,0 +1,331 @@
+package convert
+
+import (
+	"a2m2a/adf"
+	"a2m2a/ansi"
+	"a2m2a/avatar"
+	"a2m2a/bbs"
+	"a2m2a/bintext"
+	"a2m2a/canvas"
+	"a2m2a/html"
+	"a2m2a/idf"
+	"a2m2a/mirc"
+	"a2m2a/plain"
+	"a2m2a/raster"
+	"a2m2a/renderer"
+	"a2m2a/sauce"
+	"a2m2a/svg"
+	"a2m2a/term"
+	"a2m2a/tundra"
+	"a2m2a/xbin"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// The built-in formats, in detection priority order.
+func init() {
+	Register(Format{
+		Name:        "ansi",
+		MediaType:   "text/plain; charset=utf-8",
+		Extensions:  []string{".ans", ".ansi"},
+		Diagnostics: true,
+		Detect:      detectANSI,
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			c := opts.NewCanvas()
+			p := ansi.NewParser(c, r, 0)
+			p.Diagnostics = opts.Diagnostics
+			return c, p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return ansi.NewWriter(c, w, opts.ANSI).Write()
+		}),
+	})
+	Register(Format{
+		Name:        "mirc",
+		MediaType:   "text/plain; charset=utf-8",
+		Extensions:  []string{".mrc", ".irc", ".mirc"},
+		Diagnostics: true,
+		Detect:      detectMIRC,
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			c := opts.NewCanvas()
+			p := mirc.NewParser(c, r)
+			p.Diagnostics = opts.Diagnostics
+			return c, p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return mirc.NewWriter(c, w).Write()
+		}),
+	})
+	for _, d := range bbs.Dialects {
+		Register(Format{
+			Name:        d.String(),
+			MediaType:   "text/plain; charset=ibm437",
+			Extensions:  bbsExtensions[d],
+			Diagnostics: true,
+			Detect: func(head []byte) int {
+				return scoreCount(d.Detect(head))
+			},
+			Sauce: func(rec *sauce.Record) bool {
+				return d == bbs.PCBoard && rec.Is(sauce.DataTypeCharacter, sauce.FileTypePCBoard)
+			},
+			Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+				c := opts.NewCanvas()
+				p := bbs.NewParser(c, r, d)
+				p.Diagnostics = opts.Diagnostics
+				return c, p.Parse()
+			}),
+			Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+				return bbs.NewWriter(c, w, d).Write()
+			}),
+		})
+	}
+	Register(Format{
+		Name:        "xbin",
+		MediaType:   "application/octet-stream",
+		Extensions:  []string{".xb"},
+		Diagnostics: true,
+		Detect:      detectMagic(xbin.Magic),
+		Sauce: func(rec *sauce.Record) bool {
+			return rec.DataType == sauce.DataTypeXBin
+		},
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			p := xbin.NewParser(r)
+			p.Diagnostics = opts.Diagnostics
+			return p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return xbin.NewWriter(c, w).Write()
+		}),
+	})
+	Register(Format{
+		Name:        "bintext",
+		MediaType:   "application/octet-stream",
+		Extensions:  []string{".bin"},
+		Diagnostics: true,
+		Sauce: func(rec *sauce.Record) bool {
+			return rec.DataType == sauce.DataTypeBinaryText
+		},
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			// The SAUCE FileType of BinaryText is half the width.
+			width, ice := opts.Width, false
+			if rec := opts.Sauce; rec != nil && rec.DataType == sauce.DataTypeBinaryText {
+				if width == 0 {
+					width = 2 * int(rec.FileType)
+				}
+				ice = rec.ICE()
+			}
+			p := bintext.NewParser(r, width, ice)
+			p.Diagnostics = opts.Diagnostics
+			return p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return bintext.NewWriter(c, w).Write()
+		}),
+	})
+	Register(Format{
+		Name:        "idf",
+		MediaType:   "application/octet-stream",
+		Extensions:  []string{".idf"},
+		Diagnostics: true,
+		Detect:      detectMagic(idf.Magic, idf.Magic13),
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			p := idf.NewParser(r)
+			p.Diagnostics = opts.Diagnostics
+			return p.Parse()
+		}),
+	})
+	Register(Format{
+		Name:        "adf",
+		MediaType:   "application/octet-stream",
+		Extensions:  []string{".adf"},
+		Diagnostics: true,
+		Detect:      adf.Detect,
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			p := adf.NewParser(r)
+			p.Diagnostics = opts.Diagnostics
+			return p.Parse()
+		}),
+	})
+	Register(Format{
+		Name:        "avatar",
+		MediaType:   "text/plain; charset=ibm437",
+		Extensions:  []string{".avt"},
+		Diagnostics: true,
+		Detect: func(head []byte) int {
+			return scoreCount(avatar.Detect(head))
+		},
+		Sauce: func(rec *sauce.Record) bool {
+			return rec.Is(sauce.DataTypeCharacter, sauce.FileTypeAvatar)
+		},
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			c := opts.NewCanvas()
+			p := avatar.NewParser(c, r)
+			p.Diagnostics = opts.Diagnostics
+			return c, p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return avatar.NewWriter(c, w).Write()
+		}),
+	})
+	Register(Format{
+		Name:        "tundra",
+		MediaType:   "application/octet-stream",
+		Extensions:  []string{".tnd"},
+		Diagnostics: true,
+		Detect:      detectMagic(tundra.Magic),
+		Sauce: func(rec *sauce.Record) bool {
+			return rec.Is(sauce.DataTypeCharacter, sauce.FileTypeTundraDraw)
+		},
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			c := opts.NewCanvas()
+			p := tundra.NewParser(c, r)
+			p.Diagnostics = opts.Diagnostics
+			return c, p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return tundra.NewWriter(c, w).Write()
+		}),
+	})
+	Register(Format{
+		Name:        "plain",
+		MediaType:   "text/plain; charset=utf-8",
+		Extensions:  []string{".txt", ".asc", ".nfo", ".diz"},
+		Diagnostics: true,
+		// No SAUCE matcher: files labeled ASCII often contain color codes
+		// anyway, so the content decides.
+		Detect: detectPlain,
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			c := opts.NewCanvas()
+			p := plain.NewParser(c, r, opts.Text)
+			p.Diagnostics = opts.Diagnostics
+			return c, p.Parse()
+		}),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return plain.NewWriter(c, w).Write()
+		}),
+	})
+	Register(Format{
+		Name:       "html",
+		Extensions: []string{".html", ".htm"},
+		MediaType:  "text/html; charset=utf-8",
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return html.NewWriter(c, w, opts.HTML).Write()
+		}),
+	})
+	Register(Format{
+		Name:       "svg",
+		Extensions: []string{".svg"},
+		MediaType:  "image/svg+xml",
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			svgOpts := opts.SVG
+			if svgOpts.Scale == 0 {
+				svgOpts.Scale = opts.scale()
+			}
+			return svg.NewWriter(c, w, svgOpts).Write()
+		}),
+	})
+	Register(Format{
+		Name:      "term",
+		MediaType: "text/plain; charset=utf-8",
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return term.NewWriter(c, w, opts.Term).Write()
+		}),
+	})
+	Register(Format{
+		Name:      "sixel",
+		MediaType: "image/x-sixel",
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return term.NewSixelWriter(c, w, opts.scale()).Write()
+		}),
+	})
+	Register(Format{
+		Name:      "kitty",
+		MediaType: "application/octet-stream",
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			return term.NewKittyWriter(c, w, opts.scale()).Write()
+		}),
+	})
+	Register(Format{
+		Name:       "png",
+		MediaType:  "image/png",
+		Extensions: []string{".png"},
+		Image:      true,
+		Detect:     detectMagic("\x89PNG\r\n\x1a\n"),
+		Decoder:    DecoderFunc(decodeImage),
+		Encoder: EncoderFunc(func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+			data, err := renderer.ToPNGScaled(c, opts.scale())
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(data)
+			return err
+		}),
+	})
+	Register(Format{
+		Name:       "jpeg",
+		Extensions: []string{".jpg", ".jpeg"},
+		Image:      true,
+		Detect:     detectMagic("\xff\xd8\xff"),
+		Decoder:    DecoderFunc(decodeImage),
+	})
+	Register(Format{
+		Name:       "gif",
+		Extensions: []string{".gif"},
+		Image:      true,
+		Detect:     detectMagic("GIF87a", "GIF89a"),
+		Decoder:    DecoderFunc(decodeImage),
+	})
+}
+
+// bbsExtensions are the file extensions of the BBS color code dialects.
+var bbsExtensions = map[bbs.Dialect][]string{
+	bbs.PCBoard:  {".pcb"},
+	bbs.Wildcat:  {".wc"},
+	bbs.Pipe:     {".pip"},
+	bbs.Celerity: {".cel"},
+}
+
+// MaxImagePixels is the largest image, in pixels, that decodeImage accepts.
+// The decoders allocate the whole image up front, so a few hundred bytes of
+// compressed input could otherwise claim gigabytes.
+const MaxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned for images of more than MaxImagePixels.
+var ErrImageTooLarge = errors.New("image too large")
+
+// decodeImage converts a PNG, JPEG or GIF image into cells.
+func decodeImage(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+	// Read the header first to check the size, then decode from the start
+	// again.
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxImagePixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels, at most %d allowed", ErrImageTooLarge, cfg.Width, cfg.Height, MaxImagePixels)
+	}
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, err
+	}
+	imgOpts := opts.Image
+	if imgOpts.Columns == 0 {
+		imgOpts.Columns = opts.Width
+	}
+	return raster.ToCanvas(img, imgOpts)
+}
+
+func (o EncodeOptions) scale() float64 {
+	if o.Scale <= 0 {
+		return 1.0
+	}
+	return o.Scale
+}
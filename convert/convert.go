@@ -0,0 +1,336 @@
+// Package convert is the public entry point for embedding a2m2a. It defines
+// the Decoder and Encoder interfaces every format implements over
+// canvas.Canvas, a registry of known formats, and a Convert helper that wires
+// detection, decoding and encoding together.
+package convert
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/html"
+	"a2m2a/plain"
+	"a2m2a/quantize"
+	"a2m2a/raster"
+	"a2m2a/sauce"
+	"a2m2a/svg"
+	"a2m2a/term"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Decoder parses an input stream into a new canvas.
+type Decoder interface {
+	Decode(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error)
+}
+
+// Encoder writes a canvas to an output stream.
+type Encoder interface {
+	Encode(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error
+}
+
+// DecoderFunc adapts an ordinary function to the Decoder interface.
+type DecoderFunc func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error)
+
+// Decode calls f(ctx, r, opts).
+func (f DecoderFunc) Decode(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+	return f(ctx, r, opts)
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error
+
+// Encode calls f(ctx, w, c, opts).
+func (f EncoderFunc) Encode(ctx context.Context, w io.Writer, c *canvas.Canvas, opts EncodeOptions) error {
+	return f(ctx, w, c, opts)
+}
+
+// DecodeOptions controls how input is parsed.
+type DecodeOptions struct {
+	// Width is the canvas width in columns. Zero uses the SAUCE width if
+	// there is one and canvas.DefaultWidth otherwise.
+	Width int
+	// Sauce is the input's SAUCE record, if any. Its FileSize limits how much
+	// of the input is parsed as art.
+	Sauce *sauce.Record
+	// Force16 reduces every color to the 16-color ANSI palette once the
+	// input is parsed, using the Quantize mode.
+	Force16  bool
+	Quantize quantize.Mode
+	// Image configures how raster images are converted into cells. Its
+	// Columns default to Width.
+	Image raster.Options
+	// Text configures how plain text is read. Its TabWidth also sets the
+	// initial tab stops of the other text formats.
+	Text plain.Options
+	// Wrap is how text formats wrap at the last column.
+	Wrap canvas.WrapMode
+	// Diagnostics, if not nil, collects the problems the parser finds in
+	// the input, for the formats marked with Format.Diagnostics.
+	Diagnostics *diag.Collector
+	// Strict makes any such problem fail the decode.
+	Strict bool
+}
+
+// EncodeOptions controls how output is written.
+type EncodeOptions struct {
+	// Scale resizes image output; zero means 1.0.
+	Scale float64
+	// Term configures the "term" terminal preview.
+	Term term.Options
+	// HTML configures the "html" export.
+	HTML html.Options
+	// ANSI configures the "ansi" export.
+	ANSI ansi.Options
+	// SVG configures the "svg" export. Its scale defaults to Scale.
+	SVG svg.Options
+}
+
+// Options bundles everything Convert needs.
+type Options struct {
+	// From is the input format name. Empty means detect it from the content.
+	From string
+	// To is the output format name.
+	To     string
+	Decode DecodeOptions
+	Encode EncodeOptions
+}
+
+// Format describes a format that can be read, written, or both.
+type Format struct {
+	Name       string
+	Extensions []string
+	// Detect scores how likely it is that head, the start of the input, is in
+	// this format: 0 means "certainly not", 100 means "certainly".
+	Detect func(head []byte) int
+	// Sauce reports whether a SAUCE record identifies input in this format.
+	// A match takes precedence over Detect, since formats without a
+	// signature (e.g. BinaryText) can often only be recognized this way.
+	Sauce func(rec *sauce.Record) bool
+	// Decoder is nil for output-only formats.
+	Decoder Decoder
+	// Encoder is nil for input-only formats.
+	Encoder Encoder
+	// MediaType is the MIME type of encoded output, used when serving it.
+	MediaType string
+	// Image marks raster image formats: they are rendered through the
+	// renderer package or imported through the raster package. The CLI
+	// requires an output file for them and can also produce thumbnails, and
+	// directory scans skip them as they are not art.
+	Image bool
+	// Diagnostics marks formats whose Decoder reports problems to
+	// DecodeOptions.Diagnostics. Only these are checked by lint and --strict.
+	Diagnostics bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []*Format
+)
+
+// Register adds a format to the registry. Formats registered earlier win
+// detection ties. Registering a name twice replaces the earlier format.
+func Register(f Format) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	f.Name = strings.ToLower(f.Name)
+	for i, existing := range registry {
+		if existing.Name == f.Name {
+			registry[i] = &f
+			return
+		}
+	}
+	registry = append(registry, &f)
+}
+
+// Formats returns all registered formats in registration order.
+func Formats() []*Format {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]*Format(nil), registry...)
+}
+
+// Names lists the names of all registered formats in sorted order.
+func Names() []string {
+	var names []string
+	for _, f := range Formats() {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup finds a format by name.
+func Lookup(name string) (*Format, error) {
+	for _, f := range Formats() {
+		if f.Name == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown format %q (known: %s)", name, strings.Join(Names(), ", "))
+}
+
+// ForPath infers a format from a file extension. It returns nil if the
+// extension is not registered.
+func ForPath(path string) *Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil
+	}
+	for _, f := range Formats() {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// InputFormat returns the input format to use for the file at path: from if
+// it is set, otherwise the format named by the extension if that format can
+// not be detected from the content, otherwise "" to detect it.
+func InputFormat(from, path string) string {
+	if from != "" {
+		return from
+	}
+	if f := ForPath(path); f != nil && f.Decoder != nil && f.Detect == nil {
+		return f.Name
+	}
+	return ""
+}
+
+// Decode parses r into a canvas. If from is empty the format is detected
+// from the content. The format that was used is returned alongside the canvas.
+func Decode(ctx context.Context, r io.Reader, from string, opts DecodeOptions) (*canvas.Canvas, *Format, error) {
+	head, r, err := Peek(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var f *Format
+	if from != "" {
+		if f, err = Lookup(from); err != nil {
+			return nil, nil, err
+		}
+		if f.Decoder == nil {
+			return nil, nil, fmt.Errorf("format %q cannot be used as input", f.Name)
+		}
+	} else if f = DetectSauce(opts.Sauce); f == nil {
+		if f, _ = Detect(head); f == nil {
+			return nil, nil, ErrUnknownFormat
+		}
+	}
+
+	// Stop at the SAUCE record, so that decoders only see the art.
+	if size := opts.DataSize(); size > 0 {
+		r = io.LimitReader(r, size)
+	}
+	if opts.Strict && opts.Diagnostics == nil {
+		opts.Diagnostics = &diag.Collector{}
+	}
+	c, err := f.Decoder.Decode(ctx, contextReader{ctx, r}, opts)
+	if err == nil {
+		err = c.Err()
+	}
+	if err != nil {
+		return nil, f, fmt.Errorf("parsing %s: %w", f.Name, err)
+	}
+	if opts.Strict {
+		if err := opts.Diagnostics.Err(); err != nil {
+			return nil, f, fmt.Errorf("parsing %s: %w", f.Name, err)
+		}
+	}
+	if opts.Force16 {
+		quantize.Apply(c, ansi.AnsiPalette, opts.Quantize)
+	}
+	return c, f, nil
+}
+
+// Encode writes c to w in the named format.
+func Encode(ctx context.Context, w io.Writer, c *canvas.Canvas, to string, opts EncodeOptions) error {
+	f, err := Lookup(to)
+	if err != nil {
+		return err
+	}
+	if f.Encoder == nil {
+		return fmt.Errorf("format %q cannot be used as output", f.Name)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := f.Encoder.Encode(ctx, w, c, opts); err != nil {
+		return fmt.Errorf("writing %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// Convert reads art from r and writes it to w in opts.To. If r is seekable and
+// no SAUCE record was given, the record is read from the end of r first.
+func Convert(ctx context.Context, r io.Reader, w io.Writer, opts Options) error {
+	if opts.To == "" {
+		return fmt.Errorf("no output format given")
+	}
+	if rs, ok := r.(io.ReadSeeker); ok && opts.Decode.Sauce == nil {
+		opts.Decode.Sauce, _ = sauce.Get(rs)
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	c, _, err := Decode(ctx, r, opts.From, opts.Decode)
+	if err != nil {
+		return err
+	}
+	return Encode(ctx, w, c, opts.To, opts.Encode)
+}
+
+// NewCanvas creates the canvas a text decoder draws on, sized from the
+// options and set up with their wrap mode and tab stops.
+func (o DecodeOptions) NewCanvas() *canvas.Canvas {
+	c := canvas.NewCanvas(o.CanvasWidth())
+	c.Wrap = o.Wrap
+	if o.Text.TabWidth > 0 {
+		c.SetTabInterval(o.Text.TabWidth)
+	}
+	return c
+}
+
+// CanvasWidth resolves the canvas width from the explicit width, the SAUCE
+// record and the default, in that order.
+func (o DecodeOptions) CanvasWidth() int {
+	if o.Width > 0 {
+		return o.Width
+	}
+	if o.Sauce != nil && o.Sauce.TInfo1 > 0 {
+		return int(o.Sauce.TInfo1)
+	}
+	return canvas.DefaultWidth
+}
+
+// DataSize returns the number of bytes of art data declared by the SAUCE
+// record, or 0 if unknown.
+func (o DecodeOptions) DataSize() int64 {
+	if o.Sauce == nil {
+		return 0
+	}
+	return int64(o.Sauce.FileSize)
+}
+
+// contextReader stops reading once the context is canceled, so that long
+// parses can be interrupted.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/sauce"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		opts Options
+		want string
+	}{
+		{
+			name: "ansi to plain",
+			in:   "\x1b[1;31mHi\x1b[0m there\r\n",
+			opts: Options{To: "plain"},
+			want: "Hi there\n",
+		},
+		{
+			name: "mirc to plain",
+			in:   "\x034,1red\x03 text",
+			opts: Options{To: "plain"},
+			want: "red text\n",
+		},
+		{
+			name: "explicit input format",
+			in:   "\x034x",
+			opts: Options{From: "mirc", To: "plain"},
+			want: "x\n",
+		},
+		{
+			name: "width wraps",
+			in:   "abcdef",
+			opts: Options{From: "plain", To: "plain", Decode: DecodeOptions{Width: 3}},
+			want: "abc\ndef\n",
+		},
+		{
+			name: "immediate wrap",
+			in:   "abc\r\ndef\r\n",
+			opts: Options{From: "plain", To: "plain", Decode: DecodeOptions{Width: 3, Wrap: canvas.ImmediateWrap}},
+			want: "abc\n\ndef\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Convert(context.Background(), strings.NewReader(tt.in), &out, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestRoundTrip checks that ANSI output reads back to the same cells, and
+// mIRC output, whose palette differs, to the same text.
+func TestRoundTrip(t *testing.T) {
+	in := "\x1b[31mred \x1b[1;32mgreen\x1b[0;44m blue bg\x1b[0m\r\nsecond line"
+	orig, _, err := Decode(context.Background(), strings.NewReader(in), "ansi", DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"ansi", "mirc"} {
+		var out bytes.Buffer
+		if err := Encode(context.Background(), &out, orig, format, EncodeOptions{}); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		got, _, err := Decode(context.Background(), &out, format, DecodeOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for r := 0; r < 2; r++ {
+			for col := 0; col < 20; col++ {
+				want, have := orig.Grid[r][col], got.Grid[r][col]
+				if have.Char != want.Char || format == "ansi" && (have.Fg != want.Fg || have.Bg != want.Bg || have.Bold != want.Bold) {
+					t.Errorf("%s: cell %d,%d = %+v, want %+v", format, r, col, have, want)
+				}
+			}
+		}
+	}
+}
+
+// TestTrueColorRoundTrip checks that PabloDraw 24-bit colors survive a
+// conversion to TundraDraw, which stores every cell's RGB colors.
+func TestTrueColorRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	in := "\x1b[1;255;128;0t\x1b[0;0;0;64tab\x1b[0mc"
+	orig, _, err := Decode(ctx, strings.NewReader(in), "ansi", DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := Encode(ctx, &out, orig, "tundra", EncodeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := Decode(ctx, &out, "", DecodeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for col := 0; col < 3; col++ {
+		want, have := orig.Grid[0][col], got.Grid[0][col]
+		if have.Char != want.Char || have.Fg != want.Fg || have.Bg != want.Bg {
+			t.Errorf("cell %d = %q %v on %v, want %q %v on %v", col, have.Char, have.Fg, have.Bg, want.Char, want.Fg, want.Bg)
+		}
+	}
+}
+
+// TestDecodeDataSize checks that every decoder stops where the SAUCE record
+// says the art ends.
+func TestDecodeDataSize(t *testing.T) {
+	tests := []struct{ from, in string }{
+		{"ansi", "\x1b[31mart\x1b[32mtrailer"},
+		{"mirc", "\x034art\x035trailer"},
+		{"pcboard", "@X1Fart@X2Etrailer"},
+		{"avatar", "\x16\x01\x1fart\x16\x01\x2etrailer"},
+		{"plain", "arttrailer"},
+	}
+	for _, tt := range tests {
+		size := strings.Index(tt.in, "art") + len("art")
+		opts := DecodeOptions{Sauce: &sauce.Record{FileSize: uint32(size)}}
+		c, _, err := Decode(context.Background(), strings.NewReader(tt.in), tt.from, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.from, err)
+		}
+		var text strings.Builder
+		for _, cell := range c.Grid[0][:8] {
+			text.WriteRune(cell.Char)
+		}
+		if got := strings.TrimRight(text.String(), " "); got != "art" {
+			t.Errorf("%s: decoded %q, want \"art\"", tt.from, got)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	ctx := context.Background()
+	if _, _, err := Decode(ctx, strings.NewReader("\x00\x01\x02"), "", DecodeOptions{}); err != ErrUnknownFormat {
+		t.Errorf("undetectable input: error = %v, want ErrUnknownFormat", err)
+	}
+	if _, _, err := Decode(ctx, strings.NewReader("x"), "nope", DecodeOptions{}); err == nil {
+		t.Error("unknown format: no error")
+	}
+	if _, _, err := Decode(ctx, strings.NewReader("x"), "html", DecodeOptions{}); err == nil {
+		t.Error("output-only format used as input: no error")
+	}
+	if err := Encode(ctx, io.Discard, canvas.NewCanvas(80), "adf", EncodeOptions{}); err == nil {
+		t.Error("input-only format used as output: no error")
+	}
+	if err := Convert(ctx, strings.NewReader("x"), io.Discard, Options{}); err == nil {
+		t.Error("missing output format: no error")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := Decode(canceled, strings.NewReader("\x1b[31mx"), "", DecodeOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled context: error = %v, want context.Canceled", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(Format{
+		Name:       "Test-Upper",
+		Extensions: []string{".testupper"},
+		Detect: func(head []byte) int {
+			if bytes.HasPrefix(head, []byte("UPPER:")) {
+				return 100
+			}
+			return 0
+		},
+		Decoder: DecoderFunc(func(ctx context.Context, r io.Reader, opts DecodeOptions) (*canvas.Canvas, error) {
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			c := opts.NewCanvas()
+			for _, ch := range strings.ToUpper(strings.TrimPrefix(string(data), "UPPER:")) {
+				c.SetCell(ch, canvas.DefaultFg, canvas.DefaultBg, false, false, false)
+			}
+			return c, nil
+		}),
+	})
+	if f := ForPath("x.testupper"); f == nil || f.Name != "test-upper" {
+		t.Fatalf("ForPath = %v, want the registered format", f)
+	}
+	var out bytes.Buffer
+	if err := Convert(context.Background(), strings.NewReader("UPPER:shout"), &out, Options{To: "plain"}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "SHOUT\n" {
+		t.Errorf("got %q, want %q", out.String(), "SHOUT\n")
+	}
+}
@@ -0,0 +1,137 @@
+package convert
+
+import (
+	"a2m2a/sauce"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// DetectSize is how much of the input is inspected when sniffing its format.
+const DetectSize = 64 * 1024
+
+// ErrUnknownFormat is returned when no registered format recognizes the input.
+var ErrUnknownFormat = errors.New("could not detect input format")
+
+// Detect scores every decodable format against the start of the input and
+// returns the most likely one together with its confidence. It returns a nil
+// format if nothing matched.
+func Detect(head []byte) (*Format, int) {
+	var best *Format
+	bestScore := 0
+	for _, f := range Formats() {
+		if f.Decoder == nil || f.Detect == nil {
+			continue
+		}
+		if score := f.Detect(head); score > bestScore {
+			best, bestScore = f, score
+		}
+	}
+	return best, bestScore
+}
+
+// DetectSauce returns the decodable format a SAUCE record identifies, or nil.
+func DetectSauce(rec *sauce.Record) *Format {
+	if rec == nil {
+		return nil
+	}
+	for _, f := range Formats() {
+		if f.Decoder != nil && f.Sauce != nil && f.Sauce(rec) {
+			return f
+		}
+	}
+	return nil
+}
+
+// Peek reads up to DetectSize bytes for format detection and returns them
+// together with a reader that replays them before the rest of r.
+func Peek(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, DetectSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// detectANSI counts well-formed CSI sequences (ESC [ params final-byte).
+func detectANSI(head []byte) int {
+	count := 0
+	for i := 0; i+1 < len(head); i++ {
+		if head[i] != 0x1b || head[i+1] != '[' {
+			continue
+		}
+		j := i + 2
+		for j < len(head) && (head[j] >= '0' && head[j] <= '9' || head[j] == ';' || head[j] == '?' || head[j] == '=') {
+			j++
+		}
+		if j < len(head) && head[j] >= 0x40 && head[j] <= 0x7e {
+			count++
+		}
+		i = j
+	}
+	return scoreCount(count)
+}
+
+// detectMIRC counts ^C color codes followed by a color number.
+func detectMIRC(head []byte) int {
+	count := 0
+	for i := 0; i+1 < len(head); i++ {
+		if head[i] == 0x03 && head[i+1] >= '0' && head[i+1] <= '9' {
+			count++
+		}
+	}
+	return scoreCount(count)
+}
+
+// detectPlain recognizes text: input made of printable characters and
+// line breaks. It scores low, so that any format with color codes wins.
+func detectPlain(head []byte) int {
+	if len(head) == 0 {
+		return 0
+	}
+	if i := bytes.IndexByte(head, '\x1a'); i >= 0 { // SAUCE separator.
+		head = head[:i]
+	}
+	controls := 0
+	for _, b := range head {
+		if b == 0 {
+			return 0
+		}
+		if b < 0x20 && b != '\t' && b != '\r' && b != '\n' && b != '\f' {
+			controls++
+		}
+	}
+	// CP437 art may use a few pictographs from the control range.
+	if 10*controls > len(head) {
+		return 0
+	}
+	return 10
+}
+
+// scoreCount turns a number of format signatures into a confidence score.
+// A single match is weak evidence; a handful is conclusive.
+func scoreCount(count int) int {
+	if count == 0 {
+		return 0
+	}
+	score := 40 + 10*count
+	if score > 100 {
+		score = 100
+	}
+	return score
+}
+
+// detectMagic returns a detector that recognizes any of the given file
+// signatures with certainty.
+func detectMagic(signatures ...string) func(head []byte) int {
+	return func(head []byte) int {
+		for _, sig := range signatures {
+			if bytes.HasPrefix(head, []byte(sig)) {
+				return 100
+			}
+		}
+		return 0
+	}
+}
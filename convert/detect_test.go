@@ -0,0 +1,92 @@
+package convert
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{"ansi", "ANSI", "mirc", "plain", "png"} {
+		f, err := Lookup(name)
+		if err != nil || f.Name != strings.ToLower(name) {
+			t.Errorf("Lookup(%q) = %v, %v", name, f, err)
+		}
+	}
+	if _, err := Lookup("nope"); err == nil || !strings.Contains(err.Error(), "ansi") {
+		t.Errorf("Lookup(nope) error = %v, want a list of known formats", err)
+	}
+}
+
+func TestForPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"art.ans", "ansi"},
+		{"ART.ANS", "ansi"},
+		{"dir.d/art.mrc", "mirc"},
+		{"art.irc", "mirc"},
+		{"notes.txt", "plain"},
+		{"out.png", "png"},
+		{"art", ""},
+		{"art.unknown", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if f := ForPath(tt.path); f != nil {
+			got = f.Name
+		}
+		if got != tt.want {
+			t.Errorf("ForPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{"ansi", "\x1b[0;1;31mHello\x1b[0m", "ansi"},
+		{"ansi with a late color code", strings.Repeat("x", 8000) + "\x1b[31m", "ansi"},
+		{"ansi cursor only", "\x1b[2J\x1b[10C", "ansi"},
+		{"mirc", "\x034,1Hello\x03", "mirc"},
+		{"mirc over a lone escape", "\x1b\x031a\x032b\x033c", "mirc"},
+		{"plain", "Hello, world\r\n", "plain"},
+		{"png", "\x89PNG\r\n\x1a\n....", "png"},
+		{"artworx", "\x01" + strings.Repeat("\x00\x2a\x3f", 64) + strings.Repeat("\x00", 4096), "adf"},
+		{"binary", "\x00\x01\x02\x03", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if f, _ := Detect([]byte(tt.head)); f != nil {
+			got = f.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s: Detect = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScoreCount(t *testing.T) {
+	tests := []struct{ count, want int }{{0, 0}, {1, 50}, {3, 70}, {6, 100}, {100, 100}}
+	for _, tt := range tests {
+		if got := scoreCount(tt.count); got != tt.want {
+			t.Errorf("scoreCount(%d) = %d, want %d", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestPeek(t *testing.T) {
+	input := strings.Repeat("a", DetectSize+10)
+	head, r, err := Peek(strings.NewReader(input))
+	if err != nil || len(head) != DetectSize {
+		t.Fatalf("Peek = %d bytes, %v", len(head), err)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != input {
+		t.Errorf("the reader returned by Peek does not replay the input")
+	}
+}
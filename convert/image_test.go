@@ -0,0 +1,106 @@
+package convert
+
+import (
+	"a2m2a/ansi"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// testImage is red on the left and blue on the right.
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			c := ansi.AnsiPalette[1]
+			if x >= 8 {
+				c = ansi.AnsiPalette[4]
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestDecodeImage(t *testing.T) {
+	encoders := []struct {
+		name   string
+		encode func(io.Writer, image.Image) error
+	}{
+		{"png", png.Encode},
+		{"gif", func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) }},
+		{"jpeg", func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, &jpeg.Options{Quality: 100}) }},
+	}
+	for _, enc := range encoders {
+		var buf bytes.Buffer
+		if err := enc.encode(&buf, testImage()); err != nil {
+			t.Fatal(err)
+		}
+		c, f, err := Decode(context.Background(), &buf, "", DecodeOptions{Width: 4})
+		if err != nil {
+			t.Fatalf("%s: %v", enc.name, err)
+		}
+		if f.Name != enc.name {
+			t.Errorf("%s: detected as %s", enc.name, f.Name)
+		}
+		if c.Width() != 4 || len(c.Grid) != 1 {
+			t.Fatalf("%s: got %dx%d cells, want 4x1", enc.name, c.Width(), len(c.Grid))
+		}
+		if left, right := c.Grid[0][0], c.Grid[0][3]; left.Fg != ansi.AnsiPalette[1] || right.Fg != ansi.AnsiPalette[4] {
+			t.Errorf("%s: colors %v and %v, want red and blue", enc.name, left.Fg, right.Fg)
+		}
+	}
+}
+
+// pngHeader returns a PNG signature and header claiming the given size. The
+// image data is missing, as it would never be read.
+func pngHeader(width, height uint32) []byte {
+	var ihdr [17]byte
+	copy(ihdr[:], "IHDR")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	ihdr[12] = 8 // Bit depth.
+	ihdr[13] = 6 // RGBA.
+
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = binary.BigEndian.AppendUint32(b, 13)
+	b = append(b, ihdr[:]...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(ihdr[:]))
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	tests := []struct {
+		width, height uint32
+		wantErr       error
+	}{
+		{100000, 100000, ErrImageTooLarge},
+		{MaxImagePixels + 1, 1, ErrImageTooLarge},
+		{100, 100, io.ErrUnexpectedEOF}, // Within budget, so the data is read.
+	}
+	for _, tt := range tests {
+		_, _, err := Decode(context.Background(), bytes.NewReader(pngHeader(tt.width, tt.height)), "png", DecodeOptions{})
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%dx%d: got %v, want %v", tt.width, tt.height, err, tt.wantErr)
+		}
+	}
+
+	// Images in budget are still decoded from the start of the stream.
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2)))
+	c, _, err := Decode(context.Background(), &buf, "png", DecodeOptions{Width: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cell := c.Grid[0][0]; cell.Fg != (color.RGBA{A: 0xFF}) {
+		t.Errorf("black image decoded as %v", cell.Fg)
+	}
+}
@@ -0,0 +1,62 @@
+// Package cp437 maps between code page 437 bytes and Unicode, including the
+// pictographs DOS displays for the control range (☺, ♥, ♪, ...), which
+// charmap.CodePage437 decodes to control characters.
+package cp437
+
+import "golang.org/x/text/encoding/charmap"
+
+// controlGlyphs are the glyphs shown for bytes 0x00-0x1F.
+var controlGlyphs = [32]rune{
+	' ', '☺', '☻', '♥', '♦', '♣', '♠', '•', '◘', '○', '◙', '♂', '♀', '♪', '♫', '☼',
+	'►', '◄', '↕', '‼', '¶', '§', '▬', '↨', '↑', '↓', '→', '←', '∟', '↔', '▲', '▼',
+}
+
+// houseGlyph is the glyph shown for 0x7F.
+const houseGlyph = '⌂'
+
+// reverse maps the control-range glyphs back to their bytes.
+var reverse = func() map[rune]byte {
+	m := make(map[rune]byte, len(controlGlyphs)+1)
+	for i, r := range controlGlyphs[1:] {
+		m[r] = byte(i + 1)
+	}
+	m[houseGlyph] = 0x7F
+	return m
+}()
+
+// Decode returns the glyph DOS displays for a CP437 byte. Unlike
+// charmap.CodePage437, bytes below 0x20 become pictographs, which is what
+// binary formats (BinaryText, XBin, ...) mean by them. NUL decodes to a space.
+func Decode(b byte) rune {
+	switch {
+	case b < 0x20:
+		return controlGlyphs[b]
+	case b == 0x7F:
+		return houseGlyph
+	}
+	return charmap.CodePage437.DecodeByte(b)
+}
+
+// ToUnicode replaces control characters left in decoded text by their CP437
+// pictographs and leaves every other rune alone.
+func ToUnicode(r rune) rune {
+	switch {
+	case r >= 0 && r < 0x20:
+		return controlGlyphs[r]
+	case r == 0x7F:
+		return houseGlyph
+	}
+	return r
+}
+
+// Encode returns the CP437 byte for a rune, accepting both the pictograph and
+// the control-character form of the low range.
+func Encode(r rune) (byte, bool) {
+	if r >= 0 && r < 0x20 || r == 0x7F {
+		return byte(r), true
+	}
+	if b, ok := reverse[r]; ok {
+		return b, true
+	}
+	return charmap.CodePage437.EncodeRune(r)
+}
@@ -0,0 +1,74 @@
+package cp437
+
+import "testing"
+
+func TestRoundTrip(t *testing.T) {
+	for i := 1; i < 256; i++ {
+		r := Decode(byte(i))
+		b, ok := Encode(r)
+		if !ok || b != byte(i) {
+			t.Errorf("Encode(Decode(%#02x) = %q) = %#02x, %v", i, r, b, ok)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		b    byte
+		want rune
+	}{
+		{0x00, ' '},
+		{0x01, '☺'},
+		{0x0A, '◙'},
+		{0x1A, '→'},
+		{0x1B, '←'},
+		{'A', 'A'},
+		{0x7F, '⌂'},
+		{0xB0, '░'},
+		{0xDB, '█'},
+		{0xFF, ' '},
+	}
+	for _, tt := range tests {
+		if got := Decode(tt.b); got != tt.want {
+			t.Errorf("Decode(%#02x) = %q, want %q", tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want byte
+		ok   bool
+	}{
+		{'☺', 0x01, true},
+		{'\x01', 0x01, true},
+		{'\n', 0x0A, true},
+		{'⌂', 0x7F, true},
+		{'█', 0xDB, true},
+		{'é', 0x82, true},
+		{'€', 0, false},
+		{'😀', 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Encode(tt.r)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("Encode(%q) = %#02x, %v, want %#02x, %v", tt.r, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct{ r, want rune }{
+		{'\x03', '♥'},
+		{'\x00', ' '},
+		{'\x7f', '⌂'},
+		{'a', 'a'},
+		{'é', 'é'},
+	}
+	for _, tt := range tests {
+		if got := ToUnicode(tt.r); got != tt.want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", tt.r, got, tt.want)
+		}
+	}
+}
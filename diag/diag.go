@@ -0,0 +1,82 @@
+// Package diag collects the problems parsers find in their input: unknown
+// or malformed sequences that were skipped or guessed at instead of failing
+// the whole file.
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells how much a problem may affect the result.
+type Severity int
+
+const (
+	// Warning is a sequence that is valid but not supported, or that was
+	// guessed at; the art may still look right.
+	Warning Severity = iota
+	// Error is a malformed or truncated sequence; the art likely looks
+	// wrong.
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic is a single problem.
+type Diagnostic struct {
+	// Offset is the byte offset of the start of the offending sequence.
+	Offset int64
+	// Row and Col are the canvas cursor position at that point, from 0.
+	Row, Col int
+	Severity Severity
+	Message  string
+}
+
+// String formats the diagnostic as "row:col (byte n): severity: message",
+// with 1-based rows and columns.
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d (byte %d): %s: %s", d.Row+1, d.Col+1, d.Offset, d.Severity, d.Message)
+}
+
+// Collector gathers diagnostics. A nil *Collector discards them, so parsers
+// can report unconditionally.
+type Collector struct {
+	list []Diagnostic
+}
+
+// Add records a diagnostic.
+func (c *Collector) Add(d Diagnostic) {
+	if c != nil {
+		c.list = append(c.list, d)
+	}
+}
+
+// Diagnostics returns the diagnostics in the order they were recorded.
+func (c *Collector) Diagnostics() []Diagnostic {
+	if c == nil {
+		return nil
+	}
+	return c.list
+}
+
+// Err returns an error describing the first diagnostics, or nil if there are
+// none.
+func (c *Collector) Err() error {
+	if c == nil || len(c.list) == 0 {
+		return nil
+	}
+	const shown = 3
+	var msgs []string
+	for _, d := range c.list[:min(shown, len(c.list))] {
+		msgs = append(msgs, d.String())
+	}
+	if more := len(c.list) - shown; more > 0 {
+		msgs = append(msgs, fmt.Sprintf("and %d more", more))
+	}
+	return fmt.Errorf("%d problem(s) in input: %s", len(c.list), strings.Join(msgs, "; "))
+}
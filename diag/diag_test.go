@@ -0,0 +1,59 @@
+package diag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		d    Diagnostic
+		want string
+	}{
+		{Diagnostic{Offset: 17, Row: 0, Col: 4, Severity: Warning, Message: "unsupported"}, "1:5 (byte 17): warning: unsupported"},
+		{Diagnostic{Offset: 0, Row: 9, Col: 0, Severity: Error, Message: "truncated"}, "10:1 (byte 0): error: truncated"},
+	}
+	for _, tt := range tests {
+		if got := tt.d.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestCollector(t *testing.T) {
+	var none *Collector
+	none.Add(Diagnostic{Message: "dropped"})
+	if none.Diagnostics() != nil || none.Err() != nil {
+		t.Error("nil collector kept a diagnostic")
+	}
+
+	tests := []struct {
+		name  string
+		count int
+		want  string
+	}{
+		{"empty", 0, ""},
+		{"one", 1, "1 problem(s) in input: 1:1 (byte 0): error: problem 0"},
+		{"three", 3, "3 problem(s) in input: 1:1 (byte 0): error: problem 0; 1:1 (byte 1): error: problem 1; 1:1 (byte 2): error: problem 2"},
+		{"more", 5, "and 2 more"},
+	}
+	for _, tt := range tests {
+		c := &Collector{}
+		for i := range tt.count {
+			c.Add(Diagnostic{Offset: int64(i), Severity: Error, Message: "problem " + string(rune('0'+i))})
+		}
+		if got := len(c.Diagnostics()); got != tt.count {
+			t.Errorf("%s: %d diagnostics, want %d", tt.name, got, tt.count)
+		}
+		err := c.Err()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: Err() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("%s: Err() = %v, want it to end in %q", tt.name, err, tt.want)
+		}
+	}
+}
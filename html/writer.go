@@ -0,0 +1,190 @@
+// Package html exports a canvas as selectable text: a <pre> block with
+// merged <span> runs carrying the colors and attributes.
+package html
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/renderer"
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// Options controls the generated HTML.
+type Options struct {
+	// Fragment writes only the <style> and <pre> blocks instead of a
+	// standalone page.
+	Fragment bool
+	// Classes generates one CSS class per distinct style instead of inline
+	// style attributes, which is much smaller for large pieces.
+	Classes bool
+	// EmbedFont embeds the renderer's monospace font as a web font, so the
+	// page looks the same regardless of the fonts installed.
+	EmbedFont bool
+	// Blink shows cells with the blink/iCE attribute blinking, as on a
+	// terminal without iCE colors.
+	Blink bool
+	// Title is the page title of standalone pages.
+	Title string
+}
+
+// style is the visual state of a run of cells.
+type style struct {
+	fg, bg    color.RGBA
+	bold      bool
+	underline bool
+	blink     bool
+}
+
+// Writer converts a canvas to HTML.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+	opts   Options
+}
+
+// NewWriter creates a new HTML writer.
+func NewWriter(c *canvas.Canvas, w io.Writer, opts Options) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+		opts:   opts,
+	}
+}
+
+// Write generates the HTML output from the canvas.
+func (w *Writer) Write() error {
+	base := style{fg: canvas.DefaultFg, bg: canvas.DefaultBg}
+	body, classes := w.renderRows(base)
+
+	bw := bufio.NewWriter(w.writer)
+	if !w.opts.Fragment {
+		title := w.opts.Title
+		if title == "" {
+			title = "a2m2a"
+		}
+		fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", escape(title))
+	}
+	w.writeStyle(bw, base, classes)
+	if !w.opts.Fragment {
+		bw.WriteString("</head>\n<body>\n")
+	}
+	bw.WriteString(`<pre class="a2m2a">`)
+	bw.WriteString(body)
+	bw.WriteString("</pre>\n")
+	if !w.opts.Fragment {
+		bw.WriteString("</body>\n</html>\n")
+	}
+	return bw.Flush()
+}
+
+// renderRows converts the canvas into the contents of the <pre> block. In
+// class mode it also returns the styles in order of first use.
+func (w *Writer) renderRows(base style) (string, []style) {
+	var out strings.Builder
+	classIndex := map[style]int{}
+	var classes []style
+
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	for r := 0; r <= maxRow; r++ {
+		row := w.canvas.Grid[r]
+		lastCharIndex := -1
+		for i := len(row) - 1; i >= 0; i-- {
+			if row[i].Char != ' ' || row[i].Bg != canvas.DefaultBg {
+				lastCharIndex = i
+				break
+			}
+		}
+
+		// Merge consecutive cells with the same style into one span.
+		for i := 0; i <= lastCharIndex; {
+			st := w.styleOf(row[i])
+			var text strings.Builder
+			for i <= lastCharIndex && w.styleOf(row[i]) == st {
+				text.WriteString(escape(string(cp437.ToUnicode(row[i].Char))))
+				i++
+			}
+
+			if st == base {
+				out.WriteString(text.String())
+				continue
+			}
+			if w.opts.Classes {
+				idx, ok := classIndex[st]
+				if !ok {
+					idx = len(classes)
+					classIndex[st] = idx
+					classes = append(classes, st)
+				}
+				fmt.Fprintf(&out, `<span class="s%d">%s</span>`, idx, text.String())
+			} else {
+				fmt.Fprintf(&out, `<span style="%s">%s</span>`, st.css(base), text.String())
+			}
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), classes
+}
+
+func (w *Writer) styleOf(cell canvas.Cell) style {
+	return style{
+		fg:        cell.Fg,
+		bg:        cell.Bg,
+		bold:      cell.Bold,
+		underline: cell.Underline,
+		blink:     w.opts.Blink && cell.Ice,
+	}
+}
+
+// writeStyle emits the stylesheet: the <pre> defaults, the optional web font,
+// the blink animation and, in class mode, one rule per style.
+func (w *Writer) writeStyle(bw *bufio.Writer, base style, classes []style) {
+	bw.WriteString("<style>\n")
+	family := "monospace"
+	if w.opts.EmbedFont {
+		fmt.Fprintf(bw, "@font-face { font-family: \"a2m2a\"; src: url(data:font/ttf;base64,%s) format(\"truetype\"); }\n",
+			base64.StdEncoding.EncodeToString(renderer.FontData))
+		family = `"a2m2a", monospace`
+	}
+	fmt.Fprintf(bw, "pre.a2m2a { color: %s; background: %s; font-family: %s; line-height: 1; display: inline-block; }\n",
+		hexColor(base.fg), hexColor(base.bg), family)
+	if w.opts.Blink {
+		bw.WriteString("@keyframes a2m2a-blink { 50% { color: transparent; } }\n")
+	}
+	for i, st := range classes {
+		fmt.Fprintf(bw, "pre.a2m2a .s%d { %s }\n", i, st.css(base))
+	}
+	bw.WriteString("</style>\n")
+}
+
+// css returns the declarations that differ from the <pre> defaults.
+func (s style) css(base style) string {
+	var decls []string
+	if s.fg != base.fg {
+		decls = append(decls, "color: "+hexColor(s.fg))
+	}
+	if s.bg != base.bg {
+		decls = append(decls, "background: "+hexColor(s.bg))
+	}
+	if s.bold {
+		decls = append(decls, "font-weight: bold")
+	}
+	if s.underline {
+		decls = append(decls, "text-decoration: underline")
+	}
+	if s.blink {
+		decls = append(decls, "animation: a2m2a-blink 1s step-end infinite")
+	}
+	return strings.Join(decls, "; ")
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// escape makes text safe to embed in HTML.
+var escape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace
@@ -0,0 +1,201 @@
+package html
+
+import (
+	"a2m2a/canvas"
+	"bytes"
+	stdhtml "html"
+	"image/color"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var red = color.RGBA{R: 0xAA, A: 0xFF}
+
+// cell is one character of a test canvas.
+type cell struct {
+	char      rune
+	fg, bg    color.RGBA
+	bold, ice bool
+	underline bool
+}
+
+func plainCells(s string) []cell {
+	var cells []cell
+	for _, r := range s {
+		cells = append(cells, cell{char: r, fg: canvas.DefaultFg, bg: canvas.DefaultBg})
+	}
+	return cells
+}
+
+func newCanvas(rows ...[]cell) *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	for i, row := range rows {
+		if i > 0 {
+			c.NewLine()
+		}
+		for _, ce := range row {
+			c.Put(canvas.Cell{Char: ce.char, Fg: ce.fg, Bg: ce.bg, Bold: ce.bold, Ice: ce.ice, Underline: ce.underline})
+		}
+	}
+	return c
+}
+
+// pre returns the contents of the <pre> block.
+func pre(t *testing.T, out string) string {
+	t.Helper()
+	_, body, ok := strings.Cut(out, `<pre class="a2m2a">`)
+	if !ok {
+		t.Fatalf("no <pre> block in %q", out)
+	}
+	body, _, ok = strings.Cut(body, "</pre>")
+	if !ok {
+		t.Fatalf("unterminated <pre> block in %q", out)
+	}
+	return body
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]cell
+		opts Options
+		want string
+	}{
+		{
+			name: "plain",
+			rows: [][]cell{plainCells("ab  "), plainCells(" c")},
+			want: "ab\n c\n",
+		},
+		{
+			name: "escaped",
+			rows: [][]cell{plainCells(`<a href="x">&`)},
+			want: "&lt;a href=&quot;x&quot;&gt;&amp;\n",
+		},
+		{
+			name: "CP437 controls",
+			rows: [][]cell{plainCells("\x01\x03")},
+			want: "☺♥\n",
+		},
+		{
+			name: "merged spans",
+			rows: [][]cell{append(plainCells("a"),
+				cell{char: 'b', fg: red, bg: canvas.DefaultBg},
+				cell{char: 'c', fg: red, bg: canvas.DefaultBg},
+				cell{char: 'd', fg: red, bg: canvas.DefaultBg, bold: true})},
+			want: `a<span style="color: #aa0000">bc</span><span style="color: #aa0000; font-weight: bold">d</span>` + "\n",
+		},
+		{
+			name: "trailing background kept",
+			rows: [][]cell{append(plainCells("a"), cell{char: ' ', fg: canvas.DefaultFg, bg: red})},
+			want: `a<span style="background: #aa0000"> </span>` + "\n",
+		},
+		{
+			name: "underline",
+			rows: [][]cell{{{char: 'u', fg: canvas.DefaultFg, bg: canvas.DefaultBg, underline: true}}},
+			want: `<span style="text-decoration: underline">u</span>` + "\n",
+		},
+		{
+			name: "blink off",
+			rows: [][]cell{{{char: 'b', fg: canvas.DefaultFg, bg: canvas.DefaultBg, ice: true}}},
+			want: "b\n",
+		},
+		{
+			name: "blink on",
+			rows: [][]cell{{{char: 'b', fg: canvas.DefaultFg, bg: canvas.DefaultBg, ice: true}}},
+			opts: Options{Blink: true},
+			want: `<span style="animation: a2m2a-blink 1s step-end infinite">b</span>` + "\n",
+		},
+		{
+			name: "classes",
+			rows: [][]cell{
+				{{char: 'x', fg: red, bg: canvas.DefaultBg}, {char: 'y', fg: canvas.DefaultFg, bg: red}},
+				{{char: 'z', fg: red, bg: canvas.DefaultBg}},
+			},
+			opts: Options{Classes: true},
+			want: `<span class="s0">x</span><span class="s1">y</span>` + "\n" + `<span class="s0">z</span>` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := NewWriter(newCanvas(tt.rows...), &out, tt.opts).Write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := pre(t, out.String()); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteDocument(t *testing.T) {
+	c := newCanvas([]cell{{char: 'x', fg: red, bg: canvas.DefaultBg}})
+	tests := []struct {
+		name    string
+		opts    Options
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "page",
+			opts:    Options{Title: "<art>"},
+			want:    []string{"<!DOCTYPE html>", "<title>&lt;art&gt;</title>", "</html>\n", "font-family: monospace"},
+			notWant: []string{"@font-face", "@keyframes"},
+		},
+		{
+			name:    "fragment",
+			opts:    Options{Fragment: true},
+			want:    []string{"<style>", "<pre"},
+			notWant: []string{"<html>", "<title>", "<body>"},
+		},
+		{
+			name: "classes",
+			opts: Options{Classes: true, Fragment: true},
+			want: []string{"pre.a2m2a .s0 { color: #aa0000 }"},
+		},
+		{
+			name: "embedded font and blink",
+			opts: Options{EmbedFont: true, Blink: true},
+			want: []string{"@font-face { font-family: \"a2m2a\"; src: url(data:font/ttf;base64,", `font-family: "a2m2a", monospace`, "@keyframes a2m2a-blink"},
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := NewWriter(c, &out, tt.opts).Write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s: output lacks %q", tt.name, s)
+			}
+		}
+		for _, s := range tt.notWant {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("%s: output contains %q", tt.name, s)
+			}
+		}
+	}
+}
+
+// TestTextRoundTrip checks that the page text, as a browser would show it,
+// is the canvas text.
+func TestTextRoundTrip(t *testing.T) {
+	lines := []string{"  ▄▄█▀ <&> \"quoted\"", "", "x y ░▒▓"}
+	var rows [][]cell
+	for i, line := range lines {
+		cells := plainCells(line)
+		for j := range cells {
+			cells[j].fg = color.RGBA{uint8(i * 40), uint8(j * 10), 0x80, 0xFF}
+		}
+		rows = append(rows, cells)
+	}
+	for _, classes := range []bool{false, true} {
+		var out bytes.Buffer
+		if err := NewWriter(newCanvas(rows...), &out, Options{Classes: classes}).Write(); err != nil {
+			t.Fatal(err)
+		}
+		text := stdhtml.UnescapeString(regexp.MustCompile(`<[^>]*>`).ReplaceAllString(pre(t, out.String()), ""))
+		if want := strings.Join(lines, "\n") + "\n"; text != want {
+			t.Errorf("classes %v: text\n%q\nwant\n%q", classes, text, want)
+		}
+	}
+}
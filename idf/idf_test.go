@@ -0,0 +1,142 @@
+package idf
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// palette is a 16-color palette of 6-bit DAC values.
+var palette = func() []byte {
+	p := make([]byte, paletteSize)
+	for i := range p {
+		p[i] = byte(i) % 64
+	}
+	return p
+}()
+
+// file builds an iCE Draw file width columns wide around body.
+func file(width int, body []byte) []byte {
+	data := []byte(Magic)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = binary.LittleEndian.AppendUint16(data, uint16(width-1))
+	data = binary.LittleEndian.AppendUint16(data, 0)
+	data = append(data, body...)
+	data = append(data, make([]byte, fontSize)...)
+	return append(data, palette...)
+}
+
+// run is a compressed run of count cells.
+func run(count int, ch, attr byte) []byte {
+	return append(binary.LittleEndian.AppendUint16([]byte{1, 0}, uint16(count)), ch, attr)
+}
+
+func TestParse(t *testing.T) {
+	attrs := xbin.Attributes{Palette: xbin.DecodePalette(palette), ICE: true}
+	tests := []struct {
+		name  string
+		width int
+		body  []byte
+		want  [][]canvas.Cell
+	}{
+		{
+			name:  "cells",
+			width: 2,
+			body:  []byte{'a', 0x1F, 'b', 0x9E},
+			want:  [][]canvas.Cell{{attrs.Cell('a', 0x1F), attrs.Cell('b', 0x9E)}},
+		},
+		{
+			name:  "run wraps",
+			width: 2,
+			body:  append(run(3, 'x', 0x07), 'y', 0x07),
+			want: [][]canvas.Cell{
+				{attrs.Cell('x', 0x07), attrs.Cell('x', 0x07)},
+				{attrs.Cell('x', 0x07), attrs.Cell('y', 0x07)},
+			},
+		},
+		{
+			name:  "truncated run is a cell",
+			width: 2,
+			body:  []byte{'a', 0x07, 1, 0},
+			want:  [][]canvas.Cell{{attrs.Cell('a', 0x07), attrs.Cell(1, 0)}},
+		},
+	}
+	for _, tt := range tests {
+		c, err := NewParser(bytes.NewReader(file(tt.width, tt.body))).Parse()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if c.Width() != tt.width {
+			t.Errorf("%s: width = %d, want %d", tt.name, c.Width(), tt.width)
+		}
+		for r, row := range tt.want {
+			for i, want := range row {
+				if got := c.Grid[r][i]; got != want {
+					t.Errorf("%s: cell %d,%d = %+v, want %+v", tt.name, r, i, got, want)
+				}
+			}
+		}
+		if c.Font == nil || len(c.Palette) != 16 {
+			t.Errorf("%s: font or palette not attached", tt.name)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	var many []byte
+	for len(many) < 6*(canvas.MaxCells/0xFFFF+1) {
+		many = append(many, run(0xFFFF, 'a', 0x07)...)
+	}
+	tests := []struct {
+		name     string
+		data     []byte
+		tooLarge bool
+	}{
+		{"truncated", []byte(Magic), false},
+		{"not idf", append([]byte("\x042.0"), file(1, nil)[4:]...), false},
+		{"wide", file(MaxWidth+1, nil), true},
+		{"runs past the cell limit", file(80, many), true},
+	}
+	for _, tt := range tests {
+		_, err := NewParser(bytes.NewReader(tt.data)).Parse()
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		if got := errors.Is(err, canvas.ErrTooLarge); got != tt.tooLarge {
+			t.Errorf("%s: errors.Is(%v, ErrTooLarge) = %v, want %v", tt.name, err, got, tt.tooLarge)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want []string
+	}{
+		{"clean", append([]byte{'a', 0x07}, run(3, 'b', 0x1f)...), nil},
+		{"truncated run", []byte{'a', 0x07, 1, 0, 3, 0}, []string{"1:2 (byte 14): error: truncated run at end of data"}},
+		{"odd byte", []byte{'a', 0x07, 'b'}, []string{"1:2 (byte 14): error: odd byte at end of data"}},
+	}
+	for _, tt := range tests {
+		p := NewParser(bytes.NewReader(file(80, tt.body)))
+		p.Diagnostics = &diag.Collector{}
+		if _, err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
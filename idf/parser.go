@@ -0,0 +1,114 @@
+// Package idf reads iCE Draw (.idf) files: run-length compressed binary
+// text followed by the font and palette the art was drawn with.
+package idf
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/xbin"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic starts every iCE Draw file: an EOT byte and the format version.
+// Version 1.3 files share the layout.
+const (
+	Magic   = "\x041.4"
+	Magic13 = "\x041.3"
+)
+
+const (
+	headerSize  = 12
+	fontSize    = 256 * 16
+	paletteSize = 16 * 3
+)
+
+// MaxWidth is the widest art Parse accepts. iCE Draw itself draws 80
+// columns; the header allows 65536.
+const MaxWidth = 1024
+
+// Parser reads an iCE Draw stream.
+type Parser struct {
+	reader io.Reader
+
+	// Diagnostics, if not nil, collects the truncated runs and cells found.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new iCE Draw parser.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{reader: r}
+}
+
+// Parse reads the whole file into a new canvas, with the embedded palette and
+// font attached to it. iCE Draw always uses iCE colors.
+func (p *Parser) Parse() (*canvas.Canvas, error) {
+	data, err := io.ReadAll(p.reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < headerSize+fontSize+paletteSize {
+		return nil, errors.New("iCE Draw file is truncated")
+	}
+	if magic := string(data[:4]); magic != Magic && magic != Magic13 {
+		return nil, errors.New("not an iCE Draw file")
+	}
+	// The magic is followed by the inclusive corners x1, y1, x2, y2.
+	x1 := binary.LittleEndian.Uint16(data[4:])
+	x2 := binary.LittleEndian.Uint16(data[8:])
+	if x2 < x1 {
+		return nil, errors.New("iCE Draw file has zero width")
+	}
+	if width := int(x2-x1) + 1; width > MaxWidth {
+		return nil, fmt.Errorf("%w: iCE Draw file is %d columns wide, at most %d supported", canvas.ErrTooLarge, width, MaxWidth)
+	}
+
+	tail := len(data) - fontSize - paletteSize
+	pal := xbin.DecodePalette(data[tail+fontSize:])
+	c := canvas.NewCanvas(int(x2-x1) + 1)
+	c.Font = canvas.NewFont(16, data[tail:tail+fontSize])
+	c.Palette = pal
+	attrs := xbin.Attributes{Palette: pal, ICE: true}
+
+	// A character 1 with attribute 0 introduces a run: a 16-bit count and
+	// the character/attribute pair to repeat. Runs expand a few bytes into
+	// many cells, so the total is checked against the canvas limit up front.
+	body := data[headerSize:tail]
+	cells := 0
+	for i := 0; i+1 < len(body); i += 2 {
+		count := 1
+		cell := attrs.Cell(body[i], body[i+1])
+		if body[i] == 1 && body[i+1] == 0 {
+			if i+5 >= len(body) {
+				p.report(c, headerSize+i, "truncated run at end of data")
+			} else {
+				count = int(binary.LittleEndian.Uint16(body[i+2:]))
+				cell = attrs.Cell(body[i+4], body[i+5])
+				i += 4
+			}
+		}
+		if cells += count; cells > canvas.MaxCells {
+			return nil, fmt.Errorf("%w: iCE Draw data expands to more than %d cells", canvas.ErrTooLarge, canvas.MaxCells)
+		}
+		for j := 0; j < count; j++ {
+			c.Put(cell)
+		}
+	}
+	if len(body)%2 != 0 {
+		p.report(c, tail-1, "odd byte at end of data")
+	}
+	return c, nil
+}
+
+// report records an error at offset, at the cursor of c.
+func (p *Parser) report(c *canvas.Canvas, offset int, msg string) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   int64(offset),
+		Row:      c.Cursor.Row,
+		Col:      c.Cursor.Col,
+		Severity: diag.Error,
+		Message:  msg,
+	})
+}
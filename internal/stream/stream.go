@@ -0,0 +1,68 @@
+// Package stream holds the reader shared by the parsers of command streams,
+// where a control byte is followed by a fixed number of argument bytes.
+package stream
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reader is a buffered reader that counts the bytes it has consumed, so that
+// parsers can report where a problem starts.
+type Reader struct {
+	r      *bufio.Reader
+	offset int64
+}
+
+// NewReader creates a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Offset returns the number of bytes consumed so far.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+// Read implements io.Reader, for data read in bulk rather than by command.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// ReadByte reads the next byte.
+func (r *Reader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.offset++
+	}
+	return b, err
+}
+
+// ReadN reads the next n bytes, such as the arguments of a command.
+func (r *Reader) ReadN(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := io.ReadFull(r.r, buf)
+	r.offset += int64(read)
+	return buf, err
+}
+
+// Peek returns the next n bytes without consuming them, or fewer at the end
+// of the input.
+func (r *Reader) Peek(n int) []byte {
+	b, _ := r.r.Peek(n)
+	return b
+}
+
+// Discard consumes the next n bytes, which must have been peeked.
+func (r *Reader) Discard(n int) {
+	discarded, _ := r.r.Discard(n)
+	r.offset += int64(discarded)
+}
+
+// IsEOF reports whether err is the end of the input, including one in the
+// middle of a command.
+func IsEOF(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader("abcdefg"))
+	if b, err := r.ReadByte(); b != 'a' || err != nil {
+		t.Errorf("ReadByte = %q, %v, want 'a'", b, err)
+	}
+	if got, err := r.ReadN(2); string(got) != "bc" || err != nil {
+		t.Errorf("ReadN = %q, %v, want \"bc\"", got, err)
+	}
+	if got := r.Peek(2); string(got) != "de" {
+		t.Errorf("Peek = %q, want \"de\"", got)
+	}
+	if r.Offset() != 3 {
+		t.Errorf("Offset after Peek = %d, want 3", r.Offset())
+	}
+	r.Discard(1)
+	buf := make([]byte, 1)
+	if n, err := r.Read(buf); n != 1 || buf[0] != 'e' || err != nil {
+		t.Errorf("Read = %d %q, %v, want 1 'e'", n, buf[:n], err)
+	}
+	if got := r.Peek(5); string(got) != "fg" {
+		t.Errorf("Peek at the end = %q, want \"fg\"", got)
+	}
+	if _, err := r.ReadN(3); err != io.ErrUnexpectedEOF {
+		t.Errorf("short ReadN error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if r.Offset() != 7 {
+		t.Errorf("Offset at the end = %d, want 7", r.Offset())
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte at the end error = %v, want io.EOF", err)
+	}
+	if r.Offset() != 7 {
+		t.Errorf("Offset after EOF = %d, want 7", r.Offset())
+	}
+}
+
+func TestIsEOF(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{errors.New("broken"), false},
+	}
+	for _, tt := range tests {
+		if got := IsEOF(tt.err); got != tt.want {
+			t.Errorf("IsEOF(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
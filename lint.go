@@ -0,0 +1,83 @@
+package main
+
+import (
+	"a2m2a/convert"
+	"a2m2a/diag"
+	"a2m2a/sauce"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// lintCommand runs the `a2m2a lint` subcommand, which lists the unsupported
+// and malformed sequences in art files. Files in formats whose parser
+// reports no problems are listed as not checked. It exits with status 1 if
+// any file has problems or cannot be read.
+func lintCommand(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	from := fs.String("from", "", "Input format (default: auto-detect)")
+	errorsOnly := fs.Bool("errors", false, "Report only errors, not warnings")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: a2m2a lint [flags] <files, directories or globs>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	jobs, err := collectBatchJobs(fs.Args())
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	failed := false
+	for _, job := range jobs {
+		diags, format, err := lintFile(job.inPath, *from)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", job.inPath, err)
+			failed = true
+			continue
+		}
+		if !format.Diagnostics {
+			fmt.Printf("%s: not checked: %s input is not linted\n", job.inPath, format.Name)
+			continue
+		}
+		for _, d := range diags {
+			if *errorsOnly && d.Severity != diag.Error {
+				continue
+			}
+			fmt.Printf("%s:%s\n", job.inPath, d)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lintFile parses a file and returns the problems the parser found, and the
+// format it was parsed as.
+func lintFile(path, from string) ([]diag.Diagnostic, *convert.Format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	rec, _ := sauce.Get(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	collector := &diag.Collector{}
+	opts := convert.DecodeOptions{Sauce: rec, Diagnostics: collector}
+	_, format, err := convert.Decode(context.Background(), file, convert.InputFormat(from, path), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collector.Diagnostics(), format, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	imgpng "image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"clean.ans":     "\x1b[31ma\x1b[0m",
+		"broken.ans":    "a\x1b[31mb\x1b[3",
+		"comma.mrc":     "\x034,hello",
+		"truncated.avt": "\x16\x01\x1fab\x16",
+		"pipe.pip":      "|07a|15b|07c|45",
+		"plain.txt":     "hello",
+		"truncated.xb":  "XBIN\x1a\x02\x00\x01\x00\x10\x00a\x07",
+		"pixel.png":     pngFile(t),
+	})
+	tests := []struct {
+		file    string
+		format  string
+		checked bool
+		want    []string
+	}{
+		{"clean.ans", "ansi", true, nil},
+		{"broken.ans", "ansi", true, []string{"1:3 (byte 7): error: truncated escape sequence at end of input"}},
+		{"comma.mrc", "mirc", true, nil},
+		{"truncated.avt", "avatar", true, []string{"1:3 (byte 5): error: truncated command at end of input"}},
+		{"pipe.pip", "pipe", true, []string{"1:4 (byte 12): warning: pipe code |45 out of range"}},
+		{"plain.txt", "plain", true, nil},
+		{"truncated.xb", "xbin", true, []string{"1:2 (byte 13): error: image data ends after 1 of 2 cells"}},
+		{"pixel.png", "png", false, nil},
+	}
+	for _, tt := range tests {
+		diags, format, err := lintFile(filepath.Join(dir, tt.file), "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if format.Name != tt.format || format.Diagnostics != tt.checked {
+			t.Errorf("%s: format %s, checked %v, want %s, %v", tt.file, format.Name, format.Diagnostics, tt.format, tt.checked)
+		}
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+// pngFile returns a 1x1 PNG image.
+func pngFile(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := imgpng.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
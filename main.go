@@ -2,27 +2,83 @@ package main
 
 import (
 	"a2m2a/ansi"
+	"a2m2a/artpack"
 	"a2m2a/canvas"
+	"a2m2a/convert"
+	"a2m2a/html"
 	"a2m2a/mirc"
-	"a2m2a/renderer"
+	"a2m2a/palette"
+	"a2m2a/plain"
+	"a2m2a/quantize"
+	"a2m2a/raster"
 	"a2m2a/sauce"
+	"a2m2a/svg"
+	"a2m2a/term"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 )
 
 // The new CLI flags
 var (
-	inPath  string
-	outPath string
-	width   int
-	png     bool
-	thumb   uint
-	force16 bool
+	inPath   string
+	outPath  string
+	width    int
+	png      bool
+	thumb    uint
+	force16  bool
+	dither16 string
+	metric   string
+
+	mircPalette string
+	ansiPalette string
+
+	fromFormat string
+	toFormat   string
+
+	batch     bool
+	targets   string
+	jobs      int
+	watchMode bool
+
+	pixels   bool
+	page     bool
+	mapCP437 bool
+
+	htmlFragment bool
+	htmlClasses  bool
+	htmlFont     bool
+	htmlBlink    bool
+
+	svgFont bool
+
+	imgMode    string
+	imgPalette string
+	dither     string
+	ansiColors int
+
+	textEncoding string
+	tabWidth     int
+	noWrap       bool
+	wrapMode     string
+
+	strict bool
+
+	// imageOpts is built from the image flags in main.
+	imageOpts raster.Options
+	// quantizeMode is parsed from --16-dither in main.
+	quantizeMode quantize.Mode
+	// textOpts is built from the text flags in main.
+	textOpts plain.Options
+	// lineWrap is parsed from --wrap in main.
+	lineWrap canvas.WrapMode
 )
 
 func init() {
@@ -34,14 +90,110 @@ func init() {
 	flag.BoolVar(&png, "png", false, "Generate a PNG image")
 	flag.UintVar(&thumb, "thumb", 0, "Generate a thumbnail PNG of the specified width (e.g., --thumb 320)")
 	flag.BoolVar(&force16, "16", false, "Force 16-color output for all formats.")
+	flag.StringVar(&dither16, "16-dither", "nearest", "With --16: how out-of-palette colors are drawn, nearest, shade (░▒▓ mixes) or ordered")
+	flag.StringVar(&metric, "metric", "rgb", "Color matching metric: rgb, redmean, cie76 or ciede2000")
+	flag.StringVar(&fromFormat, "from", "", "Input format (default: auto-detect)")
+	flag.StringVar(&toFormat, "to", "", "Output format (default: from the output extension, else ANSI <-> mIRC)")
+	flag.BoolVar(&batch, "batch", false, "Batch mode: convert every file in the given directories/globs (-i and arguments) into the -o directory")
+	flag.StringVar(&targets, "targets", "", "Batch mode: comma-separated output formats, e.g. mirc,png,thumb (default: ANSI <-> mIRC)")
+	flag.IntVar(&jobs, "j", runtime.NumCPU(), "Batch mode: number of files converted in parallel")
+	flag.BoolVar(&watchMode, "watch", false, "Re-render the input file or directory whenever it changes")
+	flag.BoolVar(&pixels, "pixels", false, "Terminal output: show the rendered image with half-block pixels (implies --to term)")
+	flag.BoolVar(&page, "page", false, "Terminal output: pause after every screenful")
+	flag.BoolVar(&mapCP437, "cp437", true, "Terminal output: show CP437 control-range glyphs (☺, ♥, ...) as Unicode")
+	flag.BoolVar(&htmlFragment, "html-fragment", false, "HTML output: write only the <style> and <pre> blocks instead of a full page")
+	flag.BoolVar(&htmlClasses, "html-classes", false, "HTML output: use generated CSS classes instead of inline styles")
+	flag.BoolVar(&htmlFont, "html-font", false, "HTML output: embed the monospace web font")
+	flag.BoolVar(&htmlBlink, "html-blink", false, "HTML output: show blink (non-iCE) cells blinking")
+	flag.BoolVar(&svgFont, "svg-font", false, "SVG output: embed the monospace font instead of referencing it")
+	flag.StringVar(&imgMode, "img-mode", "half", "Image input: cell characters, half (▀▄) or quad (quadrant blocks, UTF-8 outputs only)")
+	flag.StringVar(&imgPalette, "img-palette", "", "Image input: target palette, ansi16, mirc99 or 256 (default: mirc99 for mIRC output, else ansi16)")
+	flag.StringVar(&dither, "dither", "none", "Image input: dithering, none, fs (Floyd-Steinberg) or ordered")
+	flag.StringVar(&textEncoding, "text-encoding", "auto", "Text input: character set, auto (UTF-8 if valid, else CP437), utf8, cp437 or latin1 (Amiga)")
+	flag.IntVar(&tabWidth, "tab-width", plain.DefaultTabWidth, "Text and ANSI input: tab stop interval")
+	flag.StringVar(&wrapMode, "wrap", "pending", "Text input: wrapping at the last column, pending (like a VT terminal) or immediate (like ANSI.SYS: a full line followed by a line break leaves an empty line)")
+	flag.BoolVar(&noWrap, "no-wrap", false, "Text input: cut lines longer than the width instead of wrapping them")
+	flag.BoolVar(&strict, "strict", false, "Fail on unsupported or malformed sequences and truncated data in the input (see the lint subcommand)")
+	flag.IntVar(&ansiColors, "ansi-colors", 0, "ANSI output: palette size, 16 or 256 (default: 256 for --img-palette 256, else 16)")
+	flag.StringVar(&mircPalette, "palette", "", "mIRC palette: built-in name (mirc, hexchat, irssi, weechat) or palette file")
+	flag.StringVar(&ansiPalette, "ansi-palette", "", "ANSI palette: built-in name (vga, xterm, putty, campbell) or palette file")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serveCommand(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		lintCommand(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
+	m, err := palette.ParseMetric(metric)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	palette.SetMetric(m)
+
+	if quantizeMode, err = quantize.ParseMode(dither16); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if imageOpts.Mode, err = raster.ParseMode(imgMode); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if imageOpts.Dither, err = raster.ParseDither(dither); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if textOpts.Encoding, err = plain.ParseEncoding(textEncoding); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	textOpts.TabWidth, textOpts.Truncate = tabWidth, noWrap
+	if lineWrap, err = canvas.ParseWrapMode(wrapMode); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Palettes must be applied before the canvas is created, since the
+	// canvas defaults follow the ANSI palette.
+	if mircPalette != "" {
+		p, err := palette.Resolve(mircPalette)
+		if err != nil {
+			log.Fatalf("Error loading mIRC palette: %v", err)
+		}
+		mirc.SetPalette(p)
+	}
+	if ansiPalette != "" {
+		p, err := palette.Resolve(ansiPalette)
+		if err != nil {
+			log.Fatalf("Error loading ANSI palette: %v", err)
+		}
+		ansi.SetPalette(p)
+	}
+	if imgPalette == "" {
+		imgPalette = defaultImagePalette()
+	}
+	if imageOpts.Palette, err = raster.Palette(imgPalette); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	if pixels && toFormat == "" {
+		toFormat = "term"
+	}
+	if batch {
+		runBatchMode()
+		return
+	}
+	if watchMode {
+		runWatchMode()
+		return
+	}
+	if strings.EqualFold(filepath.Ext(inPath), ".zip") {
+		runArtpackMode()
+		return
+	}
+
 	var reader io.Reader
 	var file *os.File
-	var err error
 	var sauceRecord *sauce.Record
 
 	// --- Input Handling ---
@@ -68,55 +220,27 @@ func main() {
 		// Note: SAUCE parsing from stdin is not supported.
 	}
 
-	// Override canvas width if specified in SAUCE record and not by user flag.
-	usedWidth := width
-	var dataSize int64
-	if sauceRecord != nil {
-		// The `width` flag has a default value, so we need to check if it was explicitly set.
-		widthFlagSet := false
-		flag.Visit(func(f *flag.Flag) {
-			if f.Name == "w" {
-				widthFlagSet = true
-			}
-		})
-		if sauceRecord.TInfo1 > 0 && !widthFlagSet {
-			usedWidth = int(sauceRecord.TInfo1)
-		}
-		dataSize = int64(sauceRecord.FileSize)
-	}
-
-	// --- Auto-Detect Format & Parse to Canvas ---
-	buf := new(bytes.Buffer)
-	tee := io.TeeReader(reader, buf)
-	format := detectFormat(tee)
-	reader = io.MultiReader(buf, reader)
+	decodeOpts := decodeOptions()
+	decodeOpts.Sauce = sauceRecord
 
-	c := canvas.NewCanvas(usedWidth)
-	var outputFormat string
+	// --- Select Input Format & Parse to Canvas ---
+	ctx := context.Background()
+	c, inFormat, err := convert.Decode(ctx, reader, convert.InputFormat(fromFormat, inPath), decodeOpts)
+	if err == convert.ErrUnknownFormat {
+		log.Fatalf("Could not detect file format. Please specify it with --from.")
+	} else if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
-	switch format {
-	case "ansi":
-		p := ansi.NewParser(c, reader, dataSize)
-		if err := p.Parse(); err != nil {
-			log.Fatalf("Error parsing ANSI: %v", err)
-		}
-		outputFormat = "mirc"
-	case "mirc":
-		// mIRC files don't have SAUCE records, so dataSize will be 0.
-		p := mirc.NewParser(c, reader, force16)
-		if err := p.Parse(); err != nil {
-			log.Fatalf("Error parsing mIRC: %v", err)
-		}
-		outputFormat = "ansi"
-	default:
-		log.Fatalf("Could not detect file format. Please specify manually.")
+	// --- Select Output Format ---
+	outFormat, err := selectOutputFormat(inFormat)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
 	}
 
 	// --- Output Generation ---
-	shouldGeneratePng := png || thumb > 0 || (outPath != "" && strings.HasSuffix(outPath, ".png"))
-	shouldGenerateThumb := thumb > 0
-
-	if shouldGeneratePng {
+	if outFormat.Image {
+		shouldGenerateThumb := thumb > 0
 		if outPath == "" {
 			log.Fatalf("An output file path must be specified with -o or --out for image generation.")
 		}
@@ -129,26 +253,18 @@ func main() {
 		}
 
 		// Generate the main PNG if required
-		if png || !shouldGenerateThumb { // Generate main PNG if --png is set or if it's the default action
-			pngData, err := renderer.ToPNG(c)
-			if err != nil {
+		if png || toFormat != "" || !shouldGenerateThumb { // Generate main PNG if --png is set or if it's the default action
+			if err := writeFile(ctx, outPath, c, outFormat, convert.EncodeOptions{}); err != nil {
 				log.Fatalf("Error generating PNG: %v", err)
 			}
-			if err := os.WriteFile(outPath, pngData, 0644); err != nil {
-				log.Fatalf("Error writing PNG file: %v", err)
-			}
 			fmt.Printf("Generated PNG: %s\n", outPath)
 		}
 
 		if shouldGenerateThumb {
 			thumbPath := constructThumbPath(outPath)
-			thumbData, err := renderer.ToThumbnail(c)
-			if err != nil {
+			if err := writeFile(ctx, thumbPath, c, outFormat, convert.EncodeOptions{Scale: 0.5}); err != nil {
 				log.Fatalf("Error generating thumbnail: %v", err)
 			}
-			if err := os.WriteFile(thumbPath, thumbData, 0644); err != nil {
-				log.Fatalf("Error writing thumbnail file: %v", err)
-			}
 			fmt.Printf("Generated Thumbnail: %s\n", thumbPath)
 		}
 	} else {
@@ -163,17 +279,8 @@ func main() {
 			writer = file
 		}
 
-		switch outputFormat {
-		case "ansi":
-			w := ansi.NewWriter(c, writer)
-			if err := w.Write(); err != nil {
-				log.Fatalf("Error writing ANSI: %v", err)
-			}
-		case "mirc":
-			w := mirc.NewWriter(c, writer)
-			if err := w.Write(); err != nil {
-				log.Fatalf("Error writing mIRC: %v", err)
-			}
+		if err := convert.Encode(ctx, writer, c, outFormat.Name, textEncodeOptions(outPath == "")); err != nil {
+			log.Fatalf("Error: %v", err)
 		}
 		if outPath != "" {
 			fmt.Printf("Generated Text File: %s\n", outPath)
@@ -181,32 +288,203 @@ func main() {
 	}
 }
 
-// constructThumbPath creates a thumbnail filename from an original path.
-// e.g., "art.png" becomes "art_thumb.png"
-func constructThumbPath(originalPath string) string {
-	ext := ".png"
-	base := strings.TrimSuffix(originalPath, ext)
-	return base + "_thumb" + ext
+// runBatchMode converts all inputs given to --batch and exits non-zero if
+// any of them failed.
+func runBatchMode() {
+	if outPath == "" {
+		log.Fatalf("Batch mode requires an output directory with -o or --out.")
+	}
+	inputs := flag.Args()
+	if inPath != "" {
+		inputs = append([]string{inPath}, inputs...)
+	}
+	if len(inputs) == 0 {
+		log.Fatalf("Batch mode requires at least one input directory or glob.")
+	}
+
+	batchTargets, err := parseTargets(targets)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	batchJobs, err := collectBatchJobs(inputs)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	cfg := batchConfig{
+		outDir:     outPath,
+		from:       fromFormat,
+		targets:    batchTargets,
+		workers:    jobs,
+		decodeOpts: decodeOptions(),
+	}
+	if err := runBatch(context.Background(), batchJobs, cfg); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// runArtpackMode renders every piece of art in the -i ZIP into the -o
+// directory together with an index.json and an index.html contact sheet.
+func runArtpackMode() {
+	if outPath == "" {
+		log.Fatalf("Artpack mode requires an output directory with -o or --out.")
+	}
+	opts := artpack.Options{
+		OutDir: outPath,
+		Decode: decodeOptions(),
+	}
+
+	index, err := artpack.Open(context.Background(), inPath, opts)
+	if err != nil {
+		log.Fatalf("Error processing artpack: %v", err)
+	}
+	if err := index.Save(outPath); err != nil {
+		log.Fatalf("Error writing artpack index: %v", err)
+	}
+
+	failed := 0
+	for _, e := range index.Entries {
+		if e.Error != "" {
+			failed++
+			fmt.Fprintf(os.Stderr, "FAIL %s: %s\n", e.Name, e.Error)
+		}
+	}
+	fmt.Printf("Rendered %d of %d entries from %s into %s\n", len(index.Entries)-failed, len(index.Entries), index.Archive, outPath)
+}
+
+// defaultImagePalette picks the palette images are converted to: the full
+// mIRC palette when the output is mIRC (the default for image input), and
+// the 16 ANSI colors otherwise.
+func defaultImagePalette() string {
+	out := toFormat
+	if out == "" && outPath != "" && !batch {
+		if f := convert.ForPath(outPath); f != nil {
+			out = f.Name
+		}
+	}
+	if out == "" || out == "mirc" {
+		return "mirc99"
+	}
+	return "ansi16"
+}
+
+// decodeOptions collects the input options given on the command line.
+func decodeOptions() convert.DecodeOptions {
+	return convert.DecodeOptions{Width: explicitWidth(), Force16: force16, Quantize: quantizeMode, Image: imageOpts, Text: textOpts, Wrap: lineWrap, Strict: strict}
+}
+
+// textEncodeOptions collects the options of text outputs. The terminal
+// preview is fitted to the terminal when it is written to stdout.
+func textEncodeOptions(toStdout bool) convert.EncodeOptions {
+	opts := convert.EncodeOptions{
+		Term: term.Options{MapCP437: mapCP437, Pixels: pixels},
+		HTML: html.Options{
+			Fragment:  htmlFragment,
+			Classes:   htmlClasses,
+			EmbedFont: htmlFont,
+			Blink:     htmlBlink,
+		},
+		SVG:  svg.Options{EmbedFont: svgFont},
+		ANSI: ansi.Options{Colors: ansiColors},
+	}
+	if opts.ANSI.Colors == 0 && len(imageOpts.Palette) == 256 {
+		opts.ANSI.Colors = 256
+	}
+	if inPath != "" {
+		opts.HTML.Title = filepath.Base(inPath)
+	}
+	if !toStdout {
+		return opts
+	}
+	cols, rows, ok := term.Size(os.Stdout)
+	if !ok {
+		return opts
+	}
+	opts.Term.Width = cols
+	if page {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			opts.Term.Pager = tty // Closed when the process exits.
+			opts.Term.PageHeight = rows
+		}
+	}
+	return opts
+}
+
+// explicitWidth returns the -w width if it was given on the command line and
+// 0 otherwise. The `width` flag has a default value, so we need to check if
+// it was explicitly set before letting it override the SAUCE width.
+func explicitWidth() int {
+	explicit := 0
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "w" {
+			explicit = width
+		}
+	})
+	return explicit
 }
 
-// detectFormat inspects the start of a reader to determine if it's ANSI or mIRC.
-func detectFormat(r io.Reader) string {
-	// Read a small chunk of the file to check for signatures.
-	chunk := make([]byte, 4096)
-	n, err := r.Read(chunk)
-	if err != nil && err != io.EOF {
-		return "unknown"
+// writeFile encodes the canvas into a new file at path.
+// The file is written under a temporary name and renamed into place, so
+// image viewers and other readers never see a half-written file.
+func writeFile(ctx context.Context, path string, c *canvas.Canvas, f *convert.Format, opts convert.EncodeOptions) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // No-op once the rename succeeded.
+
+	if err := convert.Encode(ctx, file, c, f.Name, opts); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
 	}
-	chunk = chunk[:n]
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
 
-	// Look for ANSI escape code signature: \x1b[
-	if bytes.Contains(chunk, []byte{0x1b, '['}) {
-		return "ansi"
+// selectOutputFormat picks the output format from --to, the image flags, the
+// output file extension, or the input format, in that order.
+func selectOutputFormat(in *convert.Format) (*convert.Format, error) {
+	var out *convert.Format
+	switch {
+	case toFormat != "":
+		var err error
+		if out, err = convert.Lookup(toFormat); err != nil {
+			return nil, err
+		}
+	case png || thumb > 0:
+		out, _ = convert.Lookup("png")
+	case outPath != "" && convert.ForPath(outPath) != nil:
+		out = convert.ForPath(outPath)
+	default:
+		out = defaultOutputFormat(in)
 	}
-	// Look for mIRC color code signature: \x03
-	if bytes.Contains(chunk, []byte{0x03}) {
-		return "mirc"
+	if out.Encoder == nil {
+		return nil, fmt.Errorf("format %q cannot be used as output", out.Name)
+	}
+	return out, nil
+}
+
+// defaultOutputFormat picks the output when neither --to nor the output
+// extension says otherwise: ANSI and mIRC convert into each other.
+func defaultOutputFormat(in *convert.Format) *convert.Format {
+	name := "mirc"
+	if in.Name == "mirc" {
+		name = "ansi"
 	}
+	f, _ := convert.Lookup(name)
+	return f
+}
 
-	return "unknown"
+// constructThumbPath creates a thumbnail filename from an original path.
+// e.g., "art.png" becomes "art_thumb.png"
+func constructThumbPath(originalPath string) string {
+	ext := ".png"
+	base := strings.TrimSuffix(originalPath, ext)
+	return base + "_thumb" + ext
 }
@@ -109,3 +109,14 @@ var MircPalette99 = []clr.RGBA{
 	{R: 0xe2, G: 0xe2, B: 0xe2, A: 0xFF}, // 97
 	{R: 0xff, G: 0xff, B: 0xff, A: 0xFF}, // 98
 }
+
+// SetPalette replaces the colors used for mIRC color indices, e.g. with an IRC
+// client's palette loaded through the palette package. Palettes with fewer
+// than 99 entries only override the leading colors, so a 16-color client
+// palette keeps the standard extended colors.
+func SetPalette(p []clr.RGBA) {
+	merged := make([]clr.RGBA, len(MircPalette99))
+	copy(merged, MircPalette99)
+	copy(merged, p)
+	MircPalette99 = merged
+}
@@ -0,0 +1,141 @@
+package mirc
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bytes"
+	clr "image/color"
+	"strings"
+	"testing"
+)
+
+// parse reads input into a canvas and returns it with the diagnostics.
+func parse(t *testing.T, input string) (*canvas.Canvas, []string) {
+	t.Helper()
+	c := canvas.NewCanvas(80)
+	p := NewParser(c, strings.NewReader(input))
+	p.Diagnostics = &diag.Collector{}
+	if err := p.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	var diags []string
+	for _, d := range p.Diagnostics.Diagnostics() {
+		diags = append(diags, d.String())
+	}
+	return c, diags
+}
+
+// firstRow returns the characters of the first row, trailing spaces trimmed.
+func firstRow(c *canvas.Canvas) string {
+	var b strings.Builder
+	for _, cell := range c.Grid[0] {
+		b.WriteRune(cell.Char)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+func TestParseColors(t *testing.T) {
+	white, black, red, navy := MircPalette99[0], MircPalette99[1], MircPalette99[4], MircPalette99[2]
+	tests := []struct {
+		name   string
+		input  string
+		text   string
+		fg, bg clr.RGBA
+	}{
+		{"foreground", "\x034x", "x", red, canvas.DefaultBg},
+		{"both", "\x034,2x", "x", red, navy},
+		{"two digits", "\x0304,02x", "x", red, navy},
+		{"extended color", "\x0398x", "x", MircPalette99[98], canvas.DefaultBg},
+		{"third digit is text", "\x03041x", "1x", red, canvas.DefaultBg},
+		{"comma without background is text", "\x034,x", ",x", red, canvas.DefaultBg},
+		{"comma at the end is text", "\x034,", ",", red, canvas.DefaultBg},
+		{"comma and space", "\x0300, hi", ", hi", white, canvas.DefaultBg},
+		{"reset", "\x034,2\x03x", "x", canvas.DefaultFg, canvas.DefaultBg},
+		{"background kept", "\x030,1\x034x", "x", red, black},
+	}
+	for _, tt := range tests {
+		c, _ := parse(t, tt.input)
+		if got := firstRow(c); got != tt.text {
+			t.Errorf("%s: text = %q, want %q", tt.name, got, tt.text)
+		}
+		if cell := c.Grid[0][0]; cell.Fg != tt.fg || cell.Bg != tt.bg {
+			t.Errorf("%s: colors %v on %v, want %v on %v", tt.name, cell.Fg, cell.Bg, tt.fg, tt.bg)
+		}
+	}
+}
+
+func TestParseFormatting(t *testing.T) {
+	c, _ := parse(t, "\x02b\x02n\x1fu\x1f\x1di")
+	want := []struct {
+		char            rune
+		bold, underline bool
+	}{{'b', true, false}, {'n', false, false}, {'u', false, true}, {'i', false, false}}
+	for i, w := range want {
+		cell := c.Grid[0][i]
+		if cell.Char != w.char || cell.Bold != w.bold || cell.Underline != w.underline {
+			t.Errorf("cell %d = %q bold %v underline %v, want %q bold %v underline %v", i, cell.Char, cell.Bold, cell.Underline, w.char, w.bold, w.underline)
+		}
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"clean", "\x034,2a\x03 b, c\r\n", nil},
+		{"comma is not a problem", "\x034,hello", nil},
+		{"invalid UTF-8", "ab\xffc", []string{"1:3 (byte 2): error: invalid UTF-8 byte"}},
+	}
+	for _, tt := range tests {
+		_, got := parse(t, tt.input)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	red, navy := MircPalette99[4], MircPalette99[2]
+	white, black := MircPalette99[0], MircPalette99[1]
+	tests := []struct {
+		name   string
+		text   string
+		colors func(i int) (fg, bg clr.RGBA)
+	}{
+		{"back to black", "red, on navy", func(i int) (clr.RGBA, clr.RGBA) {
+			if i < 3 {
+				return red, navy
+			}
+			return white, black
+		}},
+		{"digits after codes", "1,2,3 45", func(i int) (clr.RGBA, clr.RGBA) {
+			return MircPalette99[i], black
+		}},
+		{"comma after a code", "a,5,b", func(i int) (clr.RGBA, clr.RGBA) {
+			return MircPalette99[i+2], black
+		}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		for i, r := range []rune(tt.text) {
+			fg, bg := tt.colors(i)
+			c.Put(canvas.Cell{Char: r, Fg: fg, Bg: bg})
+		}
+		var out bytes.Buffer
+		if err := NewWriter(c, &out).Write(); err != nil {
+			t.Fatal(err)
+		}
+		got, diags := parse(t, out.String())
+		if len(diags) > 0 {
+			t.Errorf("%s: diagnostics in written output: %q", tt.name, diags)
+		}
+		for i := range len(tt.text) {
+			want, have := c.Grid[0][i], got.Grid[0][i]
+			if have.Char != want.Char || have.Fg != want.Fg || have.Bg != want.Bg {
+				t.Errorf("%s: cell %d = %q %v on %v, want %q %v on %v (output %q)", tt.name, i, have.Char, have.Fg, have.Bg, want.Char, want.Fg, want.Bg, out.String())
+			}
+		}
+	}
+}
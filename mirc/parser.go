@@ -1,56 +1,68 @@
 package mirc
 
 import (
-	"a2m2a/ansi"
 	"a2m2a/canvas"
+	"a2m2a/diag"
 	"bufio"
 	clr "image/color"
 	"io"
 	"strconv"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Parser holds the state for parsing a mIRC stream.
 type Parser struct {
-	canvas  *canvas.Canvas
-	reader  *bufio.Reader
-	force16 bool
+	canvas *canvas.Canvas
+	reader *bufio.Reader
 	// Current graphic rendition attributes
-	fg   clr.RGBA
-	bg   clr.RGBA
-	bold bool
-	ice  bool
+	fg        clr.RGBA
+	bg        clr.RGBA
+	bold      bool
+	ice       bool
+	underline bool
+
+	// Diagnostics, if not nil, collects the malformed color codes found.
+	Diagnostics *diag.Collector
+	// offset counts the input bytes read; seqStart is the offset of the
+	// color code being parsed.
+	offset   int64
+	seqStart int64
+	lastSize int
 }
 
 // NewParser creates a new mIRC parser.
-func NewParser(c *canvas.Canvas, r io.Reader, force16 bool) *Parser {
+func NewParser(c *canvas.Canvas, r io.Reader) *Parser {
 	return &Parser{
-		canvas:  c,
-		reader:  bufio.NewReader(r),
-		force16: force16,
-		fg:      canvas.DefaultFg,
-		bg:      canvas.DefaultBg,
-		bold:    canvas.DefaultBold,
-		ice:     canvas.DefaultIce,
+		canvas: c,
+		reader: bufio.NewReader(r),
+		fg:     canvas.DefaultFg,
+		bg:     canvas.DefaultBg,
+		bold:   canvas.DefaultBold,
+		ice:    canvas.DefaultIce,
 	}
 }
 
 // Parse reads the mIRC stream and updates the canvas.
 func (p *Parser) Parse() error {
 	for {
-		r, _, err := p.reader.ReadRune()
+		r, err := p.readRune()
 		if err != nil {
 			if err == io.EOF {
 				return nil
 			}
 			return err
 		}
+		if r == utf8.RuneError && p.lastSize == 1 {
+			p.seqStart = p.offset - 1
+			p.report(diag.Error, "invalid UTF-8 byte")
+		}
 
 		switch r {
 		case '\x03': // mIRC color code
+			p.seqStart = p.offset - 1
 			if err := p.handleColorCode(); err != nil {
-				// Stop parsing on any error from color handler, including EOF
-				return nil
+				return err
 			}
 		case '\n':
 			// If the cursor is not at the start of a line, we need to add a newline.
@@ -68,10 +80,17 @@ func (p *Parser) Parse() error {
 			p.bold = !p.bold
 		case '\x1d': // Italic toggle (unsupported)
 			continue
-		case '\x1f': // Underline toggle (unsupported)
-			continue
+		case '\x1f': // Underline toggle
+			p.underline = !p.underline
 		default:
-			p.canvas.SetCell(r, p.fg, p.bg, p.bold, false, p.ice)
+			p.canvas.Put(canvas.Cell{
+				Char:      r,
+				Fg:        p.fg,
+				Bg:        p.bg,
+				Bold:      p.bold,
+				Ice:       p.ice,
+				Underline: p.underline,
+			})
 		}
 	}
 }
@@ -83,11 +102,6 @@ func (p *Parser) handleColorCode() error {
 	// Read foreground
 	fgStr, err := p.readColorDigits()
 	if err != nil {
-		// This can happen if \x03 is at the end of the file.
-		// It's not a fatal error, just stop parsing.
-		if err == io.EOF {
-			return nil
-		}
 		// If there are no digits after \x03, it's a reset code.
 		p.fg, p.bg = canvas.DefaultFg, canvas.DefaultBg
 		p.bold, p.ice = false, false
@@ -96,39 +110,20 @@ func (p *Parser) handleColorCode() error {
 
 	fgColorIdx, _ := strconv.Atoi(fgStr)
 	if fgColorIdx >= 0 && fgColorIdx < len(MircPalette99) {
-		color := MircPalette99[fgColorIdx]
-		if p.force16 {
-			color, _ = ansi.FindClosestAnsiColor(color)
-		}
-		p.fg = color
+		p.fg = MircPalette99[fgColorIdx]
 	}
 
-	// Check for optional background
-	nextRune, _, err := p.reader.ReadRune()
-	if err != nil {
-		return err // EOF during BG check
-	}
-
-	if nextRune != ',' {
-		// No BG color, unread the rune and we're done.
-		p.reader.UnreadRune()
-		return nil
-	}
-
-	// Read background
-	bgStr, err := p.readColorDigits()
-	if err != nil {
-		// EOF after comma
+	// A comma only starts a background color if a digit follows; otherwise
+	// it is text, as in "\x034,hello".
+	if next, _ := p.reader.Peek(2); len(next) < 2 || next[0] != ',' || next[1] < '0' || next[1] > '9' {
 		return nil
 	}
+	p.readRune() // The comma.
+	bgStr, _ := p.readColorDigits()
 
 	bgColorIdx, _ := strconv.Atoi(bgStr)
 	if bgColorIdx >= 0 && bgColorIdx < len(MircPalette99) {
-		color := MircPalette99[bgColorIdx]
-		if p.force16 {
-			color, _ = ansi.FindClosestAnsiColor(color)
-		}
-		p.bg = color
+		p.bg = MircPalette99[bgColorIdx]
 	}
 
 	return nil
@@ -138,27 +133,52 @@ func (p *Parser) handleColorCode() error {
 func (p *Parser) readColorDigits() (string, error) {
 	var digits []rune
 	// Read first digit
-	r, _, err := p.reader.ReadRune()
+	r, err := p.readRune()
 	if err != nil {
 		return "", err
 	}
 	if !unicode.IsDigit(r) {
-		p.reader.UnreadRune()
+		p.unreadRune()
 		return "", io.EOF // Not a digit, treat as end
 	}
 	digits = append(digits, r)
 
 	// Read optional second digit
-	r, _, err = p.reader.ReadRune()
+	r, err = p.readRune()
 	if err != nil {
 		// EOF is fine after one digit
 		return string(digits), nil
 	}
 	if !unicode.IsDigit(r) {
-		p.reader.UnreadRune()
+		p.unreadRune()
 		return string(digits), nil
 	}
 	digits = append(digits, r)
 
 	return string(digits), nil
 }
+
+// readRune reads a rune, keeping track of the byte offset.
+func (p *Parser) readRune() (rune, error) {
+	r, size, err := p.reader.ReadRune()
+	p.offset += int64(size)
+	p.lastSize = size
+	return r, err
+}
+
+// unreadRune unreads the rune last read by readRune.
+func (p *Parser) unreadRune() {
+	p.reader.UnreadRune()
+	p.offset -= int64(p.lastSize)
+}
+
+// report records a diagnostic for the code being parsed, at the cursor.
+func (p *Parser) report(sev diag.Severity, msg string) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   p.seqStart,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: sev,
+		Message:  msg,
+	})
+}
@@ -2,10 +2,10 @@ package mirc
 
 import (
 	"a2m2a/canvas"
+	"a2m2a/palette"
 	"fmt"
 	clr "image/color"
 	"io"
-	"math"
 )
 
 // ANSI colors to mIRC color map.
@@ -33,7 +33,7 @@ func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
 // Write generates the mIRC output from the canvas.
 func (w *Writer) Write() error {
 	var prevFg, prevBg clr.RGBA = canvas.DefaultFg, canvas.DefaultBg
-	var prevBold bool
+	var prevBold, prevUnderline bool
 
 	// Get content bounds to treat the canvas as a fixed-size rectangle.
 	// This ensures that alignment is preserved across all lines.
@@ -45,7 +45,7 @@ func (w *Writer) Write() error {
 		}
 		// Reset state for each new line
 		prevFg, prevBg = canvas.DefaultFg, canvas.DefaultBg
-		prevBold = false
+		prevBold, prevUnderline = false, false
 
 		for i := 0; i <= maxCol; i++ {
 			cell := row[i]
@@ -56,16 +56,29 @@ func (w *Writer) Write() error {
 				prevBold = cell.Bold
 			}
 
+			// Handle Underline state change with ^_ (0x1F)
+			if cell.Underline != prevUnderline {
+				fmt.Fprint(w.writer, "\x1f")
+				prevUnderline = cell.Underline
+			}
+
 			// Handle Color state change with ^C (0x03)
 			if cell.Fg != prevFg || cell.Bg != prevBg {
 				fgIndex, _ := findClosestMircColor(cell.Fg)
 				bgIndex, _ := findClosestMircColor(cell.Bg)
 
-				// Always write FG. Only write BG if it's not the default.
-				if bgIndex != 1 { // mIRC default BG is black (index 1)
-					fmt.Fprintf(w.writer, "\x03%d,%d", fgIndex, bgIndex)
+				// Always write FG. Only write BG if it's not the default
+				// (black, index 1) or changed back to it, or if a comma
+				// follows, which would otherwise be read as the separator.
+				// Before a digit, two-digit numbers keep it out of the code.
+				num := "%d"
+				if cell.Char >= '0' && cell.Char <= '9' {
+					num = "%02d"
+				}
+				if bgIndex != 1 || cell.Bg != prevBg || cell.Char == ',' {
+					fmt.Fprintf(w.writer, "\x03"+num+","+num, fgIndex, bgIndex)
 				} else {
-					fmt.Fprintf(w.writer, "\x03%d", fgIndex)
+					fmt.Fprintf(w.writer, "\x03"+num, fgIndex)
 				}
 				prevFg = cell.Fg
 				prevBg = cell.Bg
@@ -82,31 +95,13 @@ func (w *Writer) Write() error {
 	return nil
 }
 
-// colorDistance calculates the Euclidean distance between two colors.
-func colorDistance(c1, c2 clr.RGBA) float64 {
-	r1, g1, b1, _ := c1.RGBA()
-	r2, g2, b2, _ := c2.RGBA()
-	rd := float64(r1) - float64(r2)
-	gd := float64(g1) - float64(g2)
-	bd := float64(b1) - float64(b2)
-	return math.Sqrt(rd*rd + gd*gd + bd*bd)
-}
-
-// findClosestMircColor finds the closest color in the 99-color mIRC palette.
+// findClosestMircColor finds the closest color in the 99-color mIRC palette
+// using the metric selected with palette.SetMetric.
 func findClosestMircColor(c clr.RGBA) (int, clr.RGBA) {
 	if c.A == 0 {
 		// Assuming transparent should be the default background color
 		return 1, MircPalette99[1]
 	}
-	closestIndex := 0
-	minDist := math.MaxFloat64
-
-	for i, mircColor := range MircPalette99 {
-		dist := colorDistance(c, mircColor)
-		if dist < minDist {
-			minDist = dist
-			closestIndex = i
-		}
-	}
+	closestIndex := palette.Nearest(MircPalette99, c)
 	return closestIndex, MircPalette99[closestIndex]
 }
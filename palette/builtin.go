@@ -0,0 +1,115 @@
+package palette
+
+import (
+	"image/color"
+	"sort"
+	"strings"
+)
+
+// builtins holds the named palettes shipped with the tool. The IRC client
+// palettes cover the 16 base mIRC colors in mIRC index order; the terminal
+// palettes cover the 16 ANSI colors in SGR order (black, red, green, ...).
+var builtins = map[string][]string{
+	// IRC clients
+	"mirc": {
+		"#ffffff", "#000000", "#00007f", "#009300", "#ff0000", "#7f0000", "#9c009c", "#fc7f00",
+		"#ffff00", "#00fc00", "#009393", "#00ffff", "#0000fc", "#ff00ff", "#7f7f7f", "#d2d2d2",
+	},
+	"hexchat": {
+		"#d3d7cf", "#2e3436", "#3465a4", "#4e9a06", "#cc0000", "#8f3902", "#5c3566", "#ce5c00",
+		"#c4a000", "#73d216", "#11a879", "#58a19d", "#57799e", "#a04365", "#555753", "#888a85",
+	},
+	// irssi maps mIRC colors onto the terminal's 16 colors; these are the
+	// results on xterm's default palette.
+	"irssi": {
+		"#ffffff", "#000000", "#0000ee", "#00cd00", "#ff0000", "#cd0000", "#cd00cd", "#cdcd00",
+		"#ffff00", "#00ff00", "#00cdcd", "#00ffff", "#5c5cff", "#ff00ff", "#7f7f7f", "#e5e5e5",
+	},
+
+	// Terminals
+	"vga": {
+		"#000000", "#aa0000", "#00aa00", "#aa5500", "#0000aa", "#aa00aa", "#00aaaa", "#aaaaaa",
+		"#555555", "#ff5555", "#55ff55", "#ffff55", "#5555ff", "#ff55ff", "#55ffff", "#ffffff",
+	},
+	"xterm": {
+		"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+		"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+	},
+	"putty": {
+		"#000000", "#bb0000", "#00bb00", "#bbbb00", "#0000bb", "#bb00bb", "#00bbbb", "#bbbbbb",
+		"#555555", "#ff5555", "#55ff55", "#ffff55", "#5555ff", "#ff55ff", "#55ffff", "#ffffff",
+	},
+	"campbell": {
+		"#0c0c0c", "#c50f1f", "#13a10e", "#c19c00", "#0037da", "#881798", "#3a96dd", "#cccccc",
+		"#767676", "#e74856", "#16c60c", "#f9f1a5", "#3b78ff", "#b4009e", "#61d6d6", "#f2f2f2",
+	},
+}
+
+// aliases names built-in palettes that are identical to another one. WeeChat
+// maps mIRC colors onto the same terminal colors as irssi.
+var aliases = map[string]string{
+	"weechat": "irssi",
+}
+
+// Order is the color order of the 16 base entries of a palette.
+type Order int
+
+const (
+	// SGROrder is the ANSI order: black, red, green, yellow, blue, ...
+	SGROrder Order = iota
+	// IRCOrder is the mIRC order: white, black, blue, green, red, ...
+	IRCOrder
+)
+
+func (o Order) String() string {
+	if o == IRCOrder {
+		return "mIRC"
+	}
+	return "ANSI"
+}
+
+// BuiltinOrder returns the color order of the named built-in palette.
+func BuiltinOrder(name string) (Order, bool) {
+	name = strings.ToLower(name)
+	if target, ok := aliases[name]; ok {
+		name = target
+	}
+	if _, ok := builtins[name]; !ok {
+		return 0, false
+	}
+	switch name {
+	case "mirc", "hexchat", "irssi":
+		return IRCOrder, true
+	}
+	return SGROrder, true
+}
+
+// Builtin returns a copy of the named built-in palette.
+func Builtin(name string) ([]color.RGBA, bool) {
+	name = strings.ToLower(name)
+	if target, ok := aliases[name]; ok {
+		name = target
+	}
+	hexes, ok := builtins[name]
+	if !ok {
+		return nil, false
+	}
+	p := make([]color.RGBA, len(hexes))
+	for i, h := range hexes {
+		p[i], _ = ParseHexColor(h)
+	}
+	return p, true
+}
+
+// BuiltinNames lists the names of all built-in palettes in sorted order.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(aliases))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
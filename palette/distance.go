@@ -0,0 +1,216 @@
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Metric selects how the distance between two colors is measured when an
+// arbitrary color is snapped to the nearest entry of a palette.
+type Metric int
+
+const (
+	// RGB is the plain Euclidean distance between the raw RGB channels.
+	RGB Metric = iota
+	// Redmean is a cheap weighted RGB distance that tracks human perception
+	// noticeably better than plain RGB, especially for reds and browns.
+	Redmean
+	// CIE76 is the Euclidean distance between two colors in CIELAB space.
+	CIE76
+	// CIEDE2000 is the CIE 2000 color difference formula, the most accurate
+	// (and most expensive) of the available metrics.
+	CIEDE2000
+)
+
+// metricNames maps the CLI spelling of each metric to its value.
+var metricNames = map[string]Metric{
+	"rgb":       RGB,
+	"redmean":   Redmean,
+	"cie76":     CIE76,
+	"ciede2000": CIEDE2000,
+}
+
+// ParseMetric converts a metric name such as "ciede2000" into a Metric.
+func ParseMetric(name string) (Metric, error) {
+	m, ok := metricNames[strings.ToLower(name)]
+	if !ok {
+		return RGB, fmt.Errorf("unknown color metric %q (want rgb, redmean, cie76 or ciede2000)", name)
+	}
+	return m, nil
+}
+
+// String returns the CLI name of the metric.
+func (m Metric) String() string {
+	for name, v := range metricNames {
+		if v == m {
+			return name
+		}
+	}
+	return fmt.Sprintf("Metric(%d)", int(m))
+}
+
+// Distance measures how far apart two colors are using the given metric.
+// Only the relative ordering of the results is meaningful; values from
+// different metrics are not comparable.
+func Distance(m Metric, c1, c2 color.RGBA) float64 {
+	switch m {
+	case Redmean:
+		return redmeanDistance(c1, c2)
+	case CIE76:
+		return cie76(toLab(c1), toLab(c2))
+	case CIEDE2000:
+		return ciede2000(toLab(c1), toLab(c2))
+	default:
+		return rgbDistance(c1, c2)
+	}
+}
+
+// rgbDistance calculates the Euclidean distance between two colors.
+func rgbDistance(c1, c2 color.RGBA) float64 {
+	rd := float64(c1.R) - float64(c2.R)
+	gd := float64(c1.G) - float64(c2.G)
+	bd := float64(c1.B) - float64(c2.B)
+	return math.Sqrt(rd*rd + gd*gd + bd*bd)
+}
+
+// redmeanDistance implements the "redmean" approximation, which weights the
+// channels depending on how red the two colors are on average.
+// See: https://www.compuphase.com/cmetric.htm
+func redmeanDistance(c1, c2 color.RGBA) float64 {
+	rmean := (float64(c1.R) + float64(c2.R)) / 2
+	rd := float64(c1.R) - float64(c2.R)
+	gd := float64(c1.G) - float64(c2.G)
+	bd := float64(c1.B) - float64(c2.B)
+	return math.Sqrt((2+rmean/256)*rd*rd + 4*gd*gd + (2+(255-rmean)/256)*bd*bd)
+}
+
+// lab is a color in CIELAB space (D65 white point).
+type lab struct {
+	L, A, B float64
+}
+
+// toLab converts an sRGB color to CIELAB.
+func toLab(c color.RGBA) lab {
+	r := linearize(c.R)
+	g := linearize(c.G)
+	b := linearize(c.B)
+
+	// Linear sRGB to XYZ, normalized against the D65 reference white.
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / 0.95047
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / 1.00000
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / 1.08883
+
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+// linearize undoes the sRGB gamma curve for a single 8-bit channel.
+func linearize(v uint8) float64 {
+	c := float64(v) / 255
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func labF(t float64) float64 {
+	const epsilon = 216.0 / 24389.0
+	const kappa = 24389.0 / 27.0
+	if t > epsilon {
+		return math.Cbrt(t)
+	}
+	return (kappa*t + 16) / 116
+}
+
+// cie76 is the Euclidean distance between two CIELAB colors.
+func cie76(a, b lab) float64 {
+	dl := a.L - b.L
+	da := a.A - b.A
+	db := a.B - b.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// ciede2000 implements the CIEDE2000 color difference with kL = kC = kH = 1.
+// See: Sharma, Wu, Dalal, "The CIEDE2000 Color-Difference Formula" (2005).
+func ciede2000(c1, c2 lab) float64 {
+	const pow25to7 = 6103515625.0 // 25^7
+
+	cab1 := math.Hypot(c1.A, c1.B)
+	cab2 := math.Hypot(c2.A, c2.B)
+	cabMean7 := math.Pow((cab1+cab2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cabMean7/(cabMean7+pow25to7)))
+
+	a1 := (1 + g) * c1.A
+	a2 := (1 + g) * c2.A
+	cp1 := math.Hypot(a1, c1.B)
+	cp2 := math.Hypot(a2, c2.B)
+	hp1 := hueAngle(a1, c1.B)
+	hp2 := hueAngle(a2, c2.B)
+
+	dL := c2.L - c1.L
+	dC := cp2 - cp1
+	var dh float64
+	if cp1*cp2 != 0 {
+		dh = hp2 - hp1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(cp1*cp2) * math.Sin(radians(dh/2))
+
+	lMean := (c1.L + c2.L) / 2
+	cMean := (cp1 + cp2) / 2
+	hMean := hp1 + hp2
+	if cp1*cp2 != 0 {
+		if math.Abs(hp1-hp2) > 180 {
+			if hMean < 360 {
+				hMean += 360
+			} else {
+				hMean -= 360
+			}
+		}
+		hMean /= 2
+	}
+
+	t := 1 - 0.17*math.Cos(radians(hMean-30)) +
+		0.24*math.Cos(radians(2*hMean)) +
+		0.32*math.Cos(radians(3*hMean+6)) -
+		0.20*math.Cos(radians(4*hMean-63))
+	dTheta := 30 * math.Exp(-math.Pow((hMean-275)/25, 2))
+	cMean7 := math.Pow(cMean, 7)
+	rc := 2 * math.Sqrt(cMean7/(cMean7+pow25to7))
+	lm50 := (lMean - 50) * (lMean - 50)
+	sl := 1 + (0.015*lm50)/math.Sqrt(20+lm50)
+	sc := 1 + 0.045*cMean
+	sh := 1 + 0.015*cMean*t
+	rt := -math.Sin(radians(2*dTheta)) * rc
+
+	fl := dL / sl
+	fc := dC / sc
+	fh := dH / sh
+	return math.Sqrt(fl*fl + fc*fc + fh*fh + rt*fc*fh)
+}
+
+// hueAngle returns the hue angle in degrees in the range [0, 360).
+func hueAngle(a, b float64) float64 {
+	if a == 0 && b == 0 {
+		return 0
+	}
+	h := math.Atan2(b, a) * 180 / math.Pi
+	if h < 0 {
+		h += 360
+	}
+	return h
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,59 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestParseMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Metric
+		wantErr bool
+	}{
+		{"rgb", RGB, false},
+		{"Redmean", Redmean, false},
+		{"CIE76", CIE76, false},
+		{"ciede2000", CIEDE2000, false},
+		{"lab", RGB, true},
+		{"", RGB, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMetric(tt.name)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseMetric(%q) = %v, %v; want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// The reference pairs are from Sharma, Wu and Dalal's CIEDE2000 test data.
+func TestCIEDE2000(t *testing.T) {
+	tests := []struct {
+		a, b lab
+		want float64
+	}{
+		{lab{50, 2.6772, -79.7751}, lab{50, 0, -82.7485}, 2.0425},
+		{lab{50, 0, 0}, lab{50, -1, 2}, 2.3669},
+		{lab{50, 2.5, 0}, lab{73, 25, -18}, 27.1492},
+		{lab{50, 2.5, 0}, lab{50, 0, -2.5}, 4.3065},
+		{lab{60.2574, -34.0099, 36.2677}, lab{60.4626, -34.1751, 39.4387}, 1.2644},
+	}
+	for _, tt := range tests {
+		if got := ciede2000(tt.a, tt.b); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("ciede2000(%v, %v) = %.4f, want %.4f", tt.a, tt.b, got, tt.want)
+		}
+		if got := ciede2000(tt.b, tt.a); math.Abs(got-tt.want) > 1e-4 {
+			t.Errorf("ciede2000(%v, %v) = %.4f, want %.4f (swapped)", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestDistanceIdentity(t *testing.T) {
+	c := color.RGBA{0x12, 0x80, 0xfe, 0xff}
+	for _, m := range []Metric{RGB, Redmean, CIE76, CIEDE2000} {
+		if d := Distance(m, c, c); d > 1e-9 {
+			t.Errorf("Distance(%v, c, c) = %v, want 0", m, d)
+		}
+	}
+}
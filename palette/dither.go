@@ -0,0 +1,19 @@
+package palette
+
+import "math"
+
+// bayer4 is the 4x4 ordered dithering threshold matrix.
+var bayer4 = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// BayerOffset returns the ordered dithering offset to add to every channel
+// of the pixel (or cell) at x, y before matching it against a palette of n
+// colors. The pattern amplitude shrinks as the palette gets denser.
+func BayerOffset(x, y, n int) float64 {
+	amp := 255 / (math.Cbrt(float64(n)) + 1)
+	return ((bayer4[y%4][x%4]+0.5)/16 - 0.5) * amp
+}
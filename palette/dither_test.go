@@ -0,0 +1,36 @@
+package palette
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBayerOffset(t *testing.T) {
+	for _, n := range []int{16, 99, 256} {
+		amp := 255 / (math.Cbrt(float64(n)) + 1)
+		var sum float64
+		seen := map[float64]bool{}
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				v := BayerOffset(x, y, n)
+				if math.Abs(v) >= amp/2 {
+					t.Errorf("n=%d: offset %v at %d,%d outside ±%v", n, v, x, y, amp/2)
+				}
+				if BayerOffset(x+4, y+8, n) != v {
+					t.Errorf("n=%d: pattern does not repeat every 4 cells", n)
+				}
+				sum += v
+				seen[v] = true
+			}
+		}
+		if math.Abs(sum) > 1e-9 {
+			t.Errorf("n=%d: offsets sum to %v, want 0", n, sum)
+		}
+		if len(seen) != 16 {
+			t.Errorf("n=%d: %d distinct offsets, want 16", n, len(seen))
+		}
+	}
+	if BayerOffset(0, 0, 256) <= BayerOffset(0, 0, 16) {
+		t.Error("denser palettes should get a smaller amplitude")
+	}
+}
@@ -0,0 +1,171 @@
+package palette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Resolve returns a built-in palette by name, or loads the palette from a
+// file if no built-in with that name exists.
+func Resolve(nameOrPath string) ([]color.RGBA, error) {
+	if p, ok := Builtin(nameOrPath); ok {
+		return p, nil
+	}
+	return Load(nameOrPath)
+}
+
+// Load reads a palette file. GIMP palettes (.gpl) and JSON palettes (.json)
+// are recognized by extension or content; anything else is read as a simple
+// list of hex colors.
+func Load(path string) ([]color.RGBA, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	ext := strings.ToLower(filepath.Ext(path))
+
+	var p []color.RGBA
+	switch {
+	case ext == ".gpl" || bytes.HasPrefix(trimmed, []byte("GIMP Palette")):
+		p, err = ParseGPL(bytes.NewReader(data))
+	case ext == ".json" || bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+		p, err = ParseJSON(bytes.NewReader(data))
+	default:
+		p, err = ParseHex(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// ParseGPL reads a GIMP palette. Each color line holds decimal R, G and B
+// values optionally followed by a name; header and comment lines are skipped.
+func ParseGPL(r io.Reader) ([]color.RGBA, error) {
+	var p []color.RGBA
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			if text != "GIMP Palette" {
+				return nil, fmt.Errorf("missing \"GIMP Palette\" header")
+			}
+			continue
+		}
+		if text == "" || strings.HasPrefix(text, "#") || (strings.Contains(text, ":") && !startsWithDigit(text)) {
+			continue // Comments and "Name:"/"Columns:" headers.
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected R G B values", line)
+		}
+		var rgb [3]uint8
+		for i := 0; i < 3; i++ {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid channel value %q", line, fields[i])
+			}
+			rgb[i] = uint8(v)
+		}
+		p = append(p, color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xFF})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nonEmpty(p)
+}
+
+// ParseJSON reads either a plain array of hex strings or an object with a
+// "colors" array, e.g. {"name": "hexchat", "colors": ["#d3d7cf", ...]}.
+func ParseJSON(r io.Reader) ([]color.RGBA, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var hexes []string
+	if err := json.Unmarshal(data, &hexes); err != nil {
+		var obj struct {
+			Colors []string `json:"colors"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+		hexes = obj.Colors
+	}
+
+	p := make([]color.RGBA, 0, len(hexes))
+	for i, h := range hexes {
+		c, err := ParseHexColor(h)
+		if err != nil {
+			return nil, fmt.Errorf("color %d: %w", i, err)
+		}
+		p = append(p, c)
+	}
+	return nonEmpty(p)
+}
+
+// ParseHex reads a list of hex colors separated by whitespace or commas.
+// Lines starting with "//" or ";" are comments.
+func ParseHex(r io.Reader) ([]color.RGBA, error) {
+	var p []color.RGBA
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "//") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			c, err := ParseHexColor(field)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			p = append(p, c)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nonEmpty(p)
+}
+
+// ParseHexColor parses "#rrggbb", "0xrrggbb", "rrggbb" or the short "#rgb".
+func ParseHexColor(s string) (color.RGBA, error) {
+	h := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "#"), "0x")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid hex color %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xFF}, nil
+}
+
+func startsWithDigit(s string) bool {
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+func nonEmpty(p []color.RGBA) ([]color.RGBA, error) {
+	if len(p) == 0 {
+		return nil, fmt.Errorf("palette contains no colors")
+	}
+	return p, nil
+}
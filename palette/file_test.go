@@ -0,0 +1,172 @@
+package palette
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	green = color.RGBA{0x00, 0x80, 0x00, 0xff}
+	blue  = color.RGBA{0x00, 0x00, 0xff, 0xff}
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"#ff0000", red, false},
+		{"0x008000", green, false},
+		{"0000ff", blue, false},
+		{"#f00", red, false},
+		{" #F00 ", red, false},
+		{"#ff00", color.RGBA{}, true},
+		{"#gg0000", color.RGBA{}, true},
+		{"", color.RGBA{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseHexColor(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseHexColor(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func(string) ([]color.RGBA, error)
+		in      string
+		want    []color.RGBA
+		wantErr bool
+	}{
+		{
+			name:  "gpl",
+			parse: func(s string) ([]color.RGBA, error) { return ParseGPL(strings.NewReader(s)) },
+			in:    "GIMP Palette\nName: test\nColumns: 4\n# comment\n255   0   0\tRed\n  0 128   0\n0 0 255 Blue\n",
+			want:  []color.RGBA{red, green, blue},
+		},
+		{
+			name:    "gpl without header",
+			parse:   func(s string) ([]color.RGBA, error) { return ParseGPL(strings.NewReader(s)) },
+			in:      "255 0 0\n",
+			wantErr: true,
+		},
+		{
+			name:    "gpl channel out of range",
+			parse:   func(s string) ([]color.RGBA, error) { return ParseGPL(strings.NewReader(s)) },
+			in:      "GIMP Palette\n256 0 0\n",
+			wantErr: true,
+		},
+		{
+			name:  "json array",
+			parse: func(s string) ([]color.RGBA, error) { return ParseJSON(strings.NewReader(s)) },
+			in:    `["#ff0000", "#008000", "#00f"]`,
+			want:  []color.RGBA{red, green, blue},
+		},
+		{
+			name:  "json object",
+			parse: func(s string) ([]color.RGBA, error) { return ParseJSON(strings.NewReader(s)) },
+			in:    `{"name": "test", "colors": ["#ff0000"]}`,
+			want:  []color.RGBA{red},
+		},
+		{
+			name:    "json empty",
+			parse:   func(s string) ([]color.RGBA, error) { return ParseJSON(strings.NewReader(s)) },
+			in:      `[]`,
+			wantErr: true,
+		},
+		{
+			name:  "hex list",
+			parse: func(s string) ([]color.RGBA, error) { return ParseHex(strings.NewReader(s)) },
+			in:    "// comment\n; comment\n#ff0000, 008000\n\n0x0000ff\n",
+			want:  []color.RGBA{red, green, blue},
+		},
+		{
+			name:    "hex list with a bad color",
+			parse:   func(s string) ([]color.RGBA, error) { return ParseHex(strings.NewReader(s)) },
+			in:      "#ff0000 nope\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadByContent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.gpl":  "GIMP Palette\n255 0 0\n",
+		"b.json": `["#ff0000"]`,
+		"c.txt":  "#ff0000\n",
+		"d":      "GIMP Palette\n255 0 0\n",
+		"e":      `{"colors": ["#ff0000"]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Load(path)
+		if err != nil || !slices.Equal(got, []color.RGBA{red}) {
+			t.Errorf("Load(%s) = %v, %v; want [%v]", name, got, err, red)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Load of a missing file succeeded")
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, name := range BuiltinNames() {
+		p, ok := Builtin(name)
+		if !ok || len(p) != 16 {
+			t.Errorf("Builtin(%q) has %d colors, want 16", name, len(p))
+		}
+	}
+	// Builtin hands out copies.
+	p, _ := Builtin("vga")
+	p[0] = red
+	if q, _ := Builtin("VGA"); q[0] == red {
+		t.Error("changing a built-in palette affected later lookups")
+	}
+	if _, err := Resolve("no-such-palette-file"); err == nil {
+		t.Error("Resolve of an unknown name succeeded")
+	}
+}
+
+func TestBuiltinsDistinct(t *testing.T) {
+	seen := map[string]string{}
+	for name, hexes := range builtins {
+		key := strings.Join(hexes, ",")
+		if prev, ok := seen[key]; ok {
+			t.Errorf("built-in palettes %q and %q are identical; make one an alias", prev, name)
+		}
+		seen[key] = name
+	}
+	for alias, target := range aliases {
+		if _, ok := builtins[target]; !ok {
+			t.Errorf("alias %q names unknown palette %q", alias, target)
+		}
+		p, _ := Builtin(alias)
+		q, _ := Builtin(target)
+		if !slices.Equal(p, q) {
+			t.Errorf("Builtin(%q) differs from Builtin(%q)", alias, target)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+	"slices"
+	"sync"
+)
+
+const (
+	// maxCachedMatches bounds the lookup cache of a Matcher so that
+	// photographic input (millions of distinct colors) cannot grow it without
+	// limit.
+	maxCachedMatches = 1 << 16
+	// maxCachedPalettes bounds the number of palettes Nearest keeps a
+	// Matcher for.
+	maxCachedPalettes = 64
+)
+
+var (
+	mu     sync.RWMutex
+	metric = RGB
+	// matchers holds the Matchers used by Nearest, by palette hash. Entries
+	// with the same hash are told apart by comparing the palettes.
+	matchers = map[uint64][]*Matcher{}
+	cached   int
+)
+
+// SetMetric selects the metric used by Nearest and flushes the lookup cache.
+func SetMetric(m Metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	metric = m
+	matchers = map[uint64][]*Matcher{}
+	cached = 0
+}
+
+// CurrentMetric returns the metric used by Nearest.
+func CurrentMetric() Metric {
+	mu.RLock()
+	defer mu.RUnlock()
+	return metric
+}
+
+// Nearest returns the index of the palette entry closest to c using the
+// current metric. Results are cached by palette contents, so repeated lookups
+// of the same color (the common case for text art) are cheap, and changing a
+// palette in place is safe. Loops matching many colors against one palette
+// should use a Matcher directly.
+func Nearest(pal []color.RGBA, c color.RGBA) int {
+	if len(pal) == 0 {
+		return 0
+	}
+	return matcherFor(pal).Nearest(c)
+}
+
+// matcherFor returns the cached Matcher for the palette, creating it if
+// needed.
+func matcherFor(pal []color.RGBA) *Matcher {
+	h := hashPalette(pal)
+	mu.RLock()
+	for _, m := range matchers[h] {
+		if slices.Equal(m.pal, pal) {
+			mu.RUnlock()
+			return m
+		}
+	}
+	mu.RUnlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, m := range matchers[h] {
+		if slices.Equal(m.pal, pal) {
+			return m
+		}
+	}
+	if cached >= maxCachedPalettes {
+		matchers = map[uint64][]*Matcher{}
+		cached = 0
+	}
+	m := NewMatcher(pal, metric)
+	matchers[h] = append(matchers[h], m)
+	cached++
+	return m
+}
+
+// hashPalette is the FNV-1a hash of the palette colors.
+func hashPalette(pal []color.RGBA) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range pal {
+		for _, b := range [4]uint8{c.R, c.G, c.B, c.A} {
+			h ^= uint64(b)
+			h *= 1099511628211
+		}
+	}
+	return h
+}
+
+// Matcher finds the entries of one palette closest to arbitrary colors. It
+// copies the palette and caches its results, so it should be reused for all
+// lookups against that palette. It is safe for concurrent use.
+type Matcher struct {
+	pal    []color.RGBA
+	metric Metric
+	// labs holds the CIELAB values of the palette for the Lab metrics, so
+	// that the palette side of the conversion is only done once.
+	labs []lab
+
+	mu      sync.RWMutex
+	matches map[color.RGBA]int
+}
+
+// NewMatcher creates a Matcher for the palette using the metric m.
+func NewMatcher(pal []color.RGBA, m Metric) *Matcher {
+	matcher := &Matcher{
+		pal:     slices.Clone(pal),
+		metric:  m,
+		matches: map[color.RGBA]int{},
+	}
+	if m == CIE76 || m == CIEDE2000 {
+		matcher.labs = make([]lab, len(pal))
+		for i, p := range pal {
+			matcher.labs[i] = toLab(p)
+		}
+	}
+	return matcher
+}
+
+// Nearest returns the index of the palette entry closest to c.
+func (m *Matcher) Nearest(c color.RGBA) int {
+	if len(m.pal) == 0 {
+		return 0
+	}
+	m.mu.RLock()
+	idx, ok := m.matches[c]
+	m.mu.RUnlock()
+	if ok {
+		return idx
+	}
+
+	if m.labs != nil {
+		idx = m.nearestLab(toLab(c))
+	} else {
+		idx = m.nearestRGB(c)
+	}
+
+	m.mu.Lock()
+	if len(m.matches) >= maxCachedMatches {
+		m.matches = map[color.RGBA]int{}
+	}
+	m.matches[c] = idx
+	m.mu.Unlock()
+	return idx
+}
+
+func (m *Matcher) nearestRGB(c color.RGBA) int {
+	closestIndex := 0
+	minDist := math.MaxFloat64
+	for i, p := range m.pal {
+		dist := Distance(m.metric, c, p)
+		if dist < minDist {
+			minDist = dist
+			closestIndex = i
+		}
+	}
+	return closestIndex
+}
+
+func (m *Matcher) nearestLab(target lab) int {
+	closestIndex := 0
+	minDist := math.MaxFloat64
+	for i, e := range m.labs {
+		var dist float64
+		if m.metric == CIEDE2000 {
+			dist = ciede2000(target, e)
+		} else {
+			dist = cie76(target, e)
+		}
+		if dist < minDist {
+			minDist = dist
+			closestIndex = i
+		}
+	}
+	return closestIndex
+}
@@ -0,0 +1,96 @@
+package palette
+
+import (
+	"image/color"
+	"sync"
+	"testing"
+)
+
+var testPalette = []color.RGBA{
+	{0x00, 0x00, 0x00, 0xff},
+	{0xaa, 0x00, 0x00, 0xff},
+	{0x00, 0xaa, 0x00, 0xff},
+	{0x00, 0x00, 0xaa, 0xff},
+	{0xff, 0xff, 0xff, 0xff},
+}
+
+func TestMatcherNearest(t *testing.T) {
+	tests := []struct {
+		c    color.RGBA
+		want int
+	}{
+		{color.RGBA{0x00, 0x00, 0x00, 0xff}, 0},
+		{color.RGBA{0x10, 0x08, 0x08, 0xff}, 0},
+		{color.RGBA{0xc0, 0x10, 0x10, 0xff}, 1},
+		{color.RGBA{0x20, 0x90, 0x20, 0xff}, 2},
+		{color.RGBA{0x00, 0x00, 0xcc, 0xff}, 3},
+		{color.RGBA{0xf0, 0xf0, 0xf0, 0xff}, 4},
+	}
+	for _, m := range []Metric{RGB, Redmean, CIE76, CIEDE2000} {
+		matcher := NewMatcher(testPalette, m)
+		for _, tt := range tests {
+			// The second lookup is served from the cache.
+			for range 2 {
+				if got := matcher.Nearest(tt.c); got != tt.want {
+					t.Errorf("%v: Nearest(%v) = %d, want %d", m, tt.c, got, tt.want)
+				}
+			}
+		}
+	}
+}
+
+func TestNearestFollowsPaletteChanges(t *testing.T) {
+	pal := []color.RGBA{{0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	gray := color.RGBA{0x40, 0x40, 0x40, 0xff}
+	if got := Nearest(pal, gray); got != 0 {
+		t.Fatalf("Nearest = %d, want 0", got)
+	}
+	// Changing the palette in place must not return the cached result.
+	pal[1] = color.RGBA{0x40, 0x40, 0x40, 0xff}
+	if got := Nearest(pal, gray); got != 1 {
+		t.Errorf("after changing the palette, Nearest = %d, want 1", got)
+	}
+}
+
+func TestSetMetricFlushesCache(t *testing.T) {
+	defer SetMetric(CurrentMetric())
+
+	// Plain RGB and redmean disagree on this color.
+	pal := []color.RGBA{{0xff, 0x00, 0x00, 0xff}, {0x80, 0x80, 0x80, 0xff}}
+	c := color.RGBA{0xc0, 0x40, 0x60, 0xff}
+	want := map[Metric]int{}
+	for _, m := range []Metric{RGB, Redmean, CIE76, CIEDE2000} {
+		want[m] = NewMatcher(pal, m).Nearest(c)
+	}
+	for _, m := range []Metric{RGB, CIEDE2000, Redmean, CIE76, RGB} {
+		SetMetric(m)
+		if got := Nearest(pal, c); got != want[m] {
+			t.Errorf("%v: Nearest = %d, want %d", m, got, want[m])
+		}
+	}
+}
+
+func TestNearestConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range 256 {
+				c := color.RGBA{uint8(v), uint8(v * i), 0, 0xff}
+				want := NewMatcher(testPalette, CurrentMetric()).Nearest(c)
+				if got := Nearest(testPalette, c); got != want {
+					t.Errorf("Nearest(%v) = %d, want %d", c, got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNearestEmptyPalette(t *testing.T) {
+	if got := Nearest(nil, color.RGBA{}); got != 0 {
+		t.Errorf("Nearest(nil) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,169 @@
+// Package plain reads and writes uncolored text, such as ASCII art, NFO
+// files and Amiga art.
+package plain
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/diag"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// DefaultTabWidth is the tab stop interval when Options.TabWidth is zero.
+const DefaultTabWidth = canvas.DefaultTabWidth
+
+// Encoding selects how input bytes map to characters.
+type Encoding int
+
+const (
+	// Auto reads valid UTF-8 as UTF-8 and anything else as CP437.
+	Auto Encoding = iota
+	UTF8
+	// CP437 is the DOS code page. Control bytes show as their pictographs
+	// (☺, ♥, ...), as they did on screen.
+	CP437
+	// Latin1 is ISO 8859-1, the character set of Amiga text.
+	Latin1
+)
+
+// Options controls how text is read.
+type Options struct {
+	Encoding Encoding
+	// TabWidth is the tab stop interval; zero means DefaultTabWidth.
+	TabWidth int
+	// Truncate cuts lines longer than the canvas instead of wrapping them.
+	Truncate bool
+}
+
+// ParseEncoding parses an encoding name: "auto", "utf8", "cp437" or
+// "latin1".
+func ParseEncoding(s string) (Encoding, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return Auto, nil
+	case "utf8", "utf-8":
+		return UTF8, nil
+	case "cp437", "ibm437", "dos":
+		return CP437, nil
+	case "latin1", "iso-8859-1", "amiga":
+		return Latin1, nil
+	}
+	return 0, fmt.Errorf("unknown text encoding %q (want auto, utf8, cp437 or latin1)", s)
+}
+
+// Parser reads plain text into a canvas with the default colors.
+type Parser struct {
+	canvas *canvas.Canvas
+	reader io.Reader
+	opts   Options
+	// col is the column within the current line, which keeps counting past
+	// the canvas width so that long lines can be truncated.
+	col int
+
+	// Diagnostics, if not nil, collects the invalid UTF-8 and the control
+	// characters skipped in UTF-8 and Latin-1 text.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new plain text parser.
+func NewParser(c *canvas.Canvas, r io.Reader, opts Options) *Parser {
+	if opts.TabWidth <= 0 {
+		opts.TabWidth = DefaultTabWidth
+	}
+	return &Parser{
+		canvas: c,
+		reader: r,
+		opts:   opts,
+	}
+}
+
+// Parse reads the text and updates the canvas.
+func (p *Parser) Parse() error {
+	data, err := io.ReadAll(p.reader)
+	if err != nil {
+		return err
+	}
+	if i := bytes.IndexByte(data, '\x1a'); i >= 0 { // SAUCE separator.
+		data = data[:i]
+	}
+
+	enc := p.opts.Encoding
+	if enc == Auto {
+		enc = CP437
+		if utf8.Valid(data) {
+			enc = UTF8
+		}
+	}
+	end := int64(len(data))
+	if enc == UTF8 {
+		data = bytes.TrimPrefix(data, []byte("\uFEFF"))
+	}
+
+	for len(data) > 0 {
+		offset := end - int64(len(data))
+		r, size := decodeRune(data, enc)
+		if r == utf8.RuneError && size == 1 && enc == UTF8 {
+			p.report(offset, diag.Error, "invalid UTF-8 byte")
+		}
+		data = data[size:]
+
+		switch r {
+		case '\n':
+			p.canvas.NewLine()
+			p.col = 0
+		case '\r':
+			p.canvas.Cursor.Col = 0
+			p.col = 0
+		case '\t':
+			for n := p.opts.TabWidth - p.col%p.opts.TabWidth; n > 0; n-- {
+				p.put(' ')
+			}
+		default:
+			if r < 0x20 || r == 0x7F {
+				if enc != CP437 {
+					p.report(offset, diag.Warning, fmt.Sprintf("control character 0x%02x skipped", r))
+					continue
+				}
+				r = cp437.ToUnicode(r)
+			}
+			p.put(r)
+		}
+	}
+	return nil
+}
+
+// report records a diagnostic for the character at offset, at the cursor.
+func (p *Parser) report(offset int64, sev diag.Severity, msg string) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   offset,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: sev,
+		Message:  msg,
+	})
+}
+
+func (p *Parser) put(r rune) {
+	p.col++
+	if p.opts.Truncate && p.col > p.canvas.Width() {
+		return
+	}
+	p.canvas.SetCell(r, canvas.DefaultFg, canvas.DefaultBg, canvas.DefaultBold, false, canvas.DefaultIce)
+}
+
+// decodeRune decodes the first character of data.
+func decodeRune(data []byte, enc Encoding) (rune, int) {
+	switch enc {
+	case UTF8:
+		return utf8.DecodeRune(data)
+	case Latin1:
+		return charmap.ISO8859_1.DecodeByte(data[0]), 1
+	}
+	return charmap.CodePage437.DecodeByte(data[0]), 1
+}
@@ -0,0 +1,139 @@
+package plain
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// parse reads input into a canvas width columns wide and returns it written
+// back as text.
+func parse(t *testing.T, input string, width int, opts Options) string {
+	t.Helper()
+	return parseWrap(t, input, width, opts, canvas.PendingWrap)
+}
+
+func parseWrap(t *testing.T, input string, width int, opts Options, wrap canvas.WrapMode) string {
+	t.Helper()
+	c := canvas.NewCanvas(width)
+	c.Wrap = wrap
+	if err := NewParser(c, strings.NewReader(input), opts).Parse(); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := NewWriter(c, &out).Write(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		width int
+		opts  Options
+		want  string
+	}{
+		{"lines", "ab\r\ncd\n", 80, Options{}, "ab\ncd\n"},
+		{"carriage return overwrites", "abc\rX\n", 80, Options{}, "Xbc\n"},
+		{"tabs", "a\tb\n\tc", 80, Options{}, "a       b\n        c\n"},
+		{"tab width", "a\tb", 80, Options{TabWidth: 4}, "a   b\n"},
+		{"wrap", "abcdef", 4, Options{}, "abcd\nef\n"},
+		{"line filling the row", "abcd\nef", 4, Options{}, "abcd\nef\n"},
+		{"truncate", "abcdef\ngh", 4, Options{Truncate: true}, "abcd\ngh\n"},
+		{"stops at SAUCE", "ab\x1aSAUCE00", 80, Options{}, "ab\n"},
+		{"utf-8", "\uFEFF╔═╗\n", 80, Options{}, "╔═╗\n"},
+		{"cp437 fallback", "\xc9\xcd\xbb", 80, Options{}, "╔═╗\n"},
+		{"cp437 control glyphs", "\x01\x03", 80, Options{Encoding: CP437}, "☺♥\n"},
+		{"utf-8 drops controls", "a\x01b", 80, Options{Encoding: UTF8}, "ab\n"},
+		{"latin1", "caf\xe9", 80, Options{Encoding: Latin1}, "café\n"},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.input, tt.width, tt.opts); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWrapModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  Options
+		wrap  canvas.WrapMode
+		want  string
+	}{
+		{"pending full line", "abcd\nef", Options{}, canvas.PendingWrap, "abcd\nef\n"},
+		{"immediate full line", "abcd\nef", Options{}, canvas.ImmediateWrap, "abcd\n\nef\n"},
+		{"immediate full line with CRLF", "abcd\r\nef", Options{}, canvas.ImmediateWrap, "abcd\n\nef\n"},
+		{"pending long line", "abcdef\ng", Options{}, canvas.PendingWrap, "abcd\nef\ng\n"},
+		{"immediate long line", "abcdef\ng", Options{}, canvas.ImmediateWrap, "abcd\nef\ng\n"},
+		{"immediate short line", "ab\ncd", Options{}, canvas.ImmediateWrap, "ab\ncd\n"},
+		{"pending truncated line", "abcdef\ng", Options{Truncate: true}, canvas.PendingWrap, "abcd\ng\n"},
+	}
+	for _, tt := range tests {
+		if got := parseWrap(t, tt.input, 4, tt.opts, tt.wrap); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	text := "  ╔══╗\n  ║ab║\n  ╚══╝\n\nend\n"
+	if got := parse(t, text, 80, Options{}); got != text {
+		t.Errorf("round trip = %q, want %q", got, text)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Encoding
+		wantErr bool
+	}{
+		{"", Auto, false},
+		{"UTF-8", UTF8, false},
+		{"dos", CP437, false},
+		{"amiga", Latin1, false},
+		{"ebcdic", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEncoding(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseEncoding(%q) = %v, %v, want %v, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		enc   Encoding
+		want  []string
+	}{
+		{"clean", "ab\ncd", Auto, nil},
+		{"cp437 controls are glyphs", "a\x01b\xff", Auto, nil},
+		{"invalid utf-8", "ab\xffc", UTF8, []string{"1:3 (byte 2): error: invalid UTF-8 byte"}},
+		{"bom", "\uFEFFa\x1bb", UTF8, []string{"1:2 (byte 4): warning: control character 0x1b skipped"}},
+		{"latin1 control", "a\n\x07b", Latin1, []string{"2:1 (byte 2): warning: control character 0x07 skipped"}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		p := NewParser(c, strings.NewReader(tt.input), Options{Encoding: tt.enc})
+		p.Diagnostics = &diag.Collector{}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package plain
+
+import (
+	"a2m2a/canvas"
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Writer converts a canvas to plain text, dropping all color information.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+}
+
+// NewWriter creates a new plain text writer.
+func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+	}
+}
+
+// Write generates UTF-8 text from the canvas. Trailing spaces are trimmed
+// from every line and trailing empty lines are not written.
+func (w *Writer) Write() error {
+	bw := bufio.NewWriter(w.writer)
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+
+	var line strings.Builder
+	for r := 0; r <= maxRow && r < len(w.canvas.Grid); r++ {
+		line.Reset()
+		for _, cell := range w.canvas.Grid[r] {
+			line.WriteRune(cell.Char)
+		}
+		if _, err := bw.WriteString(strings.TrimRight(line.String(), " ") + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,187 @@
+// Package quantize reduces the colors of a parsed canvas to a small palette,
+// optionally dithering out-of-palette colors with shade characters or an
+// ordered pattern instead of flattening them into bands.
+package quantize
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/palette"
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+)
+
+// Mode selects how colors outside the palette are approximated.
+type Mode int
+
+const (
+	// Nearest snaps every color to the closest palette color.
+	Nearest Mode = iota
+	// Shade draws solid cells (spaces and full blocks) whose color is not in
+	// the palette as ░▒▓ mixes of two palette colors.
+	Shade
+	// Ordered offsets every color by a 4x4 Bayer pattern across the cells
+	// before snapping, so gradients turn into alternating colors.
+	Ordered
+)
+
+// ParseMode parses a mode name: "nearest", "shade" or "ordered".
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "nearest", "none":
+		return Nearest, nil
+	case "shade":
+		return Shade, nil
+	case "ordered":
+		return Ordered, nil
+	}
+	return 0, fmt.Errorf("unknown quantization mode %q (want nearest, shade or ordered)", s)
+}
+
+// String returns the mode's name.
+func (m Mode) String() string {
+	switch m {
+	case Shade:
+		return "shade"
+	case Ordered:
+		return "ordered"
+	}
+	return "nearest"
+}
+
+// shades are the characters used for mixes, by fraction of foreground.
+var shades = []struct {
+	char rune
+	fg   float64
+}{
+	{'░', 0.25},
+	{'▒', 0.5},
+	{'▓', 0.75},
+}
+
+// Apply reduces every cell color of c to pal in place.
+func Apply(c *canvas.Canvas, pal []color.RGBA, mode Mode) {
+	metric := palette.CurrentMetric()
+	q := quantizer{pal: pal, metric: metric, matcher: palette.NewMatcher(pal, metric), mixes: map[color.RGBA]mix{}}
+	for r, row := range c.Grid {
+		for col := range row {
+			cell := &row[col]
+			switch mode {
+			case Shade:
+				q.shade(cell)
+			case Ordered:
+				q.ordered(cell, r, col)
+			default:
+				cell.Fg, cell.Bg = q.nearest(cell.Fg), q.nearest(cell.Bg)
+			}
+		}
+	}
+}
+
+// mix is the best way found to draw a solid color: char in fg over bg.
+type mix struct {
+	char   rune
+	fg, bg color.RGBA
+}
+
+type quantizer struct {
+	pal     []color.RGBA
+	metric  palette.Metric
+	matcher *palette.Matcher
+	mixes   map[color.RGBA]mix
+}
+
+func (q *quantizer) nearest(c color.RGBA) color.RGBA {
+	return q.pal[q.matcher.Nearest(c)]
+}
+
+// shade replaces a solid cell by the closest mix of two palette colors.
+// Cells showing any other glyph keep it and get their colors snapped.
+func (q *quantizer) shade(cell *canvas.Cell) {
+	var solid color.RGBA
+	switch cell.Char {
+	case ' ':
+		solid = cell.Bg
+	case '█':
+		solid = cell.Fg
+	default:
+		cell.Fg, cell.Bg = q.nearest(cell.Fg), q.nearest(cell.Bg)
+		return
+	}
+
+	m, ok := q.mixes[solid]
+	if !ok {
+		m = q.bestMix(solid)
+		q.mixes[solid] = m
+	}
+	cell.Char, cell.Fg, cell.Bg = m.char, m.fg, m.bg
+}
+
+// bestMix tries every pair of palette colors at every shade density. A
+// plain space wins ties, so colors in the palette stay solid.
+func (q *quantizer) bestMix(target color.RGBA) mix {
+	near := q.nearest(target)
+	best := mix{char: ' ', fg: near, bg: near}
+	bestDist := palette.Distance(q.metric, target, near)
+	for i, a := range q.pal {
+		for j, b := range q.pal {
+			if i == j {
+				continue
+			}
+			for _, s := range shades {
+				d := palette.Distance(q.metric, target, blend(b, a, s.fg))
+				if d < bestDist {
+					best, bestDist = mix{char: s.char, fg: b, bg: a}, d
+				}
+			}
+		}
+	}
+	if best.char == ' ' {
+		return best
+	}
+
+	// Bright backgrounds need iCE colors in classic ANSI, so prefer the
+	// complementary shade with the colors swapped when that helps.
+	if len(q.pal) == 16 && paletteIndex(q.pal, best.bg) >= 8 && paletteIndex(q.pal, best.fg) < 8 {
+		switch best.char {
+		case '░':
+			best.char = '▓'
+		case '▓':
+			best.char = '░'
+		}
+		best.fg, best.bg = best.bg, best.fg
+	}
+	return best
+}
+
+// ordered snaps the cell's colors after offsetting them by the threshold
+// pattern at the cell's position.
+func (q *quantizer) ordered(cell *canvas.Cell, row, col int) {
+	t := palette.BayerOffset(col, row, len(q.pal))
+	cell.Fg, cell.Bg = q.nearest(offset(cell.Fg, t)), q.nearest(offset(cell.Bg, t))
+}
+
+// blend mixes fraction f of a with b.
+func blend(a, b color.RGBA, f float64) color.RGBA {
+	ch := func(x, y uint8) uint8 {
+		return uint8(float64(x)*f + float64(y)*(1-f) + 0.5)
+	}
+	return color.RGBA{ch(a.R, b.R), ch(a.G, b.G), ch(a.B, b.B), 0xff}
+}
+
+func offset(c color.RGBA, t float64) color.RGBA {
+	ch := func(v uint8) uint8 {
+		return uint8(math.Max(0, math.Min(255, float64(v)+t)) + 0.5)
+	}
+	return color.RGBA{ch(c.R), ch(c.G), ch(c.B), c.A}
+}
+
+func paletteIndex(pal []color.RGBA, c color.RGBA) int {
+	for i, p := range pal {
+		if p == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,117 @@
+package quantize
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"image/color"
+	"testing"
+)
+
+var pal = ansi.AnsiPalette
+
+// solid returns a canvas of width cells showing the color c.
+func solid(width int, char rune, c color.RGBA) *canvas.Canvas {
+	cv := canvas.NewCanvas(width)
+	for i := 0; i < width; i++ {
+		if char == '█' {
+			cv.Put(canvas.Cell{Char: char, Fg: c, Bg: canvas.DefaultBg})
+		} else {
+			cv.Put(canvas.Cell{Char: char, Fg: canvas.DefaultFg, Bg: c})
+		}
+	}
+	return cv
+}
+
+func inPalette(c color.RGBA) bool {
+	for _, p := range pal {
+		if p == c {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseMode(t *testing.T) {
+	for _, mode := range []Mode{Nearest, Shade, Ordered} {
+		got, err := ParseMode(mode.String())
+		if err != nil || got != mode {
+			t.Errorf("ParseMode(%q) = %v, %v", mode, got, err)
+		}
+	}
+	if _, err := ParseMode("random"); err == nil {
+		t.Error("ParseMode accepted an unknown mode")
+	}
+}
+
+func TestApply(t *testing.T) {
+	orange := color.RGBA{0xd0, 0x70, 0x10, 0xff}
+	tests := []struct {
+		name string
+		char rune
+		c    color.RGBA
+		mode Mode
+		// wantChar is the character of the first cell, 0 for unchanged.
+		wantChar rune
+	}{
+		{"nearest", ' ', orange, Nearest, ' '},
+		{"in palette stays solid", ' ', pal[4], Shade, ' '},
+		{"shaded background", ' ', color.RGBA{0x55, 0x00, 0x00, 0xff}, Shade, '▒'},
+		{"shaded full block", '█', color.RGBA{0x55, 0x00, 0x00, 0xff}, Shade, '▒'},
+		{"other glyphs snap", 'x', orange, Shade, 'x'},
+		{"ordered", ' ', orange, Ordered, ' '},
+	}
+	for _, tt := range tests {
+		c := solid(8, tt.char, tt.c)
+		Apply(c, pal, tt.mode)
+		for i, cell := range c.Grid[0] {
+			if !inPalette(cell.Fg) || !inPalette(cell.Bg) {
+				t.Errorf("%s: cell %d has colors %v on %v outside the palette", tt.name, i, cell.Fg, cell.Bg)
+			}
+		}
+		if got := c.Grid[0][0].Char; got != tt.wantChar {
+			t.Errorf("%s: char %q, want %q", tt.name, got, tt.wantChar)
+		}
+	}
+}
+
+func TestShadeMix(t *testing.T) {
+	// Half red, half black is a medium shade of the two.
+	c := solid(1, ' ', color.RGBA{0x55, 0x00, 0x00, 0xff})
+	Apply(c, pal, Shade)
+	cell := c.Grid[0][0]
+	if cell.Char != '▒' || !(cell.Fg == pal[1] && cell.Bg == pal[0] || cell.Fg == pal[0] && cell.Bg == pal[1]) {
+		t.Errorf("got %q in %v on %v, want ▒ in red and black", cell.Char, cell.Fg, cell.Bg)
+	}
+
+	// Bright colors are kept out of the background.
+	c = solid(1, ' ', color.RGBA{0xd5, 0xd5, 0xd5, 0xff})
+	Apply(c, pal, Shade)
+	cell = c.Grid[0][0]
+	for i := 8; i < 16; i++ {
+		if cell.Char != ' ' && cell.Bg == pal[i] {
+			t.Errorf("got %q in %v on bright %v", cell.Char, cell.Fg, cell.Bg)
+		}
+	}
+}
+
+func TestOrderedVaries(t *testing.T) {
+	// A color between two palette entries alternates across the pattern
+	// instead of flattening into one.
+	c := solid(4, ' ', color.RGBA{0x55, 0x00, 0x00, 0xff})
+	for range 3 {
+		c.NewLine()
+		for range 4 {
+			c.Put(canvas.Cell{Char: ' ', Fg: canvas.DefaultFg, Bg: color.RGBA{0x55, 0x00, 0x00, 0xff}})
+		}
+	}
+	Apply(c, pal, Ordered)
+	seen := map[color.RGBA]bool{}
+	for _, row := range c.Grid {
+		for _, cell := range row[:4] {
+			seen[cell.Bg] = true
+		}
+	}
+	if len(seen) < 2 {
+		t.Errorf("ordered dithering used only %v", seen)
+	}
+}
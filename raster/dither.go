@@ -0,0 +1,79 @@
+package raster
+
+import (
+	"a2m2a/palette"
+	"image"
+	"image/color"
+)
+
+// quantize maps every pixel of img to a palette index, row by row.
+func quantize(img *image.RGBA, pal []color.RGBA, dither Dither) []int {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	idx := make([]int, w*h)
+	m := palette.NewMatcher(pal, palette.CurrentMetric())
+
+	switch dither {
+	case FloydSteinberg:
+		// Work on a float copy so the diffused error can over- and undershoot.
+		buf := make([][3]float64, w*h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := img.RGBAAt(b.Min.X+x, b.Min.Y+y)
+				buf[y*w+x] = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+			}
+		}
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				old := buf[y*w+x]
+				i := m.Nearest(toRGBA(old))
+				idx[y*w+x] = i
+				p := pal[i]
+				e := [3]float64{old[0] - float64(p.R), old[1] - float64(p.G), old[2] - float64(p.B)}
+				spread := func(dx, dy int, f float64) {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || nx >= w || ny >= h {
+						return
+					}
+					for k := range e {
+						buf[ny*w+nx][k] += e[k] * f
+					}
+				}
+				spread(1, 0, 7.0/16)
+				spread(-1, 1, 3.0/16)
+				spread(0, 1, 5.0/16)
+				spread(1, 1, 1.0/16)
+			}
+		}
+	case Ordered:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := img.RGBAAt(b.Min.X+x, b.Min.Y+y)
+				t := palette.BayerOffset(x, y, len(pal))
+				v := [3]float64{float64(c.R) + t, float64(c.G) + t, float64(c.B) + t}
+				idx[y*w+x] = m.Nearest(toRGBA(v))
+			}
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				idx[y*w+x] = m.Nearest(img.RGBAAt(b.Min.X+x, b.Min.Y+y))
+			}
+		}
+	}
+	return idx
+}
+
+func toRGBA(v [3]float64) color.RGBA {
+	return color.RGBA{clamp(v[0]), clamp(v[1]), clamp(v[2]), 0xff}
+}
+
+func clamp(v float64) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
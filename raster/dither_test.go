@@ -0,0 +1,48 @@
+package raster
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	pal := []color.RGBA{{0, 0, 0, 0xff}, {0xff, 0xff, 0xff, 0xff}}
+	grey := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range grey.Pix {
+		grey.Pix[i] = 0x80
+	}
+
+	tests := []struct {
+		dither Dither
+		// wantWhite is the range of white pixels expected out of 64.
+		minWhite, maxWhite int
+	}{
+		{NoDither, 64, 64},
+		{FloydSteinberg, 24, 40},
+		{Ordered, 24, 40},
+	}
+	for _, tt := range tests {
+		idx := quantize(grey, pal, tt.dither)
+		white := 0
+		for _, i := range idx {
+			white += i
+		}
+		if white < tt.minWhite || white > tt.maxWhite {
+			t.Errorf("dither %d: %d of 64 pixels white, want %d to %d", tt.dither, white, tt.minWhite, tt.maxWhite)
+		}
+	}
+
+	// Colors in the palette are never dithered away.
+	black := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := 3; i < len(black.Pix); i += 4 {
+		black.Pix[i] = 0xff
+	}
+	for _, d := range []Dither{FloydSteinberg, Ordered} {
+		for i, v := range quantize(black, pal, d) {
+			if v != 0 {
+				t.Errorf("dither %d: black pixel %d became %d", d, i, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+// Package raster converts bitmap images (PNG, JPEG, GIF) into canvas cells
+// built from half-block or quadrant characters, so that photos can be turned
+// into ANSI or IRC art.
+package raster
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/mirc"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// DefaultColumns is the output width when Options.Columns is zero.
+const DefaultColumns = 80
+
+// Mode selects the characters each cell is built from.
+type Mode int
+
+const (
+	// HalfBlock splits every cell into an upper and a lower pixel (▀ ▄).
+	HalfBlock Mode = iota
+	// Quadrant splits every cell into 2x2 pixels (▘ ▚ ▙ ...), doubling the
+	// horizontal resolution at the cost of two colors per cell. The quadrant
+	// characters are not in CP437, so this only suits UTF-8 outputs.
+	Quadrant
+)
+
+// Dither selects how colors outside the palette are approximated.
+type Dither int
+
+const (
+	// NoDither snaps every pixel to its nearest palette color.
+	NoDither Dither = iota
+	// FloydSteinberg diffuses the error of every pixel to its neighbors.
+	FloydSteinberg
+	// Ordered adds a 4x4 Bayer threshold pattern before snapping.
+	Ordered
+)
+
+// Options controls the conversion.
+type Options struct {
+	// Columns is the width of the result; zero means DefaultColumns. The
+	// number of rows follows from the image's aspect ratio.
+	Columns int
+	Mode    Mode
+	// Palette is the set of colors cells may use; nil means the 16 ANSI
+	// colors.
+	Palette []color.RGBA
+	Dither  Dither
+}
+
+// ParseMode parses a mode name: "half" or "quad".
+func ParseMode(s string) (Mode, error) {
+	switch strings.ToLower(s) {
+	case "", "half", "halfblock":
+		return HalfBlock, nil
+	case "quad", "quadrant":
+		return Quadrant, nil
+	}
+	return 0, fmt.Errorf("unknown image mode %q (want half or quad)", s)
+}
+
+// ParseDither parses a dithering name: "none", "fs" or "ordered".
+func ParseDither(s string) (Dither, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return NoDither, nil
+	case "fs", "floyd-steinberg":
+		return FloydSteinberg, nil
+	case "ordered", "bayer":
+		return Ordered, nil
+	}
+	return 0, fmt.Errorf("unknown dithering %q (want none, fs or ordered)", s)
+}
+
+// Palette returns a target palette by name: "ansi16", "mirc99" or "256".
+func Palette(name string) ([]color.RGBA, error) {
+	switch strings.ToLower(name) {
+	case "", "ansi", "ansi16", "16":
+		return ansi.AnsiPalette, nil
+	case "mirc", "mirc99", "99":
+		return mirc.MircPalette99, nil
+	case "256", "xterm256":
+		return ansi.Palette256, nil
+	}
+	return nil, fmt.Errorf("unknown image palette %q (want ansi16, mirc99 or 256)", name)
+}
+
+// quadrantChars maps a mask of foreground pixels (1 top left, 2 top right,
+// 4 bottom left, 8 bottom right) to its block character.
+var quadrantChars = [16]rune{
+	' ', '▘', '▝', '▀', '▖', '▌', '▞', '▛',
+	'▗', '▚', '▐', '▜', '▄', '▙', '▟', '█',
+}
+
+// ToCanvas converts an image into a new canvas. The number of rows follows
+// from the aspect ratio; an image so narrow that they would exceed the canvas
+// limits is refused with an error wrapping canvas.ErrTooLarge.
+func ToCanvas(img image.Image, opts Options) (*canvas.Canvas, error) {
+	cols := opts.Columns
+	if cols <= 0 {
+		cols = DefaultColumns
+	}
+	pal := opts.Palette
+	if len(pal) == 0 {
+		pal = ansi.AnsiPalette
+	}
+
+	// Cells are about twice as tall as they are wide, so a half-block pixel
+	// is square and a quadrant pixel twice as tall as it is wide.
+	pxW, pxH := 1, 2
+	if opts.Mode == Quadrant {
+		pxW = 2
+	}
+	b := img.Bounds()
+	rows := 1
+	if b.Dx() > 0 {
+		rows = (b.Dy()*cols + b.Dx()) / (2 * b.Dx())
+	}
+	if rows < 1 {
+		rows = 1
+	}
+	// Check before the scaled image is allocated: a tall, narrow image of
+	// few pixels can ask for billions of rows.
+	if rows > min(canvas.MaxRows, canvas.MaxCells/cols) {
+		return nil, fmt.Errorf("%w: a %dx%d image needs %d rows of %d columns", canvas.ErrTooLarge, b.Dx(), b.Dy(), rows, cols)
+	}
+	width := cols * pxW
+	height := rows * pxH
+
+	// Resample, flattening any transparency onto the canvas background.
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.Draw(scaled, scaled.Bounds(), &image.Uniform{C: canvas.DefaultBg}, image.Point{}, xdraw.Src)
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, b, xdraw.Over, nil)
+
+	idx := quantize(scaled, pal, opts.Dither)
+
+	c := canvas.NewCanvas(cols)
+	for r := 0; r < rows; r++ {
+		for col := 0; col < cols; col++ {
+			var px [4]int
+			if opts.Mode == Quadrant {
+				x, y := col*2, r*2
+				px = [4]int{idx[y*width+x], idx[y*width+x+1], idx[(y+1)*width+x], idx[(y+1)*width+x+1]}
+			} else {
+				top, bottom := idx[2*r*width+col], idx[(2*r+1)*width+col]
+				px = [4]int{top, top, bottom, bottom}
+			}
+			c.SetCursor(r, col)
+			c.Put(cellFor(px, pal))
+		}
+	}
+	return c, nil
+}
+
+// cellFor picks the two most common colors of a cell's pixels and the block
+// character that draws the first of them over the second.
+func cellFor(px [4]int, pal []color.RGBA) canvas.Cell {
+	fg, bg := twoColors(px)
+	if fg == bg {
+		return canvas.Cell{Char: '█', Fg: pal[fg], Bg: canvas.DefaultBg}
+	}
+
+	mask := 0
+	for i, p := range px {
+		if p == fg || p != bg && nearer(pal, p, fg, bg) {
+			mask |= 1 << i
+		}
+	}
+	// Classic ANSI art can only use the bright colors as a background with
+	// iCE colors, so keep them in the foreground where possible.
+	if len(pal) == 16 && bg >= 8 && fg < 8 {
+		fg, bg, mask = bg, fg, mask^15
+	}
+	return canvas.Cell{Char: quadrantChars[mask], Fg: pal[fg], Bg: pal[bg]}
+}
+
+// twoColors returns the most and second most common colors of px, or the
+// same color twice if the cell has only one.
+func twoColors(px [4]int) (int, int) {
+	counts := map[int]int{}
+	for _, p := range px {
+		counts[p]++
+	}
+	first, second := px[0], -1
+	for _, p := range px {
+		if counts[p] > counts[first] {
+			first = p
+		}
+	}
+	for _, p := range px {
+		if p != first && (second < 0 || counts[p] > counts[second]) {
+			second = p
+		}
+	}
+	if second < 0 {
+		return first, first
+	}
+	return first, second
+}
+
+// nearer reports whether palette color p is closer to a than to b.
+func nearer(pal []color.RGBA, p, a, b int) bool {
+	return sqDist(pal[p], pal[a]) <= sqDist(pal[p], pal[b])
+}
+
+func sqDist(a, b color.RGBA) int {
+	dr, dg, db := int(a.R)-int(b.R), int(a.G)-int(b.G), int(a.B)-int(b.B)
+	return dr*dr + dg*dg + db*db
+}
@@ -0,0 +1,173 @@
+package raster
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+var (
+	red    = ansi.AnsiPalette[1]
+	blue   = ansi.AnsiPalette[4]
+	yellow = ansi.AnsiPalette[11]
+)
+
+// pixels builds an image from rows of colors.
+func pixels(rows ...[]color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestToCanvas(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		opts Options
+		want []canvas.Cell
+	}{
+		{
+			name: "half blocks",
+			img:  pixels([]color.RGBA{red, blue}, []color.RGBA{blue, blue}),
+			opts: Options{Columns: 2},
+			want: []canvas.Cell{
+				{Char: '▀', Fg: red, Bg: blue},
+				{Char: '█', Fg: blue, Bg: canvas.DefaultBg},
+			},
+		},
+		{
+			name: "quadrants",
+			img:  pixels([]color.RGBA{red, blue, red, red}, []color.RGBA{blue, red, red, red}),
+			opts: Options{Columns: 2, Mode: Quadrant},
+			want: []canvas.Cell{
+				{Char: '▚', Fg: red, Bg: blue},
+				{Char: '█', Fg: red, Bg: canvas.DefaultBg},
+			},
+		},
+		{
+			name: "bright color kept in the foreground",
+			img:  pixels([]color.RGBA{yellow}, []color.RGBA{red}),
+			opts: Options{Columns: 1},
+			want: []canvas.Cell{{Char: '▀', Fg: yellow, Bg: red}},
+		},
+	}
+	for _, tt := range tests {
+		c, err := ToCanvas(tt.img, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(c.Grid) != 1 {
+			t.Fatalf("%s: got %d rows, want 1", tt.name, len(c.Grid))
+		}
+		for i, want := range tt.want {
+			got := c.Grid[0][i]
+			got.Bold, got.Bright, got.Ice, got.Underline = false, false, false, false
+			if got != want {
+				t.Errorf("%s: cell %d = %+v, want %+v", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+func TestToCanvasSize(t *testing.T) {
+	tests := []struct {
+		w, h     int
+		cols     int
+		mode     Mode
+		wantRows int
+	}{
+		{160, 100, 80, HalfBlock, 25},
+		{160, 100, 0, HalfBlock, 25}, // DefaultColumns.
+		{160, 100, 80, Quadrant, 25},
+		{100, 1, 80, HalfBlock, 1},
+		{10, 100, 10, HalfBlock, 50},
+	}
+	for _, tt := range tests {
+		c, err := ToCanvas(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), Options{Columns: tt.cols, Mode: tt.mode})
+		if err != nil {
+			t.Fatalf("%dx%d: %v", tt.w, tt.h, err)
+		}
+		cols := tt.cols
+		if cols == 0 {
+			cols = DefaultColumns
+		}
+		if c.Width() != cols || len(c.Grid) != tt.wantRows {
+			t.Errorf("%dx%d at %d columns: got %dx%d cells, want %dx%d", tt.w, tt.h, tt.cols, c.Width(), len(c.Grid), cols, tt.wantRows)
+		}
+	}
+}
+
+// tallImage is a uniform image of any size that stores no pixels.
+type tallImage struct {
+	*image.Uniform
+	w, h int
+}
+
+func (img tallImage) Bounds() image.Rectangle { return image.Rect(0, 0, img.w, img.h) }
+
+func TestToCanvasTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+		cols int
+	}{
+		{"1x50000000 image", 1, 50_000_000, 80},
+		{"rows past MaxRows", 80, 2*canvas.MaxRows + 2, 80},
+		{"cells past MaxCells", 100, 200, canvas.MaxCells / 100},
+	}
+	for _, tt := range tests {
+		img := tallImage{image.NewUniform(red), tt.w, tt.h}
+		if _, err := ToCanvas(img, Options{Columns: tt.cols}); !errors.Is(err, canvas.ErrTooLarge) {
+			t.Errorf("%s: error %v, want canvas.ErrTooLarge", tt.name, err)
+		}
+	}
+}
+
+func TestTwoColors(t *testing.T) {
+	tests := []struct {
+		px            [4]int
+		first, second int
+	}{
+		{[4]int{1, 1, 1, 1}, 1, 1},
+		{[4]int{1, 2, 2, 2}, 2, 1},
+		{[4]int{1, 2, 1, 3}, 1, 2},
+		{[4]int{3, 2, 2, 3}, 3, 2},
+	}
+	for _, tt := range tests {
+		first, second := twoColors(tt.px)
+		if first != tt.first || second != tt.second {
+			t.Errorf("twoColors(%v) = %d, %d, want %d, %d", tt.px, first, second, tt.first, tt.second)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"half", "QUAD", ""} {
+		if _, err := ParseMode(s); err != nil {
+			t.Errorf("ParseMode(%q): %v", s, err)
+		}
+	}
+	if _, err := ParseMode("sextant"); err == nil {
+		t.Error("ParseMode accepted an unknown mode")
+	}
+	for _, s := range []string{"none", "fs", "ordered", "bayer"} {
+		if _, err := ParseDither(s); err != nil {
+			t.Errorf("ParseDither(%q): %v", s, err)
+		}
+	}
+	if _, err := ParseDither("atkinson"); err == nil {
+		t.Error("ParseDither accepted an unknown dithering")
+	}
+	for _, s := range []string{"ansi16", "mirc", "256"} {
+		if _, err := Palette(s); err != nil {
+			t.Errorf("Palette(%q): %v", s, err)
+		}
+	}
+}
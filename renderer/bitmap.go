@@ -0,0 +1,52 @@
+package renderer
+
+import (
+	"image"
+	"image/draw"
+
+	"a2m2a/canvas"
+)
+
+// renderBitmapFont draws the canvas with its embedded bitmap font. Every
+// glyph pixel becomes a scale x scale block, so fonts stay crisp.
+func renderBitmapFont(c *canvas.Canvas, scale float64) image.Image {
+	minRow, maxRow, minCol, maxCol := c.GetContentBounds()
+	if minRow > maxRow { // Empty canvas
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+
+	font := c.Font
+	cellWidth, cellHeight := bitmapCell(font, scale)
+	numCols := maxCol - minCol + 1
+	numRows := maxRow - minRow + 1
+
+	img := image.NewRGBA(image.Rect(0, 0, numCols*cellWidth, numRows*cellHeight))
+	for r := minRow; r <= maxRow; r++ {
+		for col := minCol; col <= maxCol; col++ {
+			cell := c.Grid[r][col]
+			startX := (col - minCol) * cellWidth
+			startY := (r - minRow) * cellHeight
+			draw.Draw(img, image.Rect(startX, startY, startX+cellWidth, startY+cellHeight), &image.Uniform{C: cell.Bg}, image.Point{}, draw.Src)
+
+			glyph := font.Glyph(cell.Char)
+			if glyph == nil {
+				continue
+			}
+			// Map every output pixel back to its glyph pixel.
+			for y := 0; y < cellHeight; y++ {
+				bits := glyph[y*font.Height/cellHeight]
+				for x := 0; x < cellWidth; x++ {
+					if bits&(0x80>>(x*font.Width/cellWidth)) != 0 {
+						img.SetRGBA(startX+x, startY+y, cell.Fg)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+// bitmapCell returns the size of a cell drawn with font at the given scale.
+func bitmapCell(font *canvas.Font, scale float64) (width, height int) {
+	return max(1, int(float64(font.Width)*scale+0.5)), max(1, int(float64(font.Height)*scale+0.5))
+}
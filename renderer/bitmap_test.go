@@ -0,0 +1,61 @@
+package renderer
+
+import (
+	"image/color"
+	"testing"
+
+	"a2m2a/canvas"
+)
+
+func TestBitmapFont(t *testing.T) {
+	fg := color.RGBA{255, 255, 255, 255}
+	bg := color.RGBA{0, 0, 170, 255}
+	data := make([]byte, 256*2)
+	data['A'*2], data['A'*2+1] = 0x80, 0x01 // Top-left and bottom-right pixels.
+
+	tests := []struct {
+		name   string
+		scale  float64
+		width  int
+		height int
+		pixels map[[2]int]color.RGBA
+	}{
+		{"scale 1", 1, 8, 2, map[[2]int]color.RGBA{{0, 0}: fg, {1, 0}: bg, {7, 1}: fg, {0, 1}: bg}},
+		{"scale 2", 2, 16, 4, map[[2]int]color.RGBA{{0, 0}: fg, {1, 1}: fg, {2, 0}: bg, {15, 3}: fg, {13, 3}: bg}},
+		{"scale 0.5", 0.5, 4, 1, map[[2]int]color.RGBA{{0, 0}: fg, {3, 0}: bg}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		c.Font = canvas.NewFont(2, data)
+		c.Put(canvas.Cell{Char: 'A', Fg: fg, Bg: bg})
+		img, err := ToImage(c, tt.scale)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if size := img.Bounds().Size(); size.X != tt.width || size.Y != tt.height {
+			t.Errorf("%s: size %v, want %dx%d", tt.name, size, tt.width, tt.height)
+			continue
+		}
+		for p, want := range tt.pixels {
+			if got := color.RGBAModel.Convert(img.At(p[0], p[1])); got != want {
+				t.Errorf("%s: pixel %v = %v, want %v", tt.name, p, got, want)
+			}
+		}
+	}
+}
+
+func TestBitmapFontEmpty(t *testing.T) {
+	c := canvas.NewCanvas(80)
+	c.Font = canvas.NewFont(16, make([]byte, 256*16))
+	img, err := ToImage(c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An empty canvas has the bounds of its first cell, which is drawn blank.
+	if size := img.Bounds().Size(); size.X != 8 || size.Y != 16 {
+		t.Errorf("empty canvas size %v, want 8x16", size)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != canvas.DefaultBg {
+		t.Errorf("empty canvas pixel = %v, want %v", got, canvas.DefaultBg)
+	}
+}
@@ -3,7 +3,6 @@ package renderer
 import (
 	"bytes"
 	"image"
-	"image/color"
 	"image/draw"
 	"image/png"
 
@@ -23,11 +22,21 @@ const (
 
 // ToPNG renders a canvas to a PNG image.
 func ToPNG(c *canvas.Canvas) ([]byte, error) {
-	parsedFont, err := truetype.Parse(FontData)
+	return ToPNGScaled(c, 1.0)
+}
+
+// ToThumbnail generates a small PNG thumbnail from the canvas.
+func ToThumbnail(c *canvas.Canvas) ([]byte, error) {
+	// Use a smaller scale for the thumbnail. 0.5 means half the size.
+	return ToPNGScaled(c, 0.5)
+}
+
+// ToPNGScaled renders a canvas to a PNG image at the given scale.
+func ToPNGScaled(c *canvas.Canvas, scale float64) ([]byte, error) {
+	img, err := ToImage(c, scale)
 	if err != nil {
 		return nil, err
 	}
-	img := renderCanvasToImage(c, parsedFont, 1.0)
 	buf := new(bytes.Buffer)
 	if err := png.Encode(buf, img); err != nil {
 		return nil, err
@@ -35,30 +44,58 @@ func ToPNG(c *canvas.Canvas) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// ToThumbnail generates a small PNG thumbnail from the canvas.
-func ToThumbnail(c *canvas.Canvas) ([]byte, error) {
+// ToImage renders a canvas to an in-memory image at the given scale, for
+// outputs that post-process the rendering instead of writing a PNG. Canvases
+// with an embedded bitmap font are drawn with that font.
+func ToImage(c *canvas.Canvas, scale float64) (image.Image, error) {
+	if c.Font != nil {
+		return renderBitmapFont(c, scale), nil
+	}
 	parsedFont, err := truetype.Parse(FontData)
 	if err != nil {
 		return nil, err
 	}
-	// Use a smaller scale for the thumbnail. 0.5 means half the size.
-	img := renderCanvasToImage(c, parsedFont, 0.5)
-	buf := new(bytes.Buffer)
-	if err := png.Encode(buf, img); err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
+	return renderCanvasToImage(c, parsedFont, scale), nil
 }
 
-// renderCanvasToImage performs the actual drawing of the canvas to an image.
-func renderCanvasToImage(c *canvas.Canvas, parsedFont *truetype.Font, scale float64) image.Image {
-	// Determine the actual bounds of the art to create a tightly-cropped image.
+// ImageSize returns the size of the image ToImage draws for c at the given
+// scale, without drawing it, so that callers can refuse large renderings.
+func ImageSize(c *canvas.Canvas, scale float64) (image.Point, error) {
 	minRow, maxRow, minCol, maxCol := c.GetContentBounds()
-	if minRow > maxRow { // Empty canvas
-		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	numCols, numRows := maxCol-minCol+1, maxRow-minRow+1
+	if c.Font != nil {
+		cellWidth, cellHeight := bitmapCell(c.Font, scale)
+		return image.Pt(numCols*cellWidth, numRows*cellHeight), nil
 	}
+	m, err := CellMetrics(scale)
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(int(float64(numCols)*m.CellWidth), int(float64(numRows)*m.CellHeight)), nil
+}
+
+// baseFontSize is a standard size for getting metrics.
+const baseFontSize = 16.0
+
+// Metrics describes the cell grid of a rendering in pixels.
+type Metrics struct {
+	CellWidth  float64
+	CellHeight float64
+	Baseline   float64 // Distance from the top of a cell to the text baseline.
+	FontSize   float64
+}
+
+// CellMetrics returns the cell size used when rendering at the given scale,
+// so that other outputs (e.g. SVG) can match the PNG layout exactly.
+func CellMetrics(scale float64) (Metrics, error) {
+	parsedFont, err := truetype.Parse(FontData)
+	if err != nil {
+		return Metrics{}, err
+	}
+	return fontMetrics(parsedFont, scale), nil
+}
 
-	const baseFontSize = 16.0 // A standard size for getting metrics
+func fontMetrics(parsedFont *truetype.Font, scale float64) Metrics {
 	face := truetype.NewFace(parsedFont, &truetype.Options{
 		Size:    baseFontSize,
 		DPI:     72,
@@ -68,9 +105,26 @@ func renderCanvasToImage(c *canvas.Canvas, parsedFont *truetype.Font, scale floa
 	// Correctly calculate character dimensions from font metrics.
 	// The font metrics are in 26.6 fixed-point format, so we divide by 64.
 	advance, _ := face.GlyphAdvance('M')
-	fCharWidth := (float64(advance) / 64.0) * scale
-	fCharHeight := (float64(face.Metrics().Ascent+face.Metrics().Descent) / 64.0) * scale
-	baseline := int((float64(face.Metrics().Ascent) / 64.0) * scale)
+	return Metrics{
+		CellWidth:  (float64(advance) / 64.0) * scale,
+		CellHeight: (float64(face.Metrics().Ascent+face.Metrics().Descent) / 64.0) * scale,
+		Baseline:   (float64(face.Metrics().Ascent) / 64.0) * scale,
+		FontSize:   baseFontSize * scale,
+	}
+}
+
+// renderCanvasToImage performs the actual drawing of the canvas to an image.
+func renderCanvasToImage(c *canvas.Canvas, parsedFont *truetype.Font, scale float64) image.Image {
+	// Determine the actual bounds of the art to create a tightly-cropped image.
+	minRow, maxRow, minCol, maxCol := c.GetContentBounds()
+	if minRow > maxRow { // Empty canvas
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
+	}
+
+	m := fontMetrics(parsedFont, scale)
+	fCharWidth := m.CellWidth
+	fCharHeight := m.CellHeight
+	baseline := int(m.Baseline)
 
 	numCols := maxCol - minCol + 1
 	numRows := maxRow - minRow + 1
@@ -79,7 +133,7 @@ func renderCanvasToImage(c *canvas.Canvas, parsedFont *truetype.Font, scale floa
 	imgHeight := int(float64(numRows) * fCharHeight)
 
 	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
-	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.Black}, image.Point{}, draw.Src)
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: canvas.DefaultBg}, image.Point{}, draw.Src)
 
 	// Create a new face for rendering with the scaled size
 	scaledFace := truetype.NewFace(parsedFont, &truetype.Options{
@@ -3,7 +3,6 @@ package sauce
 import (
 	"encoding/binary"
 	"io"
-	"os"
 )
 
 const (
@@ -32,8 +31,9 @@ type Record struct {
 	CommentLines []string
 }
 
-// Get finds and parses a SAUCE record from the end of a file.
-func Get(f *os.File) (*Record, error) {
+// Get finds and parses a SAUCE record from the end of a file or any other
+// seekable stream. The read position is left unspecified.
+func Get(f io.ReadSeeker) (*Record, error) {
 	// A SAUCE record is at the end of the file, so we seek backwards.
 	// We first look for the record itself, then for an optional comment block.
 	offset, err := f.Seek(-int64(RecordSize), io.SeekEnd)
@@ -0,0 +1,89 @@
+package sauce
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// record builds a SAUCE record describing size bytes of art, preceded by a
+// comment block if comments are given.
+func record(size uint32, dataType, fileType, flags uint8, width uint16, comments ...string) []byte {
+	var b bytes.Buffer
+	if len(comments) > 0 {
+		b.WriteString(CommentID)
+		for _, c := range comments {
+			b.WriteString(c + strings.Repeat(" ", 64-len(c)))
+		}
+	}
+	rec := make([]byte, RecordSize)
+	copy(rec, ID+"00")
+	copy(rec[7:], "Title")
+	copy(rec[42:], "Author")
+	binary.LittleEndian.PutUint32(rec[90:], size)
+	rec[94], rec[95] = dataType, fileType
+	binary.LittleEndian.PutUint16(rec[96:], width)
+	rec[104], rec[105] = uint8(len(comments)), flags
+	b.Write(rec)
+	return b.Bytes()
+}
+
+func TestGet(t *testing.T) {
+	art := "\x1b[31mart\x1a"
+	tests := []struct {
+		name     string
+		data     string
+		want     bool
+		comments int
+	}{
+		{"record", art + string(record(9, DataTypeCharacter, FileTypeANSi, 0, 80)), true, 0},
+		{"comments", art + string(record(9, DataTypeCharacter, FileTypeANSi, 0, 80, "first", "second")), true, 2},
+		{"no record", art + strings.Repeat("x", RecordSize), false, 0},
+		{"too short", art, false, 0},
+	}
+	for _, tt := range tests {
+		rec, err := Get(strings.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if (rec != nil) != tt.want {
+			t.Fatalf("%s: record %v, want one %v", tt.name, rec, tt.want)
+		}
+		if rec == nil {
+			continue
+		}
+		if rec.FileSize != 9 || rec.TInfo1 != 80 || !strings.HasPrefix(rec.Title, "Title") || !strings.HasPrefix(rec.Author, "Author") {
+			t.Errorf("%s: record = %+v", tt.name, rec)
+		}
+		if len(rec.CommentLines) != tt.comments {
+			t.Errorf("%s: %d comment lines, want %d", tt.name, len(rec.CommentLines), tt.comments)
+		} else if tt.comments > 0 && strings.TrimRight(rec.CommentLines[1], " ") != "second" {
+			t.Errorf("%s: comment lines = %q", tt.name, rec.CommentLines)
+		}
+	}
+}
+
+func TestTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		rec      Record
+		dataType uint8
+		fileType uint8
+		is, ice  bool
+	}{
+		{"ansi", Record{DataType: DataTypeCharacter, FileType: FileTypeANSi}, DataTypeCharacter, FileTypeANSi, true, false},
+		{"ice ansi", Record{DataType: DataTypeCharacter, FileType: FileTypeANSi, Flags: 0x01}, DataTypeCharacter, FileTypeANSi, true, true},
+		{"other file type", Record{DataType: DataTypeCharacter, FileType: FileTypeAvatar}, DataTypeCharacter, FileTypePCBoard, false, false},
+		{"other data type", Record{DataType: DataTypeBinaryText, FileType: FileTypeANSi, Flags: 0x03}, DataTypeCharacter, FileTypeANSi, false, true},
+		{"letter spacing only", Record{Flags: 0x02}, DataTypeNone, 0, true, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rec.Is(tt.dataType, tt.fileType); got != tt.is {
+			t.Errorf("%s: Is = %v, want %v", tt.name, got, tt.is)
+		}
+		if got := tt.rec.ICE(); got != tt.ice {
+			t.Errorf("%s: ICE = %v, want %v", tt.name, got, tt.ice)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package sauce
+
+// Data types, the kind of file a record describes.
+const (
+	DataTypeNone       = 0
+	DataTypeCharacter  = 1
+	DataTypeBitmap     = 2
+	DataTypeVector     = 3
+	DataTypeAudio      = 4
+	DataTypeBinaryText = 5
+	DataTypeXBin       = 6
+	DataTypeArchive    = 7
+	DataTypeExecutable = 8
+)
+
+// File types of the Character data type.
+const (
+	FileTypeASCII      = 0
+	FileTypeANSi       = 1
+	FileTypeANSiMation = 2
+	FileTypeRIP        = 3
+	FileTypePCBoard    = 4
+	FileTypeAvatar     = 5
+	FileTypeHTML       = 6
+	FileTypeSource     = 7
+	FileTypeTundraDraw = 8
+)
+
+// flagICE is the "non-blink mode" bit of Flags.
+const flagICE = 1 << 0
+
+// ICE reports whether the art uses iCE colors, i.e. the blink attribute
+// selects bright backgrounds.
+func (r *Record) ICE() bool {
+	return r.Flags&flagICE != 0
+}
+
+// Is reports whether the record describes the given data and file type.
+func (r *Record) Is(dataType, fileType uint8) bool {
+	return r.DataType == dataType && r.FileType == fileType
+}
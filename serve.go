@@ -0,0 +1,36 @@
+package main
+
+import (
+	"a2m2a/server"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+// serveCommand runs the `a2m2a serve` subcommand, an HTTP rendering service.
+func serveCommand(args []string) {
+	defaults := server.DefaultConfig()
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	maxBody := fs.Int64("max-body", defaults.MaxBodyBytes, "Maximum upload size in bytes")
+	timeout := fs.Duration("timeout", defaults.Timeout, "Maximum time spent converting a single request")
+	maxPixels := fs.Int64("max-pixels", defaults.MaxPixels, "Maximum size of a rendered image in pixels")
+	cacheBytes := fs.Int("cache", defaults.CacheBytes, "Total size of cached responses in bytes")
+	fs.Parse(args)
+
+	srv := &http.Server{
+		Addr: *addr,
+		Handler: server.New(server.Config{
+			MaxBodyBytes: *maxBody,
+			Timeout:      *timeout,
+			MaxPixels:    *maxPixels,
+			CacheBytes:   *cacheBytes,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *timeout + 10*time.Second,
+		WriteTimeout:      *timeout + 10*time.Second,
+	}
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(srv.ListenAndServe())
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cachedResponse is a rendered response body together with its media type.
+type cachedResponse struct {
+	key       string
+	mediaType string
+	body      []byte
+}
+
+// cache is a content-addressed LRU cache of rendered responses, bounded by
+// the total size of the cached bodies.
+type cache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List // Front is most recently used.
+	items    map[string]*list.Element
+}
+
+func newCache(maxBytes int) *cache {
+	return &cache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (c *cache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*cachedResponse), true
+}
+
+func (c *cache) put(resp *cachedResponse) {
+	if len(resp.body) > c.maxBytes {
+		return // Would evict everything else and still not fit.
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[resp.key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[resp.key] = c.order.PushFront(resp)
+	c.size += len(resp.body)
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		old := oldest.Value.(*cachedResponse)
+		c.order.Remove(oldest)
+		delete(c.items, old.key)
+		c.size -= len(old.body)
+	}
+}
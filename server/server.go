@@ -0,0 +1,308 @@
+// Package server exposes the conversions over HTTP for the `a2m2a serve`
+// subcommand.
+package server
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/convert"
+	"a2m2a/mirc"
+	"a2m2a/palette"
+	"a2m2a/renderer"
+	"a2m2a/sauce"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the limits of the service.
+type Config struct {
+	// MaxBodyBytes is the largest accepted upload.
+	MaxBodyBytes int64
+	// Timeout bounds the time spent converting a single request.
+	Timeout time.Duration
+	// MaxPixels is the largest image rendered for png, sixel and kitty
+	// output. Text art is small, but its rendering is not: every row is
+	// 16 pixels tall.
+	MaxPixels int64
+	// CacheBytes is the total size of cached responses.
+	CacheBytes int
+}
+
+// DefaultConfig returns sensible limits for a public-facing service.
+func DefaultConfig() Config {
+	return Config{
+		MaxBodyBytes: 2 << 20,
+		Timeout:      10 * time.Second,
+		MaxPixels:    32 << 20,
+		CacheBytes:   64 << 20,
+	}
+}
+
+// Server is an http.Handler serving the rendering API:
+//
+//	POST /render?to=png&from=&width=&palette=&scale=&thumb=
+//	GET  /healthz
+type Server struct {
+	cfg   Config
+	cache *cache
+	mux   *http.ServeMux
+}
+
+// New creates a server with the given limits.
+func New(cfg Config) *Server {
+	s := &Server{
+		cfg:   cfg,
+		cache: newCache(cfg.CacheBytes),
+		mux:   http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/render", s.handleRender)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// renderParams are the validated query parameters of a render request.
+type renderParams struct {
+	from    string
+	to      *convert.Format
+	width   int
+	palette []color.RGBA
+	// order is the color order of palette, which must match the input.
+	order palette.Order
+	scale float64
+}
+
+// rasterOutputs are the outputs that draw the cell colors as pixels. Only
+// these can show a different palette; text outputs write palette indices.
+var rasterOutputs = map[string]bool{"png": true, "sixel": true, "kitty": true}
+
+func parseRenderParams(q url.Values) (renderParams, error) {
+	var p renderParams
+	var err error
+
+	to := q.Get("to")
+	if to == "" {
+		to = "png"
+	}
+	if p.to, err = convert.Lookup(to); err != nil {
+		return p, err
+	}
+	if p.to.Encoder == nil {
+		return p, fmt.Errorf("format %q cannot be used as output", p.to.Name)
+	}
+	p.from = q.Get("from")
+
+	if v := q.Get("width"); v != "" {
+		if p.width, err = strconv.Atoi(v); err != nil || p.width < 1 || p.width > 1000 {
+			return p, fmt.Errorf("width must be between 1 and 1000")
+		}
+	}
+	// Only built-in palettes can be selected; files are never read on
+	// behalf of a client.
+	if name := q.Get("palette"); name != "" {
+		var ok bool
+		if p.palette, ok = palette.Builtin(name); !ok {
+			return p, fmt.Errorf("unknown palette %q (known: %s)", name, strings.Join(palette.BuiltinNames(), ", "))
+		}
+		p.order, _ = palette.BuiltinOrder(name)
+		if !rasterOutputs[p.to.Name] {
+			return p, fmt.Errorf("a palette only applies to image output, not %s", p.to.Name)
+		}
+	}
+
+	p.scale = 1.0
+	if q.Get("thumb") != "" {
+		p.scale = 0.5
+	}
+	if v := q.Get("scale"); v != "" {
+		if p.scale, err = strconv.ParseFloat(v, 64); err != nil || p.scale < 0.1 || p.scale > 4 {
+			return p, fmt.Errorf("scale must be between 0.1 and 4")
+		}
+	}
+	return p, nil
+}
+
+// cacheKey addresses a response by the uploaded content and every parameter
+// that influences the output.
+func (p renderParams) cacheKey(body []byte) string {
+	h := sha256.New()
+	h.Write(body)
+	fmt.Fprintf(h, "\x00%s\x00%s\x00%d\x00%g\x00", p.from, p.to.Name, p.width, p.scale)
+	for _, c := range p.palette {
+		h.Write([]byte{c.R, c.G, c.B})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("body exceeds %d bytes", s.cfg.MaxBodyBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) == 0 {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	params, err := parseRenderParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The ETag addresses the content, so a client holding it is up to date
+	// whether or not the response is still cached.
+	key := params.cacheKey(body)
+	etag := `"` + key + `"`
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if resp, ok := s.cache.get(key); ok {
+		writeResponse(w, resp, etag, "HIT")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.Timeout)
+	defer cancel()
+	out, err := s.render(ctx, body, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			http.Error(w, "conversion timed out", http.StatusServiceUnavailable)
+		case errors.Is(err, convert.ErrUnknownFormat):
+			http.Error(w, err.Error()+"; pass ?from=", http.StatusUnprocessableEntity)
+		case errors.Is(err, canvas.ErrTooLarge), errors.Is(err, convert.ErrImageTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		}
+		return
+	}
+
+	mediaType := params.to.MediaType
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	resp := &cachedResponse{key: key, mediaType: mediaType, body: out}
+	s.cache.put(resp)
+	writeResponse(w, resp, etag, "MISS")
+}
+
+// render runs the parse -> convert pipeline for a single request.
+func (s *Server) render(ctx context.Context, body []byte, p renderParams) ([]byte, error) {
+	opts := convert.DecodeOptions{Width: p.width}
+	opts.Sauce, _ = sauce.Get(bytes.NewReader(body))
+
+	c, f, err := convert.Decode(ctx, bytes.NewReader(body), p.from, opts)
+	if err != nil {
+		return nil, err
+	}
+	if p.palette != nil {
+		if err := applyPalette(c, f.Name, p.palette, p.order); err != nil {
+			return nil, err
+		}
+	}
+
+	if rasterOutputs[p.to.Name] {
+		size, err := renderer.ImageSize(c, p.scale)
+		if err != nil {
+			return nil, err
+		}
+		if pixels := int64(size.X) * int64(size.Y); pixels > s.cfg.MaxPixels {
+			return nil, fmt.Errorf("%w: rendering would be %dx%d pixels, at most %d allowed", canvas.ErrTooLarge, size.X, size.Y, s.cfg.MaxPixels)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := convert.Encode(ctx, &buf, c, p.to.Name, convert.EncodeOptions{Scale: p.scale}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), ctx.Err()
+}
+
+// applyPalette swaps the palette the input was parsed with for a client's
+// palette. The package palettes are shared by all requests, so instead of
+// replacing them the colors are remapped on the request's own canvas. The
+// palette must be in the color order of the input format.
+func applyPalette(c *canvas.Canvas, format string, p []color.RGBA, order palette.Order) error {
+	var source []color.RGBA
+	var want palette.Order
+	switch format {
+	case "mirc":
+		source, want = mirc.MircPalette99, palette.IRCOrder
+	case "ansi":
+		source, want = ansi.AnsiPalette, palette.SGROrder
+	default:
+		return fmt.Errorf("a palette only applies to ansi and mirc input, not %s", format)
+	}
+	if order != want {
+		return fmt.Errorf("the palette is in %s color order and does not apply to %s input", order, format)
+	}
+
+	remap := map[color.RGBA]color.RGBA{}
+	for i := 0; i < len(source) && i < len(p); i++ {
+		if _, seen := remap[source[i]]; !seen {
+			remap[source[i]] = p[i]
+		}
+	}
+	c.MapColors(func(col color.RGBA) color.RGBA {
+		if mapped, ok := remap[col]; ok {
+			return mapped
+		}
+		return col
+	})
+	return nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeResponse(w http.ResponseWriter, resp *cachedResponse, etag, cacheStatus string) {
+	w.Header().Set("Content-Type", resp.mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.body)))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Cache", cacheStatus)
+	w.Write(resp.body)
+}
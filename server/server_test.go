@@ -0,0 +1,225 @@
+package server
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const art = "\x1b[1;31mHello\x1b[0m \x1b[44mworld\x1b[0m\r\n"
+
+func newTestServer(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(New(cfg))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func post(t *testing.T, url, body string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp, buf.Bytes()
+}
+
+func TestRender(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	tests := []struct {
+		name      string
+		query     string
+		wantType  string
+		wantInOut string
+	}{
+		{"plain", "to=plain", "text/plain; charset=utf-8", "Hello world"},
+		{"mirc", "to=mirc", "text/plain; charset=utf-8", "\x03"},
+		{"html", "to=html", "text/html; charset=utf-8", "<pre"},
+		{"narrow", "to=plain&width=5", "text/plain; charset=utf-8", "Hello\n worl"},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, ts.URL+"/render?"+tt.query, art, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: status %d: %s", tt.name, resp.StatusCode, body)
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got, tt.wantType)
+		}
+		if !bytes.Contains(body, []byte(tt.wantInOut)) {
+			t.Errorf("%s: body %q does not contain %q", tt.name, body, tt.wantInOut)
+		}
+	}
+
+	resp, body := post(t, ts.URL+"/render?palette=xterm&thumb=1", art, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("png: status %d, type %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+	if _, err := png.Decode(bytes.NewReader(body)); err != nil {
+		t.Errorf("png: %v", err)
+	}
+}
+
+func TestCaching(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	url := ts.URL + "/render?to=plain"
+
+	first, body1 := post(t, url, art, nil)
+	etag := first.Header.Get("ETag")
+	if first.Header.Get("X-Cache") != "MISS" || etag == "" {
+		t.Fatalf("first request: X-Cache %q, ETag %q", first.Header.Get("X-Cache"), etag)
+	}
+	second, body2 := post(t, url, art, nil)
+	if second.Header.Get("X-Cache") != "HIT" || second.Header.Get("ETag") != etag || !bytes.Equal(body1, body2) {
+		t.Errorf("second request: X-Cache %q, ETag %q", second.Header.Get("X-Cache"), second.Header.Get("ETag"))
+	}
+	other, _ := post(t, ts.URL+"/render?to=ansi", art, nil)
+	if other.Header.Get("ETag") == etag {
+		t.Error("different parameters share an ETag")
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"exact", etag, http.StatusNotModified},
+		{"weak", "W/" + etag, http.StatusNotModified},
+		{"list", `"other", ` + etag, http.StatusNotModified},
+		{"stale", `"other"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, url, art, http.Header{"If-None-Match": {tt.ifNoneMatch}})
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+		if tt.want == http.StatusNotModified && len(body) != 0 {
+			t.Errorf("%s: 304 with a body", tt.name)
+		}
+	}
+
+	// A server that never rendered the art, or evicted it, still answers
+	// 304 to a matching ETag.
+	fresh := newTestServer(t, DefaultConfig())
+	resp, _ := post(t, fresh.URL+"/render?to=plain", art, http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("uncached: status %d, want 304", resp.StatusCode)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MaxBodyBytes = 4096
+	ts := newTestServer(t, cfg)
+
+	resp, _ := post(t, ts.URL+"/render?to=plain", strings.Repeat("x", 5000), nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status %d, want 413", resp.StatusCode)
+	}
+
+	// A few bytes of cursor movement must not grow the canvas without
+	// limit.
+	bomb := strings.Repeat("\x1b[65536B", 150)
+	start := time.Now()
+	resp, body := post(t, ts.URL+"/render?to=plain", bomb, nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("cursor bomb: status %d, want 413: %s", resp.StatusCode, body)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("cursor bomb took %v", d)
+	}
+
+	// A canvas within the limits can still render to a huge image: this
+	// fills 20000 rows of 80 columns.
+	tall := "\x1b[19999B\x1b[44m\x1b[2J"
+	resp, body = post(t, ts.URL+"/render?to=png", tall, nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("tall rendering: status %d, want 413: %s", resp.StatusCode, body)
+	}
+	resp, body = post(t, ts.URL+"/render?to=plain", tall, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("tall text output: status %d, want 200: %s", resp.StatusCode, body)
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	ts := newTestServer(t, DefaultConfig())
+	tests := []struct {
+		name  string
+		query string
+		body  string
+		want  int
+	}{
+		{"empty body", "to=plain", "", http.StatusBadRequest},
+		{"unknown output", "to=nope", art, http.StatusBadRequest},
+		{"input-only output", "to=adf", art, http.StatusBadRequest},
+		{"unknown input", "to=plain&from=nope", art, http.StatusUnprocessableEntity},
+		{"width too small", "to=plain&width=0", art, http.StatusBadRequest},
+		{"width not a number", "to=plain&width=x", art, http.StatusBadRequest},
+		{"scale out of range", "scale=10", art, http.StatusBadRequest},
+		{"unknown palette", "palette=nope", art, http.StatusBadRequest},
+		{"palette palette on text output", "to=ansi&palette=vga", art, http.StatusBadRequest},
+		{"mIRC palette on ANSI input", "palette=hexchat", art, http.StatusUnprocessableEntity},
+		{"ANSI palette on mIRC input", "palette=xterm", "\x034,1red\x03", http.StatusUnprocessableEntity},
+		{"palette on other input", "palette=vga&from=plain", "text", http.StatusUnprocessableEntity},
+		{"undetectable input", "to=plain", "\x00\x01\x02", http.StatusUnprocessableEntity},
+		{"truncated xbin", "to=plain&from=xbin", "XBIN\x1a", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		resp, body := post(t, ts.URL+"/render?"+tt.query, tt.body, nil)
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, resp.StatusCode, tt.want, body)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET /render: status %d, want 405", resp.StatusCode)
+	}
+	resp, err = http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /healthz: status %d", resp.StatusCode)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(10)
+	c.put(&cachedResponse{key: "a", body: []byte("12345")})
+	c.put(&cachedResponse{key: "b", body: []byte("12345")})
+	c.get("a") // a is now the most recently used.
+	c.put(&cachedResponse{key: "c", body: []byte("12345")})
+	if _, ok := c.get("b"); ok {
+		t.Error("the least recently used entry was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+	c.put(&cachedResponse{key: "big", body: make([]byte, 11)})
+	if _, ok := c.get("big"); ok {
+		t.Error("an entry larger than the cache was stored")
+	}
+}
@@ -0,0 +1,250 @@
+// Package svg exports a canvas as a scalable vector image laid out on the
+// same cell grid as the PNG renderer.
+package svg
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/renderer"
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Options controls the generated SVG.
+type Options struct {
+	// Scale sizes the cell grid like the PNG scale; zero means 1.0.
+	Scale float64
+	// EmbedFont embeds the renderer's monospace font, so the image looks
+	// the same everywhere. Otherwise the font is only referenced by name.
+	EmbedFont bool
+}
+
+// shadeKind identifies one of the ░▒▓ fill patterns.
+type shadeKind int
+
+const (
+	shadeLight shadeKind = iota
+	shadeMedium
+	shadeDark
+)
+
+// shadeKey names one pattern definition: a shade in a foreground color.
+type shadeKey struct {
+	kind shadeKind
+	fg   color.RGBA
+}
+
+// Writer converts a canvas to SVG.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+	opts   Options
+
+	cw, ch   float64 // Cell size.
+	baseline float64
+	fontSize float64
+}
+
+// NewWriter creates a new SVG writer.
+func NewWriter(c *canvas.Canvas, w io.Writer, opts Options) *Writer {
+	if opts.Scale <= 0 {
+		opts.Scale = 1.0
+	}
+	return &Writer{
+		canvas: c,
+		writer: w,
+		opts:   opts,
+	}
+}
+
+// Write generates the SVG document, cropped to the content like the PNG.
+func (w *Writer) Write() error {
+	m, err := renderer.CellMetrics(w.opts.Scale)
+	if err != nil {
+		return err
+	}
+	w.cw, w.ch, w.baseline, w.fontSize = m.CellWidth, m.CellHeight, m.Baseline, m.FontSize
+
+	minRow, maxRow, minCol, maxCol := w.canvas.GetContentBounds()
+	if minRow > maxRow { // Empty canvas
+		minRow, maxRow, minCol, maxCol = 0, 0, 0, 0
+	}
+	cols, rows := maxCol-minCol+1, maxRow-minRow+1
+	width, height := float64(cols)*w.cw, float64(rows)*w.ch
+
+	// Shapes go into body first, so that only the patterns actually used
+	// end up in <defs>.
+	var body strings.Builder
+	shades := map[shadeKey]string{}
+	var shadeOrder []shadeKey
+	shadeID := func(k shadeKey) string {
+		id, ok := shades[k]
+		if !ok {
+			id = fmt.Sprintf("p%d", len(shades))
+			shades[k] = id
+			shadeOrder = append(shadeOrder, k)
+		}
+		return id
+	}
+
+	for r := minRow; r <= maxRow; r++ {
+		row := w.canvas.Grid[r][minCol : maxCol+1]
+		y := float64(r-minRow) * w.ch
+		w.writeBackgrounds(&body, row, y)
+		w.writeBlocks(&body, row, y, shadeID)
+		w.writeText(&body, row, y)
+	}
+
+	bw := bufio.NewWriter(w.writer)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%s\" height=\"%s\" viewBox=\"0 0 %s %s\">\n",
+		num(width), num(height), num(width), num(height))
+	w.writeDefs(bw, shadeOrder, shades)
+	fmt.Fprintf(bw, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(canvas.DefaultBg))
+	bw.WriteString(body.String())
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
+
+// writeBackgrounds merges runs of cells sharing a non-default background
+// into single rectangles.
+func (w *Writer) writeBackgrounds(out *strings.Builder, row []canvas.Cell, y float64) {
+	for i := 0; i < len(row); {
+		bg := row[i].Bg
+		start := i
+		for i < len(row) && row[i].Bg == bg {
+			i++
+		}
+		if bg != canvas.DefaultBg {
+			w.rect(out, float64(start)*w.cw, y, float64(i-start)*w.cw, w.ch, hexColor(bg))
+		}
+	}
+}
+
+// writeBlocks draws the block elements and shades as shapes on top of the
+// backgrounds. Runs of identical full blocks are merged like backgrounds.
+func (w *Writer) writeBlocks(out *strings.Builder, row []canvas.Cell, y float64, shadeID func(shadeKey) string) {
+	for i := 0; i < len(row); {
+		cell := row[i]
+		x := float64(i) * w.cw
+		switch cell.Char {
+		case '█':
+			start := i
+			for i < len(row) && row[i].Char == '█' && row[i].Fg == cell.Fg {
+				i++
+			}
+			w.rect(out, x, y, float64(i-start)*w.cw, w.ch, hexColor(cell.Fg))
+			continue
+		case '▀':
+			w.rect(out, x, y, w.cw, w.ch/2, hexColor(cell.Fg))
+		case '▄':
+			w.rect(out, x, y+w.ch/2, w.cw, w.ch/2, hexColor(cell.Fg))
+		case '▌':
+			w.rect(out, x, y, w.cw/2, w.ch, hexColor(cell.Fg))
+		case '▐':
+			w.rect(out, x+w.cw/2, y, w.cw/2, w.ch, hexColor(cell.Fg))
+		case '░':
+			w.rect(out, x, y, w.cw, w.ch, "url(#"+shadeID(shadeKey{shadeLight, cell.Fg})+")")
+		case '▒':
+			w.rect(out, x, y, w.cw, w.ch, "url(#"+shadeID(shadeKey{shadeMedium, cell.Fg})+")")
+		case '▓':
+			w.rect(out, x, y, w.cw, w.ch, "url(#"+shadeID(shadeKey{shadeDark, cell.Fg})+")")
+		}
+		i++
+	}
+}
+
+// writeText emits the remaining glyphs as <text> runs of consecutive cells
+// with the same style. Every glyph gets its own x position so the text stays
+// on the cell grid whatever font the viewer ends up using.
+func (w *Writer) writeText(out *strings.Builder, row []canvas.Cell, y float64) {
+	for i := 0; i < len(row); {
+		cell := row[i]
+		if !isText(cell.Char) {
+			i++
+			continue
+		}
+		var xs []string
+		var text strings.Builder
+		for i < len(row) && isText(row[i].Char) && sameStyle(row[i], cell) {
+			xs = append(xs, num(float64(i)*w.cw))
+			text.WriteString(escape(string(cp437.ToUnicode(row[i].Char))))
+			i++
+		}
+
+		fmt.Fprintf(out, `<text x="%s" y="%s" fill="%s"`, strings.Join(xs, " "), num(y+w.baseline), hexColor(cell.Fg))
+		if cell.Bold {
+			out.WriteString(` font-weight="bold"`)
+		}
+		if cell.Underline {
+			out.WriteString(` text-decoration="underline"`)
+		}
+		fmt.Fprintf(out, ">%s</text>\n", text.String())
+	}
+}
+
+// writeDefs emits the stylesheet and the shade patterns. The patterns tile
+// 2x2 pixel cells in user space, matching the renderer's dot patterns.
+func (w *Writer) writeDefs(bw *bufio.Writer, order []shadeKey, ids map[shadeKey]string) {
+	bw.WriteString("<defs>\n<style>\n")
+	family := "Hack, monospace"
+	if w.opts.EmbedFont {
+		fmt.Fprintf(bw, "@font-face { font-family: \"a2m2a\"; src: url(data:font/ttf;base64,%s) format(\"truetype\"); }\n",
+			base64.StdEncoding.EncodeToString(renderer.FontData))
+		family = `"a2m2a", monospace`
+	}
+	fmt.Fprintf(bw, "text { font-family: %s; font-size: %spx; white-space: pre; }\n", family, num(w.fontSize))
+	bw.WriteString("</style>\n")
+
+	for _, k := range order {
+		fg := hexColor(k.fg)
+		fmt.Fprintf(bw, `<pattern id="%s" width="2" height="2" patternUnits="userSpaceOnUse">`, ids[k])
+		switch k.kind {
+		case shadeLight:
+			fmt.Fprintf(bw, `<rect width="1" height="1" fill="%s"/>`, fg)
+		case shadeMedium:
+			fmt.Fprintf(bw, `<rect width="1" height="1" fill="%s"/><rect x="1" y="1" width="1" height="1" fill="%s"/>`, fg, fg)
+		case shadeDark:
+			fmt.Fprintf(bw, `<rect x="1" width="1" height="1" fill="%s"/><rect y="1" width="2" height="1" fill="%s"/>`, fg, fg)
+		}
+		bw.WriteString("</pattern>\n")
+	}
+	bw.WriteString("</defs>\n")
+}
+
+func (w *Writer) rect(out *strings.Builder, x, y, width, height float64, fill string) {
+	fmt.Fprintf(out, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"%s\"/>\n",
+		num(x), num(y), num(width), num(height), fill)
+}
+
+// isText reports whether a character is drawn as a glyph rather than as a
+// shape or not at all.
+func isText(r rune) bool {
+	switch r {
+	case ' ', 0, '█', '▀', '▄', '▌', '▐', '░', '▒', '▓':
+		return false
+	}
+	return true
+}
+
+func sameStyle(a, b canvas.Cell) bool {
+	return a.Fg == b.Fg && a.Bold == b.Bold && a.Underline == b.Underline
+}
+
+// num formats a coordinate with at most two decimals.
+func num(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// escape makes text safe to embed in XML.
+var escape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace
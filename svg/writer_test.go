@@ -0,0 +1,214 @@
+package svg
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/renderer"
+	"bytes"
+	"encoding/xml"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+var (
+	red  = color.RGBA{R: 0xAA, A: 0xFF}
+	blue = color.RGBA{B: 0xAA, A: 0xFF}
+)
+
+// document is the part of the SVG structure the tests look at.
+type document struct {
+	Width    string    `xml:"width,attr"`
+	Height   string    `xml:"height,attr"`
+	Style    string    `xml:"defs>style"`
+	Patterns []pattern `xml:"defs>pattern"`
+	Rects    []rect    `xml:"rect"`
+	Texts    []text    `xml:"text"`
+}
+
+type pattern struct {
+	ID string `xml:"id,attr"`
+}
+
+type rect struct {
+	X      string `xml:"x,attr"`
+	Y      string `xml:"y,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+	Fill   string `xml:"fill,attr"`
+}
+
+type text struct {
+	X          string `xml:"x,attr"`
+	Fill       string `xml:"fill,attr"`
+	FontWeight string `xml:"font-weight,attr"`
+	Decoration string `xml:"text-decoration,attr"`
+	Text       string `xml:",chardata"`
+}
+
+// write converts a canvas and parses the result back.
+func write(t *testing.T, c *canvas.Canvas, opts Options) (document, string) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := NewWriter(c, &out, opts).Write(); err != nil {
+		t.Fatal(err)
+	}
+	var doc document
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, out.String())
+	}
+	return doc, out.String()
+}
+
+func newCanvas(cells ...canvas.Cell) *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	for _, cell := range cells {
+		if cell.Char == '\n' {
+			c.NewLine()
+			continue
+		}
+		c.Put(cell)
+	}
+	return c
+}
+
+func cells(s string, fg, bg color.RGBA) []canvas.Cell {
+	var out []canvas.Cell
+	for _, r := range s {
+		out = append(out, canvas.Cell{Char: r, Fg: fg, Bg: bg})
+	}
+	return out
+}
+
+func TestSize(t *testing.T) {
+	m, err := renderer.CellMetrics(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCanvas(append(cells("abc\n", canvas.DefaultFg, canvas.DefaultBg), cells("d", canvas.DefaultFg, canvas.DefaultBg)...)...)
+	doc, _ := write(t, c, Options{})
+	if want := num(3 * m.CellWidth); doc.Width != want {
+		t.Errorf("width %s, want %s", doc.Width, want)
+	}
+	if want := num(2 * m.CellHeight); doc.Height != want {
+		t.Errorf("height %s, want %s", doc.Height, want)
+	}
+
+	doc, _ = write(t, c, Options{Scale: 2})
+	if want := num(6 * m.CellWidth); doc.Width != want {
+		t.Errorf("scale 2: width %s, want %s", doc.Width, want)
+	}
+
+	// An empty canvas is one blank cell.
+	doc, _ = write(t, canvas.NewCanvas(80), Options{})
+	if doc.Width != num(m.CellWidth) || len(doc.Texts) != 0 {
+		t.Errorf("empty canvas: width %s, %d texts", doc.Width, len(doc.Texts))
+	}
+}
+
+func TestText(t *testing.T) {
+	c := newCanvas(append(append(
+		cells(`a<&"`, red, canvas.DefaultBg),
+		canvas.Cell{Char: 'b', Fg: red, Bg: canvas.DefaultBg, Bold: true},
+		canvas.Cell{Char: ' ', Fg: red, Bg: canvas.DefaultBg},
+		canvas.Cell{Char: 'u', Fg: blue, Bg: canvas.DefaultBg, Underline: true}),
+		cells("\x01", red, canvas.DefaultBg)...)...)
+	doc, out := write(t, c, Options{})
+	if strings.Contains(out, `<&"<`) {
+		t.Error("text not escaped")
+	}
+
+	want := []text{
+		{Fill: "#aa0000", Text: `a<&"`},
+		{Fill: "#aa0000", FontWeight: "bold", Text: "b"},
+		{Fill: "#0000aa", Decoration: "underline", Text: "u"},
+		{Fill: "#aa0000", Text: "☺"},
+	}
+	if len(doc.Texts) != len(want) {
+		t.Fatalf("got %d texts, want %d: %+v", len(doc.Texts), len(want), doc.Texts)
+	}
+	for i, w := range want {
+		got := doc.Texts[i]
+		got.X = ""
+		if got != w {
+			t.Errorf("text %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	// Every glyph is placed on its cell.
+	if xs := strings.Fields(doc.Texts[0].X); len(xs) != 4 || xs[0] != "0" {
+		t.Errorf("text 0 positions %q", doc.Texts[0].X)
+	}
+}
+
+func TestShapes(t *testing.T) {
+	m, err := renderer.CellMetrics(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCanvas(append(append(
+		cells("███", red, canvas.DefaultBg),
+		cells("▀▄", blue, red)...),
+		cells("░░▒", blue, canvas.DefaultBg)...)...)
+	doc, _ := write(t, c, Options{})
+
+	// The full screen background, the merged red background behind ▀▄, the
+	// merged full blocks, the two half blocks and three shades.
+	if len(doc.Rects) != 1+1+1+2+3 {
+		t.Fatalf("got %d rects: %+v", len(doc.Rects), doc.Rects)
+	}
+	var blocks, backgrounds []rect
+	shaded := map[string]int{}
+	for _, r := range doc.Rects[1:] {
+		switch {
+		case strings.HasPrefix(r.Fill, "url(#"):
+			shaded[r.Fill]++
+		case r.Fill == "#aa0000" && r.X == "0":
+			blocks = append(blocks, r)
+		case r.Fill == "#aa0000":
+			backgrounds = append(backgrounds, r)
+		}
+	}
+	if len(blocks) != 1 || blocks[0].Width != num(3*m.CellWidth) {
+		t.Errorf("full blocks not merged: %+v", blocks)
+	}
+	if len(backgrounds) != 1 || backgrounds[0].Width != num(2*m.CellWidth) {
+		t.Errorf("backgrounds not merged: %+v", backgrounds)
+	}
+	// Light and medium shades in one color make two patterns, each defined
+	// once.
+	if len(doc.Patterns) != 2 || shaded["url(#p0)"] != 2 || shaded["url(#p1)"] != 1 {
+		t.Errorf("patterns %+v used %v", doc.Patterns, shaded)
+	}
+	if len(doc.Texts) != 0 {
+		t.Errorf("blocks written as text: %+v", doc.Texts)
+	}
+}
+
+func TestFont(t *testing.T) {
+	c := newCanvas(cells("x", canvas.DefaultFg, canvas.DefaultBg)...)
+	doc, _ := write(t, c, Options{})
+	if !strings.Contains(doc.Style, "font-family: Hack, monospace") || strings.Contains(doc.Style, "@font-face") {
+		t.Errorf("style %q", doc.Style)
+	}
+	doc, _ = write(t, c, Options{EmbedFont: true})
+	if !strings.Contains(doc.Style, "@font-face") || !strings.Contains(doc.Style, `font-family: "a2m2a", monospace`) {
+		t.Errorf("embedded font missing from style %q", doc.Style[:min(200, len(doc.Style))])
+	}
+}
+
+func TestNum(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{0, "0"},
+		{8, "8"},
+		{8.5, "8.5"},
+		{8.126, "8.13"},
+		{1.0 / 3, "0.33"},
+	}
+	for _, tt := range tests {
+		if got := num(tt.v); got != tt.want {
+			t.Errorf("num(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package term
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/renderer"
+	"bufio"
+	"encoding/base64"
+	"io"
+)
+
+// kittyChunkSize is the largest base64 payload allowed per escape sequence.
+const kittyChunkSize = 4096
+
+// KittyWriter renders a canvas to the kitty terminal graphics protocol.
+type KittyWriter struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+	scale  float64
+}
+
+// NewKittyWriter creates a new kitty graphics writer rendering at the given
+// scale.
+func NewKittyWriter(c *canvas.Canvas, w io.Writer, scale float64) *KittyWriter {
+	return &KittyWriter{
+		canvas: c,
+		writer: w,
+		scale:  scale,
+	}
+}
+
+// Write renders the canvas to PNG and transmits it for immediate display.
+// Kitty decodes the PNG itself, so no quantization is needed.
+func (w *KittyWriter) Write() error {
+	data, err := renderer.ToPNGScaled(w.canvas, w.scale)
+	if err != nil {
+		return err
+	}
+	payload := base64.StdEncoding.EncodeToString(data)
+
+	bw := bufio.NewWriter(w.writer)
+	for first := true; first || payload != ""; first = false {
+		chunk := payload
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		payload = payload[len(chunk):]
+
+		more := "0"
+		if payload != "" {
+			more = "1"
+		}
+		bw.WriteString("\x1b_G")
+		if first {
+			// f=100: PNG data, a=T: transmit and display.
+			bw.WriteString("f=100,a=T,")
+		}
+		bw.WriteString("m=" + more + ";" + chunk + "\x1b\\")
+	}
+	bw.WriteString("\n")
+	return bw.Flush()
+}
@@ -0,0 +1,150 @@
+package term
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/palette"
+	"a2m2a/renderer"
+	"bufio"
+	"fmt"
+	"image/color"
+	colorpalette "image/color/palette"
+	"io"
+)
+
+// maxSixelColors is the number of color registers sixel terminals provide.
+const maxSixelColors = 256
+
+// SixelWriter renders a canvas to the DEC Sixel graphics protocol.
+type SixelWriter struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+	scale  float64
+}
+
+// NewSixelWriter creates a new Sixel writer rendering at the given scale.
+func NewSixelWriter(c *canvas.Canvas, w io.Writer, scale float64) *SixelWriter {
+	return &SixelWriter{
+		canvas: c,
+		writer: w,
+		scale:  scale,
+	}
+}
+
+// Write renders the canvas and emits it as a single sixel image.
+func (w *SixelWriter) Write() error {
+	img, err := renderer.ToImage(w.canvas, w.scale)
+	if err != nil {
+		return err
+	}
+	pal := sixelPalette(w.canvas)
+
+	// Quantize every pixel to a color register. Anti-aliased glyph edges
+	// snap to the nearest cell color.
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	indices := make([]uint8, width*height)
+	m := palette.NewMatcher(pal, palette.CurrentMetric())
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			indices[y*width+x] = uint8(m.Nearest(c))
+		}
+	}
+
+	bw := bufio.NewWriter(w.writer)
+	// DCS with aspect ratio 1:1, then raster attributes and the palette.
+	fmt.Fprintf(bw, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+	for i, c := range pal {
+		fmt.Fprintf(bw, "#%d;2;%d;%d;%d", i, percent(c.R), percent(c.G), percent(c.B))
+	}
+
+	// Each band covers six pixel rows; every color used in the band is drawn
+	// in its own pass, with "$" returning to the start of the band.
+	for top := 0; top < height; top += 6 {
+		used := make([]bool, len(pal))
+		for y := top; y < top+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				used[indices[y*width+x]] = true
+			}
+		}
+		firstPass := true
+		for ci := range pal {
+			if !used[ci] {
+				continue
+			}
+			if !firstPass {
+				bw.WriteByte('$')
+			}
+			firstPass = false
+			fmt.Fprintf(bw, "#%d", ci)
+
+			run, last := 0, byte(0)
+			for x := 0; x < width; x++ {
+				var bits byte
+				for dy := 0; dy < 6 && top+dy < height; dy++ {
+					if int(indices[(top+dy)*width+x]) == ci {
+						bits |= 1 << dy
+					}
+				}
+				ch := '?' + bits
+				if run > 0 && ch != last {
+					writeSixelRun(bw, last, run)
+					run = 0
+				}
+				last = ch
+				run++
+			}
+			writeSixelRun(bw, last, run)
+		}
+		bw.WriteByte('-')
+	}
+	bw.WriteString("\x1b\\")
+	return bw.Flush()
+}
+
+// writeSixelRun writes a run of identical sixels, using the "!" repeat
+// introducer when it is shorter.
+func writeSixelRun(bw *bufio.Writer, ch byte, run int) {
+	if run > 3 {
+		fmt.Fprintf(bw, "!%d%c", run, ch)
+		return
+	}
+	for i := 0; i < run; i++ {
+		bw.WriteByte(ch)
+	}
+}
+
+// sixelPalette collects the distinct cell colors of the canvas. Text art
+// rarely uses more than a few dozen; truecolor art that exceeds the color
+// registers falls back to a generic 256-color palette.
+func sixelPalette(c *canvas.Canvas) []color.RGBA {
+	seen := map[color.RGBA]bool{canvas.DefaultBg: true}
+	pal := []color.RGBA{canvas.DefaultBg}
+	add := func(col color.RGBA) {
+		col.A = 0xFF
+		if !seen[col] {
+			seen[col] = true
+			pal = append(pal, col)
+		}
+	}
+	for _, row := range c.Grid {
+		for _, cell := range row {
+			add(cell.Fg)
+			add(cell.Bg)
+		}
+	}
+	if len(pal) <= maxSixelColors {
+		return pal
+	}
+
+	pal = make([]color.RGBA, len(colorpalette.Plan9))
+	for i, col := range colorpalette.Plan9 {
+		pal[i] = color.RGBAModel.Convert(col).(color.RGBA)
+	}
+	return pal
+}
+
+// percent converts an 8-bit channel to the 0-100 range sixel colors use.
+func percent(v uint8) int {
+	return (int(v)*100 + 127) / 255
+}
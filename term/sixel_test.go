@@ -0,0 +1,263 @@
+package term
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/renderer"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodeSixel is a minimal sixel decoder for the subset SixelWriter emits.
+// It fails if a pixel is painted twice or not at all.
+func decodeSixel(t *testing.T, data string) *image.RGBA {
+	t.Helper()
+	if !strings.HasPrefix(data, "\x1bP0;1;0q\"1;1;") || !strings.HasSuffix(data, "\x1b\\") {
+		t.Fatalf("bad sixel framing: %q", data[:min(20, len(data))])
+	}
+	s := strings.TrimSuffix(strings.TrimPrefix(data, "\x1bP0;1;0q\"1;1;"), "\x1b\\")
+	var width, height int
+	n, err := fmt.Sscanf(s, "%d;%d", &width, &height)
+	if n != 2 {
+		t.Fatalf("bad raster attributes: %v", err)
+	}
+	s = strings.TrimLeft(s, "0123456789;")
+
+	number := func() int {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		v, _ := strconv.Atoi(s[:i])
+		s = s[i:]
+		return v
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	painted := make([]bool, width*height)
+	regs := map[int]color.RGBA{}
+	var cur color.RGBA
+	x, top := 0, 0
+	paint := func(ch byte, run int) {
+		for ; run > 0; run-- {
+			for dy := 0; dy < 6; dy++ {
+				if (ch-'?')&(1<<dy) == 0 {
+					continue
+				}
+				if x >= width || top+dy >= height {
+					t.Fatalf("pixel %d,%d outside the image", x, top+dy)
+				}
+				if painted[(top+dy)*width+x] {
+					t.Fatalf("pixel %d,%d painted twice", x, top+dy)
+				}
+				painted[(top+dy)*width+x] = true
+				img.SetRGBA(x, top+dy, cur)
+			}
+			x++
+		}
+	}
+	for s != "" {
+		ch := s[0]
+		s = s[1:]
+		switch {
+		case ch == '#':
+			reg := number()
+			if strings.HasPrefix(s, ";2;") {
+				s = s[3:]
+				r := number()
+				s = s[1:]
+				g := number()
+				s = s[1:]
+				b := number()
+				regs[reg] = color.RGBA{uint8(r * 255 / 100), uint8(g * 255 / 100), uint8(b * 255 / 100), 0xFF}
+			} else {
+				cur = regs[reg]
+			}
+		case ch == '!':
+			run := number()
+			ch, s = s[0], s[1:]
+			paint(ch, run)
+		case ch == '$':
+			x = 0
+		case ch == '-':
+			x, top = 0, top+6
+		case ch >= '?' && ch <= '~':
+			paint(ch, 1)
+		default:
+			t.Fatalf("unexpected byte %q in sixel data", ch)
+		}
+	}
+	for i, ok := range painted {
+		if !ok {
+			t.Fatalf("pixel %d,%d not painted", i%width, i/width)
+		}
+	}
+	return img
+}
+
+func testCanvas() *canvas.Canvas {
+	c := canvas.NewCanvas(80)
+	colors := []color.RGBA{
+		{0xAA, 0, 0, 0xFF}, {0, 0xAA, 0, 0xFF}, {0, 0, 0xAA, 0xFF}, {0xFF, 0xFF, 0x55, 0xFF},
+	}
+	for i, r := range "Hi █░▒" {
+		c.SetCell(r, colors[i%len(colors)], colors[(i+1)%len(colors)], false, false, false)
+	}
+	c.NewLine()
+	c.SetCell('!', canvas.DefaultFg, canvas.DefaultBg, false, false, false)
+	return c
+}
+
+func TestSixel(t *testing.T) {
+	for _, scale := range []float64{0.5, 1} {
+		c := testCanvas()
+		var out bytes.Buffer
+		if err := NewSixelWriter(c, &out, scale).Write(); err != nil {
+			t.Fatal(err)
+		}
+		got := decodeSixel(t, out.String())
+
+		want, err := renderer.ToImage(c, scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Bounds().Size() != want.Bounds().Size() {
+			t.Fatalf("scale %v: sixel is %v, image is %v", scale, got.Bounds().Size(), want.Bounds().Size())
+		}
+		// Every pixel takes one of the cell colors, so solid areas match
+		// exactly (up to the percent rounding of the registers).
+		pal := sixelPalette(c)
+		for y := 0; y < got.Bounds().Dy(); y++ {
+			for x := 0; x < got.Bounds().Dx(); x++ {
+				p := got.RGBAAt(x, y)
+				if !nearPalette(p, pal) {
+					t.Fatalf("scale %v: pixel %d,%d is %v, not a palette color", scale, x, y, p)
+				}
+			}
+		}
+		// The full block (cell 3 of row 0) is solid foreground.
+		w, h := want.Bounds().Dx()/6, want.Bounds().Dy()/2
+		if p := got.RGBAAt(3*w+w/2, h/2); !near(p, color.RGBA{0xFF, 0xFF, 0x55, 0xFF}) {
+			t.Errorf("scale %v: full block is %v", scale, p)
+		}
+	}
+}
+
+func near(a, b color.RGBA) bool {
+	d := func(x, y uint8) bool { return x-y <= 3 || y-x <= 3 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B)
+}
+
+func nearPalette(c color.RGBA, pal []color.RGBA) bool {
+	for _, p := range pal {
+		if near(c, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSixelPalette(t *testing.T) {
+	c := testCanvas()
+	pal := sixelPalette(c)
+	if pal[0] != canvas.DefaultBg {
+		t.Errorf("register 0 is %v, want the default background", pal[0])
+	}
+	if len(pal) != 6 { // Black, the four colors and the default foreground.
+		t.Errorf("got %d registers, want 6: %v", len(pal), pal)
+	}
+
+	// Truecolor art with too many colors falls back to a fixed palette.
+	c = canvas.NewCanvas(300)
+	for i := 0; i < 300; i++ {
+		c.SetCell('x', color.RGBA{uint8(i), uint8(i >> 8), 0x40, 0xFF}, canvas.DefaultBg, false, false, false)
+	}
+	if pal := sixelPalette(c); len(pal) != maxSixelColors {
+		t.Errorf("got %d registers, want %d", len(pal), maxSixelColors)
+	}
+}
+
+func TestWriteSixelRun(t *testing.T) {
+	tests := []struct {
+		run  int
+		want string
+	}{
+		{1, "~"},
+		{3, "~~~"},
+		{4, "!4~"},
+		{100, "!100~"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		bw := bufio.NewWriter(&out)
+		writeSixelRun(bw, '~', tt.run)
+		bw.Flush()
+		if out.String() != tt.want {
+			t.Errorf("run %d: got %q, want %q", tt.run, out.String(), tt.want)
+		}
+	}
+}
+
+func TestKitty(t *testing.T) {
+	// A canvas large enough to need several chunks.
+	c := canvas.NewCanvas(80)
+	for i := 0; i < 80*25; i++ {
+		c.SetCell(rune('!'+i%90), color.RGBA{uint8(i), uint8(i * 7), uint8(i * 13), 0xFF}, canvas.DefaultBg, false, false, false)
+	}
+	var out bytes.Buffer
+	if err := NewKittyWriter(c, &out, 1).Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := strings.TrimSuffix(out.String(), "\n")
+	chunks := strings.SplitAfter(s, "\x1b\\")
+	if chunks[len(chunks)-1] == "" {
+		chunks = chunks[:len(chunks)-1]
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+	var payload strings.Builder
+	for i, chunk := range chunks {
+		head, data, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(chunk, "\x1b_G"), "\x1b\\"), ";")
+		if !ok {
+			t.Fatalf("chunk %d has no payload: %q", i, chunk[:min(20, len(chunk))])
+		}
+		wantHead := "m=1"
+		if i == 0 {
+			wantHead = "f=100,a=T,m=1"
+		}
+		if i == len(chunks)-1 {
+			wantHead = "m=0"
+		}
+		if head != wantHead {
+			t.Errorf("chunk %d: header %q, want %q", i, head, wantHead)
+		}
+		if len(data) > kittyChunkSize {
+			t.Errorf("chunk %d: %d bytes of payload", i, len(data))
+		}
+		payload.WriteString(data)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := renderer.ToPNGScaled(c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Error("transmitted PNG differs from the rendered one")
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Error(err)
+	}
+}
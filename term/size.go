@@ -0,0 +1,20 @@
+package term
+
+import (
+	"os"
+	"strconv"
+)
+
+// Size returns the size of the terminal attached to f, falling back to the
+// COLUMNS and LINES environment variables. ok is false if neither is known.
+func Size(f *os.File) (cols, rows int, ok bool) {
+	if cols, rows, ok = ioctlSize(f); ok {
+		return cols, rows, true
+	}
+	cols, errC := strconv.Atoi(os.Getenv("COLUMNS"))
+	rows, errR := strconv.Atoi(os.Getenv("LINES"))
+	if errC != nil || errR != nil || cols <= 0 || rows <= 0 {
+		return 0, 0, false
+	}
+	return cols, rows, true
+}
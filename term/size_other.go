@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package term
+
+import "os"
+
+// ioctlSize is not available on this platform.
+func ioctlSize(f *os.File) (cols, rows int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package term
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ioctlSize asks the kernel for the window size of the terminal behind f.
+func ioctlSize(f *os.File) (cols, rows int, ok bool) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
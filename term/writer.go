@@ -0,0 +1,185 @@
+// Package term previews a canvas directly in a terminal using 24-bit color
+// escape sequences.
+package term
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"a2m2a/renderer"
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Options controls terminal output.
+type Options struct {
+	// Width crops text output (and sizes pixel output) to this many columns.
+	// Zero means no cropping in text mode and 80 columns in pixel mode.
+	Width int
+	// PageHeight pauses after this many lines when Pager is set.
+	PageHeight int
+	// Pager is read from (until a newline) between pages, typically the
+	// controlling terminal. Nil disables paging.
+	Pager io.Reader
+	// MapCP437 shows control characters as their CP437 pictographs.
+	MapCP437 bool
+	// Pixels renders the canvas to an image first and shows it with ▀
+	// half-blocks, two image pixels per terminal cell.
+	Pixels bool
+}
+
+// Writer renders a canvas to a truecolor terminal.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+	opts   Options
+}
+
+// NewWriter creates a new terminal writer.
+func NewWriter(c *canvas.Canvas, w io.Writer, opts Options) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+		opts:   opts,
+	}
+}
+
+// Write renders the canvas as text cells or, in pixel mode, as half-blocks.
+func (w *Writer) Write() error {
+	bw := bufio.NewWriter(w.writer)
+	var err error
+	if w.opts.Pixels {
+		err = w.writePixels(bw)
+	} else {
+		err = w.writeCells(bw)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeCells emits every cell with its exact RGB colors.
+func (w *Writer) writeCells(bw *bufio.Writer) error {
+	_, maxRow, _, maxCol := w.canvas.GetContentBounds()
+	if w.opts.Width > 0 && maxCol >= w.opts.Width {
+		maxCol = w.opts.Width - 1
+	}
+
+	for r := 0; r <= maxRow; r++ {
+		var prev canvas.Cell
+		first := true
+		for col := 0; col <= maxCol; col++ {
+			cell := w.canvas.Grid[r][col]
+			if first || cell.Fg != prev.Fg || cell.Bg != prev.Bg || cell.Bold != prev.Bold {
+				bold := 22
+				if cell.Bold {
+					bold = 1
+				}
+				fmt.Fprintf(bw, "\x1b[%d;38;2;%d;%d;%d;48;2;%d;%d;%dm", bold,
+					cell.Fg.R, cell.Fg.G, cell.Fg.B, cell.Bg.R, cell.Bg.G, cell.Bg.B)
+				prev, first = cell, false
+			}
+			char := cell.Char
+			if w.opts.MapCP437 {
+				char = cp437.ToUnicode(char)
+			} else if char < 0x20 || char == 0x7F {
+				char = ' ' // Never send raw control characters to the terminal.
+			}
+			bw.WriteRune(char)
+		}
+		bw.WriteString("\x1b[0m\n")
+		if err := w.pageBreak(bw, r+1, maxRow+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePixels downsamples the rendered image into ▀ cells: the foreground
+// color paints the upper pixel and the background color the lower one.
+func (w *Writer) writePixels(bw *bufio.Writer) error {
+	img, err := renderer.ToImage(w.canvas, 1.0)
+	if err != nil {
+		return err
+	}
+	b := img.Bounds()
+	cols := w.opts.Width
+	if cols <= 0 {
+		cols = 80
+	}
+	if cols > b.Dx() {
+		cols = b.Dx()
+	}
+	// Each cell covers a square of the image horizontally and two squares
+	// vertically, so the aspect ratio is preserved.
+	pixelRows := b.Dy() * cols / b.Dx()
+	lines := (pixelRows + 1) / 2
+
+	for line := 0; line < lines; line++ {
+		for col := 0; col < cols; col++ {
+			top := sample(img, cols, pixelRows, col, 2*line)
+			bottom := sample(img, cols, pixelRows, col, 2*line+1)
+			fmt.Fprintf(bw, "\x1b[38;2;%d;%d;%d;48;2;%d;%d;%dm▀",
+				top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+		}
+		bw.WriteString("\x1b[0m\n")
+		if err := w.pageBreak(bw, line+1, lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample averages the block of source pixels covered by target pixel (x, y)
+// of a cols x rows downsampled image.
+func sample(img image.Image, cols, rows, x, y int) color.RGBA {
+	b := img.Bounds()
+	if y >= rows {
+		return color.RGBA{A: 0xFF}
+	}
+	x0 := b.Min.X + x*b.Dx()/cols
+	x1 := b.Min.X + (x+1)*b.Dx()/cols
+	y0 := b.Min.Y + y*b.Dy()/rows
+	y1 := b.Min.Y + (y+1)*b.Dy()/rows
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+
+	var r, g, bl, n uint32
+	for py := y0; py < y1; py++ {
+		for px := x0; px < x1; px++ {
+			cr, cg, cb, _ := img.At(px, py).RGBA()
+			r, g, bl, n = r+cr>>8, g+cg>>8, bl+cb>>8, n+1
+		}
+	}
+	return color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(bl / n), A: 0xFF}
+}
+
+// pageBreak waits for the user after every full page if paging is enabled.
+func (w *Writer) pageBreak(bw *bufio.Writer, written, total int) error {
+	if w.opts.Pager == nil || w.opts.PageHeight <= 1 || written >= total {
+		return nil
+	}
+	// Leave one line of the page for the prompt.
+	if written%(w.opts.PageHeight-1) != 0 {
+		return nil
+	}
+	bw.WriteString("\x1b[7m-- more (Enter) --\x1b[0m")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	buf := make([]byte, 1)
+	for {
+		if _, err := w.opts.Pager.Read(buf); err != nil || buf[0] == '\n' {
+			break
+		}
+	}
+	bw.WriteString("\r\x1b[2K")
+	return nil
+}
@@ -0,0 +1,115 @@
+package term
+
+import (
+	"a2m2a/canvas"
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// newCanvas builds a canvas from lines of text with the default colors.
+func newCanvas(width int, lines ...string) *canvas.Canvas {
+	c := canvas.NewCanvas(width)
+	for i, line := range lines {
+		if i > 0 {
+			c.NewLine()
+		}
+		for _, r := range line {
+			c.SetCell(r, canvas.DefaultFg, canvas.DefaultBg, false, false, false)
+		}
+	}
+	return c
+}
+
+func TestWriteCells(t *testing.T) {
+	red := color.RGBA{R: 0xAA, A: 0xFF}
+	tests := []struct {
+		name   string
+		canvas func() *canvas.Canvas
+		opts   Options
+		want   string
+	}{
+		{
+			name:   "default colors",
+			canvas: func() *canvas.Canvas { return newCanvas(80, "ab") },
+			want:   "\x1b[22;38;2;170;170;170;48;2;0;0;0mab\x1b[0m\n",
+		},
+		{
+			name: "color change",
+			canvas: func() *canvas.Canvas {
+				c := newCanvas(80, "a")
+				c.SetCell('b', red, canvas.DefaultBg, true, false, false)
+				return c
+			},
+			want: "\x1b[22;38;2;170;170;170;48;2;0;0;0ma\x1b[1;38;2;170;0;0;48;2;0;0;0mb\x1b[0m\n",
+		},
+		{
+			name:   "cropped",
+			canvas: func() *canvas.Canvas { return newCanvas(80, "abcdef", "gh") },
+			opts:   Options{Width: 3},
+			want:   "\x1b[22;38;2;170;170;170;48;2;0;0;0mabc\x1b[0m\n\x1b[22;38;2;170;170;170;48;2;0;0;0mgh \x1b[0m\n",
+		},
+		{
+			name:   "control characters blanked",
+			canvas: func() *canvas.Canvas { return newCanvas(80, "a\x1bb\x07") },
+			want:   "\x1b[22;38;2;170;170;170;48;2;0;0;0ma b \x1b[0m\n",
+		},
+		{
+			name:   "control characters as CP437",
+			canvas: func() *canvas.Canvas { return newCanvas(80, "\x01\x03") },
+			opts:   Options{MapCP437: true},
+			want:   "\x1b[22;38;2;170;170;170;48;2;0;0;0m☺♥\x1b[0m\n",
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := NewWriter(tt.canvas(), &out, tt.opts).Write(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := out.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWritePixels(t *testing.T) {
+	c := newCanvas(80, "\u2588\u2588", "  ")
+	var out bytes.Buffer
+	if err := NewWriter(c, &out, Options{Width: 4, Pixels: true}).Write(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %d lines, want at least 2:\n%q", len(lines), out.String())
+	}
+	for i, line := range lines {
+		if n := strings.Count(line, "▀"); n != 4 {
+			t.Errorf("line %d has %d half-blocks, want 4", i, n)
+		}
+	}
+	// The full blocks are light grey, the blank row below black.
+	if !strings.HasPrefix(lines[0], "\x1b[38;2;170;170;170;48;2;170;170;170m") {
+		t.Errorf("top line starts %q", lines[0][:min(40, len(lines[0]))])
+	}
+	last := lines[len(lines)-1]
+	if !strings.Contains(last, ";48;2;0;0;0m") {
+		t.Errorf("bottom line %q has no black pixels", last)
+	}
+}
+
+func TestPager(t *testing.T) {
+	c := newCanvas(80, "1", "2", "3", "4", "5")
+	var out bytes.Buffer
+	pager := strings.NewReader("\n\nxx\n")
+	if err := NewWriter(c, &out, Options{PageHeight: 3, Pager: pager}).Write(); err != nil {
+		t.Fatal(err)
+	}
+	// Two lines per page, then the prompt; no prompt after the last page.
+	if got := strings.Count(out.String(), "-- more (Enter) --"); got != 2 {
+		t.Errorf("got %d prompts, want 2:\n%q", got, out.String())
+	}
+	if pager.Len() != 3 {
+		t.Errorf("pager has %d bytes left, want 3", pager.Len())
+	}
+}
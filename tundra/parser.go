@@ -0,0 +1,148 @@
+// Package tundra reads and writes TundraDraw (.tnd) files, which give every
+// cell a 24-bit foreground and background color.
+package tundra
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/internal/stream"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Magic is the signature at the start of a TundraDraw file.
+const Magic = "\x18TUNDRA24"
+
+// Commands in the cell stream. Any other byte is a character.
+const (
+	cmdPosition   = 1 // <row:4> <col:4>, big-endian.
+	cmdForeground = 2 // <char> <rgb:4>
+	cmdBackground = 4 // <char> <rgb:4>
+	cmdBoth       = 6 // <char> <fg:4> <bg:4>
+)
+
+// Parser holds the state for parsing a TundraDraw stream.
+type Parser struct {
+	canvas *canvas.Canvas
+	reader *stream.Reader
+	fg, bg color.RGBA
+
+	// Diagnostics, if not nil, collects the truncated and out of range
+	// commands found.
+	Diagnostics *diag.Collector
+	// seqStart is the offset of the command being parsed.
+	seqStart int64
+}
+
+// NewParser creates a new TundraDraw parser.
+func NewParser(c *canvas.Canvas, r io.Reader) *Parser {
+	return &Parser{
+		canvas: c,
+		reader: stream.NewReader(r),
+		fg:     canvas.DefaultFg,
+		bg:     canvas.DefaultBg,
+	}
+}
+
+// Parse reads the stream and updates the canvas. A truncated command at the
+// end of the stream is reported and otherwise ignored.
+func (p *Parser) Parse() error {
+	if magic, err := p.reader.ReadN(len(Magic)); err != nil || string(magic) != Magic {
+		return errors.New("not a TundraDraw file")
+	}
+
+	for {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		p.seqStart = p.reader.Offset() - 1
+		switch b {
+		case cmdPosition:
+			args, err := p.reader.ReadN(8)
+			if err != nil {
+				return p.truncated(err)
+			}
+			row, col := be32(args[0:4]), be32(args[4:8])
+			// Rows are left to the canvas limits, which fail the parse
+			// rather than grow without bound.
+			if col < uint32(p.canvas.Width()) {
+				p.canvas.SetCursor(int(row), int(col))
+			} else {
+				p.report(diag.Error, "position %d,%d out of range", row, col)
+			}
+			continue
+		case cmdForeground, cmdBackground:
+			args, err := p.reader.ReadN(5)
+			if err != nil {
+				return p.truncated(err)
+			}
+			if b == cmdForeground {
+				p.fg = rgb(args[1:5])
+			} else {
+				p.bg = rgb(args[1:5])
+			}
+			b = args[0]
+		case cmdBoth:
+			args, err := p.reader.ReadN(9)
+			if err != nil {
+				return p.truncated(err)
+			}
+			p.fg, p.bg = rgb(args[1:5]), rgb(args[5:9])
+			b = args[0]
+		}
+
+		// A character that collides with a command code can't be drawn
+		// after a color change either; TundraDraw itself skips it.
+		if isCommand(b) {
+			continue
+		}
+		p.canvas.Put(canvas.Cell{
+			Char: charmap.CodePage437.DecodeByte(b),
+			Fg:   p.fg,
+			Bg:   p.bg,
+		})
+	}
+}
+
+// truncated reports a command cut off by the end of the input, which ends
+// the parse without an error. Other read errors are returned.
+func (p *Parser) truncated(err error) error {
+	if !stream.IsEOF(err) {
+		return err
+	}
+	p.report(diag.Error, "truncated command at end of input")
+	return nil
+}
+
+// report records a diagnostic for the command being parsed, at the cursor.
+func (p *Parser) report(sev diag.Severity, format string, args ...any) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   p.seqStart,
+		Row:      p.canvas.Cursor.Row,
+		Col:      p.canvas.Cursor.Col,
+		Severity: sev,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func isCommand(b byte) bool {
+	return b == cmdPosition || b == cmdForeground || b == cmdBackground || b == cmdBoth
+}
+
+// rgb decodes a color stored as a zero byte followed by red, green and blue.
+func rgb(b []byte) color.RGBA {
+	return color.RGBA{R: b[1], G: b[2], B: b[3], A: 255}
+}
+
+func be32(b []byte) uint32 {
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
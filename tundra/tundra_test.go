@@ -0,0 +1,168 @@
+package tundra
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bytes"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := canvas.NewCanvas(80)
+	for i, r := range "Truecolor ░▒▓█ art" {
+		c.Put(canvas.Cell{
+			Char: r,
+			Fg:   color.RGBA{uint8(i * 13), uint8(255 - i*7), 0x42, 0xff},
+			Bg:   color.RGBA{0x10, uint8(i * 3), uint8(i * 11), 0xff},
+		})
+	}
+	c.SetCursor(2, 5)
+	c.Put(canvas.Cell{Char: 'x', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+	c.SetCursor(3, 0)
+	for range 80 { // A full row.
+		c.Put(canvas.Cell{Char: '#', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+	}
+	c.Put(canvas.Cell{Char: '!', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+
+	var out bytes.Buffer
+	if err := NewWriter(c, &out).Write(); err != nil {
+		t.Fatal(err)
+	}
+	got := canvas.NewCanvas(80)
+	if err := NewParser(got, &out).Parse(); err != nil {
+		t.Fatal(err)
+	}
+	_, maxRow, _, _ := c.GetContentBounds()
+	for r := 0; r <= maxRow; r++ {
+		for col, want := range c.Grid[r] {
+			if g := got.Grid[r][col]; g.Char != want.Char || want.Char != ' ' && (g.Fg != want.Fg || g.Bg != want.Bg) {
+				t.Fatalf("cell %d,%d = %q %v on %v, want %q %v on %v", r, col, g.Char, g.Fg, g.Bg, want.Char, want.Fg, want.Bg)
+			}
+		}
+	}
+}
+
+func TestRoundTripTall(t *testing.T) {
+	// Rows past any format-specific limit, up to the canvas limit.
+	c := canvas.NewCanvas(80)
+	c.SetCursor(canvas.MaxRows-1, 3)
+	c.Put(canvas.Cell{Char: 'x', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+	var out bytes.Buffer
+	if err := NewWriter(c, &out).Write(); err != nil {
+		t.Fatal(err)
+	}
+	got := canvas.NewCanvas(80)
+	if err := NewParser(got, &out).Parse(); err != nil || got.Err() != nil {
+		t.Fatalf("parse: %v, canvas: %v", err, got.Err())
+	}
+	if len(got.Grid) != canvas.MaxRows || got.Grid[canvas.MaxRows-1][3].Char != 'x' {
+		t.Errorf("got %d rows, want the x on the last of %d", len(got.Grid), canvas.MaxRows)
+	}
+
+	// A position past the limit fails like any other overgrown canvas.
+	got = canvas.NewCanvas(80)
+	in := Magic + "\x01\x00\x00\x4e\x20\x00\x00\x00\x00x" // Row 20000.
+	if err := NewParser(got, strings.NewReader(in)).Parse(); err != nil || !errors.Is(got.Err(), canvas.ErrTooLarge) {
+		t.Errorf("row past the limit: parse %v, canvas %v, want canvas.ErrTooLarge", err, got.Err())
+	}
+}
+
+func TestWrite(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	tests := []struct {
+		name  string
+		cells []canvas.Cell
+		want  string
+	}{
+		{"default colors", []canvas.Cell{{Char: 'a', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg}}, "a"},
+		{"foreground", []canvas.Cell{{Char: 'a', Fg: red, Bg: canvas.DefaultBg}, {Char: 'b', Fg: red, Bg: canvas.DefaultBg}}, "\x02a\x00\xff\x00\x00b"},
+		{"background", []canvas.Cell{{Char: 'a', Fg: canvas.DefaultFg, Bg: red}}, "\x04a\x00\xff\x00\x00"},
+		{"both", []canvas.Cell{{Char: 'a', Fg: red, Bg: red}}, "\x06a\x00\xff\x00\x00\x00\xff\x00\x00"},
+		// Glyphs whose code is a command byte can't be stored.
+		{"command glyphs", []canvas.Cell{
+			{Char: '☺', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg},
+			{Char: '☻', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg},
+			{Char: '♦', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg},
+			{Char: '♥', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg},
+		}, "???\x03"},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		for _, cell := range tt.cells {
+			c.Put(cell)
+		}
+		var out bytes.Buffer
+		if err := NewWriter(c, &out).Write(); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimPrefix(out.String(), Magic); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"text", Magic + "ab", "ab", false},
+		{"position", Magic + "\x01\x00\x00\x00\x00\x00\x00\x00\x03x", "   x", false},
+		{"position out of range", Magic + "a\x01\x00\x00\x00\x00\x00\x00\x01\x00b", "ab", false},
+		{"color", Magic + "\x02a\x00\xff\x00\x00", "a", false},
+		{"truncated command", Magic + "ab\x06a\x00", "ab", false},
+		{"bad magic", "\x18TUNDRA23ab", "", true},
+		{"empty", "", "", true},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		err := NewParser(c, strings.NewReader(tt.in)).Parse()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got []rune
+		for _, cell := range c.Grid[0] {
+			got = append(got, cell.Char)
+		}
+		if s := strings.TrimRight(string(got), " "); s != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, s, tt.want)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"clean", Magic + "\x01\x00\x00\x00\x01\x00\x00\x00\x02\x06a\x00\x01\x02\x03\x00\x04\x05\x06b", nil},
+		{"truncated color", Magic + "a\x02b\x00\x01", []string{"1:2 (byte 10): error: truncated command at end of input"}},
+		{"truncated position", Magic + "\x01\x00", []string{"1:1 (byte 9): error: truncated command at end of input"}},
+		{"position out of range", Magic + "\x01\x00\x00\x00\x00\x00\x00\x01\xf4", []string{"1:1 (byte 9): error: position 0,500 out of range"}},
+	}
+	for _, tt := range tests {
+		c := canvas.NewCanvas(80)
+		p := NewParser(c, strings.NewReader(tt.input))
+		p.Diagnostics = &diag.Collector{}
+		if err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
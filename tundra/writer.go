@@ -0,0 +1,93 @@
+package tundra
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/cp437"
+	"bufio"
+	"image/color"
+	"io"
+)
+
+// Writer converts a canvas to a TundraDraw file.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+}
+
+// NewWriter creates a new TundraDraw writer.
+func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+	}
+}
+
+// Write generates the TundraDraw output. Colors are kept exactly; trailing
+// blanks are skipped with position commands. Characters whose CP437 code is a
+// command byte can't be stored and are written as '?'.
+func (w *Writer) Write() error {
+	bw := bufio.NewWriter(w.writer)
+	bw.WriteString(Magic)
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	fg, bg := canvas.DefaultFg, canvas.DefaultBg
+	width := w.canvas.Width()
+
+	for r := 0; r <= maxRow; r++ {
+		row := w.canvas.Grid[r]
+		lastCharIndex := -1
+		for i := len(row) - 1; i >= 0; i-- {
+			if row[i].Char != ' ' || row[i].Bg != canvas.DefaultBg {
+				lastCharIndex = i
+				break
+			}
+		}
+		if lastCharIndex < 0 {
+			continue
+		}
+		// The previous row ended early, so the cursor isn't at this one.
+		if r > 0 && !fullRow(w.canvas.Grid[r-1], width) {
+			bw.WriteByte(cmdPosition)
+			bw.Write(be32Bytes(uint32(r)))
+			bw.Write(be32Bytes(0))
+		}
+
+		for i := 0; i <= lastCharIndex; i++ {
+			cell := row[i]
+			ch, ok := cp437.Encode(cell.Char)
+			if !ok || isCommand(ch) {
+				ch = '?'
+			}
+			switch {
+			case cell.Fg != fg && cell.Bg != bg:
+				bw.Write([]byte{cmdBoth, ch})
+				bw.Write(rgbBytes(cell.Fg))
+				bw.Write(rgbBytes(cell.Bg))
+			case cell.Fg != fg:
+				bw.Write([]byte{cmdForeground, ch})
+				bw.Write(rgbBytes(cell.Fg))
+			case cell.Bg != bg:
+				bw.Write([]byte{cmdBackground, ch})
+				bw.Write(rgbBytes(cell.Bg))
+			default:
+				bw.WriteByte(ch)
+			}
+			fg, bg = cell.Fg, cell.Bg
+		}
+	}
+	return bw.Flush()
+}
+
+// fullRow reports whether the writer emitted every cell of row, leaving the
+// cursor at the start of the next one.
+func fullRow(row []canvas.Cell, width int) bool {
+	last := row[width-1]
+	return last.Char != ' ' || last.Bg != canvas.DefaultBg
+}
+
+func rgbBytes(c color.RGBA) []byte {
+	return []byte{0, c.R, c.G, c.B}
+}
+
+func be32Bytes(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
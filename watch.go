@@ -0,0 +1,304 @@
+package main
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/convert"
+	"a2m2a/sauce"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// watchInterval is how often the watched files are polled. Platforms with
+	// file system notifications are woken up earlier.
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce is how long the files must stay unchanged before a
+	// re-render, so that editors saving in several steps trigger only once.
+	watchDebounce = 200 * time.Millisecond
+)
+
+// fileState is what the poller compares to notice a change.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot maps every watched file to its last seen state.
+type snapshot map[string]fileState
+
+// scanWatched stats the watched file, or every readable art file below the
+// watched directory. Files below skipDir (the output directory) are ignored
+// so that our own outputs never trigger a re-render.
+func scanWatched(root, skipDir string) (snapshot, error) {
+	if skipDir != "" {
+		// WalkDir paths are spelled like root, which may differ from -o
+		// ("out" and "./art/../out"); compare absolute paths.
+		skipDir = absPath(skipDir)
+	}
+	snap := snapshot{}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		snap[root] = fileState{info.ModTime(), info.Size()}
+		return snap, nil
+	}
+
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil // Files may disappear while we walk.
+		}
+		if d.IsDir() {
+			if skipDir != "" && absPath(path) == skipDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if f := convert.ForPath(path); f == nil || f.Decoder == nil || f.Image {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			snap[path] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return snap, err
+}
+
+// changedFiles lists the files that are new or modified in next.
+func changedFiles(prev, next snapshot) []string {
+	var changed []string
+	for path, state := range next {
+		if old, ok := prev[path]; !ok || old != state {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// watch calls onChange with the state of every watched file and the changed
+// files whenever the watched file or directory changes, until the context is
+// canceled. Bursts of changes are debounced into a single call.
+func watch(ctx context.Context, root, skipDir string, onChange func(snap snapshot, changed []string)) error {
+	prev, err := scanWatched(root, skipDir)
+	if err != nil {
+		return err
+	}
+
+	events, stop := watchEvents(root)
+	defer stop()
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-events:
+		}
+
+		next, err := scanWatched(root, skipDir)
+		if err != nil {
+			continue // The file may be in the middle of being replaced.
+		}
+		pending := changedFiles(prev, next)
+		if len(pending) == 0 {
+			continue
+		}
+
+		settled, more, err := settle(ctx, root, skipDir, next)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			continue // The file was removed; render it once it is back.
+		}
+		prev = settled
+		onChange(settled, dedupe(append(pending, more...)))
+	}
+}
+
+// settle waits until the watched files stop changing, starting from snap. It
+// returns their final state and the files that changed meanwhile, or an error
+// if the watched path disappeared or the context was canceled.
+func settle(ctx context.Context, root, skipDir string, snap snapshot) (snapshot, []string, error) {
+	var changed []string
+	timer := time.NewTimer(watchDebounce)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+		next, err := scanWatched(root, skipDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		more := changedFiles(snap, next)
+		if len(more) == 0 {
+			return next, changed, nil
+		}
+		snap = next
+		changed = append(changed, more...)
+		timer.Reset(watchDebounce)
+	}
+}
+
+func dedupe(paths []string) []string {
+	sort.Strings(paths)
+	out := paths[:0]
+	for i, p := range paths {
+		if i == 0 || p != paths[i-1] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// runWatchMode renders the input once and then again on every change. A
+// directory input is mirrored into the -o directory like batch mode.
+func runWatchMode() {
+	if inPath == "" {
+		log.Fatalf("Watch mode requires an input file or directory with -i or --in.")
+	}
+	if outPath == "" {
+		log.Fatalf("Watch mode requires an output path with -o or --out.")
+	}
+	info, err := os.Stat(inPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	decodeOpts := decodeOptions()
+
+	var render func(snap snapshot, paths []string)
+	skipDir := ""
+	if info.IsDir() {
+		batchTargets, err := parseTargets(targets)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		cfg := batchConfig{outDir: outPath, from: fromFormat, targets: batchTargets, decodeOpts: decodeOpts}
+		skipDir = outPath
+		render = func(snap snapshot, paths []string) {
+			// Files may have been added, so the outputs are checked again on
+			// every change, like a batch run checks them up front.
+			jobs, err := watchedJobs(inPath, outPath, snap)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", inPath, err)
+				return
+			}
+			cfg.inputs = inputSet(jobs)
+			for _, path := range paths {
+				rel, err := filepath.Rel(inPath, path)
+				if err != nil {
+					continue
+				}
+				if _, err := processBatchJob(context.Background(), batchJob{inPath: path, relPath: rel}, cfg); err != nil {
+					fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", path, err)
+					continue
+				}
+				fmt.Printf("%s rendered %s\n", time.Now().Format("15:04:05"), path)
+			}
+		}
+	} else {
+		if absPath(outPath) == absPath(inPath) {
+			log.Fatalf("Error: the output %s is the watched input file.", outPath)
+		}
+		render = func(snapshot, []string) {
+			if err := renderWatched(context.Background(), decodeOpts); err != nil {
+				fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", inPath, err)
+				return
+			}
+			fmt.Printf("%s rendered %s -> %s\n", time.Now().Format("15:04:05"), inPath, outPath)
+		}
+	}
+
+	// Render everything once up front, then only what changes.
+	initial, err := scanWatched(inPath, skipDir)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if info.IsDir() {
+		if _, err := watchedJobs(inPath, outPath, initial); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	var all []string
+	for path := range initial {
+		all = append(all, path)
+	}
+	render(initial, dedupe(all))
+
+	fmt.Printf("Watching %s for changes (Ctrl+C to stop)...\n", inPath)
+	if err := watch(context.Background(), inPath, skipDir, render); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// renderWatched converts the watched input file to the output path (and the
+// thumbnail, if requested), replacing the outputs atomically.
+func renderWatched(ctx context.Context, opts convert.DecodeOptions) error {
+	file, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	opts.Sauce, _ = sauce.Get(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	c, inFormat, err := convert.Decode(ctx, file, convert.InputFormat(fromFormat, inPath), opts)
+	if err != nil {
+		return err
+	}
+	outFormat, err := selectOutputFormat(inFormat)
+	if err != nil {
+		return err
+	}
+	if err := writeWatched(ctx, outPath, c, outFormat, convert.EncodeOptions{}); err != nil {
+		return err
+	}
+	if outFormat.Image && thumb > 0 {
+		thumbPath := constructThumbPath(outPath)
+		if !strings.HasSuffix(outPath, ".png") {
+			thumbPath = outPath + "_thumb.png"
+		}
+		return writeWatched(ctx, thumbPath, c, outFormat, convert.EncodeOptions{Scale: 0.5})
+	}
+	return nil
+}
+
+// writeWatched writes an output of the watched file, refusing to replace the
+// file itself: that would lose it and trigger the watcher again.
+func writeWatched(ctx context.Context, path string, c *canvas.Canvas, f *convert.Format, opts convert.EncodeOptions) error {
+	if absPath(path) == absPath(inPath) {
+		return fmt.Errorf("%s: refusing to overwrite the input file", path)
+	}
+	return writeFile(ctx, path, c, f, opts)
+}
+
+// watchedJobs lists the batch jobs for the files of snap below root, and
+// fails like a batch run if two of them would write the same outputs.
+func watchedJobs(root, outDir string, snap snapshot) ([]batchJob, error) {
+	var jobs []batchJob
+	for path := range snap {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			jobs = append(jobs, batchJob{inPath: path, relPath: rel})
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].inPath < jobs[j].inPath })
+	return jobs, checkBatchOutputs(jobs, outDir)
+}
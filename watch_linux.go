@@ -0,0 +1,53 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// watchEvents uses inotify to wake the watcher as soon as something changes
+// in the watched directory (or in the directory holding the watched file,
+// since editors often save by renaming a new file into place). Polling still
+// decides what changed; the events only cut the latency. Subdirectories
+// created after startup are picked up by polling alone.
+func watchEvents(root string) (<-chan struct{}, func()) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, func() {}
+	}
+
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_CREATE |
+		syscall.IN_MOVED_TO | syscall.IN_DELETE
+	dirs := []string{root}
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		dirs = []string{filepath.Dir(root)}
+	} else {
+		filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err == nil && d.IsDir() && path != root {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+	}
+	for _, dir := range dirs {
+		syscall.InotifyAddWatch(fd, dir, mask)
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if n, err := syscall.Read(fd, buf); n <= 0 || err != nil {
+				return // The descriptor was closed.
+			}
+			select {
+			case events <- struct{}{}:
+			default: // A wake-up is already pending.
+			}
+		}
+	}()
+	return events, func() { syscall.Close(fd) }
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// watchEvents has no file system notifications to offer on this platform, so
+// the watcher relies on polling alone.
+func watchEvents(root string) (<-chan struct{}, func()) {
+	return nil, func() {}
+}
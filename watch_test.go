@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScanWatchedSkipsOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"art/a.ans":     "a",
+		"art/out/b.ans": "b",
+		"art/notes.xyz": "",
+	})
+	t.Chdir(dir)
+
+	// The output directory is spelled differently from the walked paths.
+	for _, skip := range []string{"art/out", "./art/out/", filepath.Join(dir, "art", "out"), "art/../art/out"} {
+		snap, err := scanWatched("art", skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for path := range snap {
+			got = append(got, path)
+		}
+		if want := []string{filepath.Join("art", "a.ans")}; !slices.Equal(got, want) {
+			t.Errorf("skip %q: scanned %v, want %v", skip, got, want)
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	now := time.Now()
+	prev := snapshot{"a": {now, 1}, "b": {now, 1}, "gone": {now, 1}}
+	next := snapshot{"a": {now, 1}, "b": {now, 2}, "new": {now, 1}}
+	if got, want := changedFiles(prev, next), []string{"b", "new"}; !slices.Equal(got, want) {
+		t.Errorf("changedFiles = %v, want %v", got, want)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.ans")
+	writeFiles(t, dir, map[string]string{"a.ans": "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- watch(ctx, path, "", func(_ snapshot, changed []string) { changes <- changed })
+	}()
+
+	wait := func() []string {
+		t.Helper()
+		select {
+		case changed := <-changes:
+			return changed
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change reported")
+			return nil
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	writeFiles(t, dir, map[string]string{"a.ans": "ab"})
+	if got := wait(); !slices.Equal(got, []string{path}) {
+		t.Errorf("changed = %v, want %v", got, []string{path})
+	}
+
+	// A deleted file is picked up again once it is back.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * watchInterval)
+	writeFiles(t, dir, map[string]string{"a.ans": "abc"})
+	if got := wait(); !slices.Equal(got, []string{path}) {
+		t.Errorf("changed = %v, want %v", got, []string{path})
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("watch returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop when canceled")
+	}
+}
+
+func TestWatchedJobs(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"art/a.ans": "a", "art/b.ans": "b"})
+	snap, err := scanWatched(filepath.Join(dir, "art"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	jobs, err := watchedJobs(filepath.Join(dir, "art"), out, snap)
+	if err != nil || len(jobs) != 2 || jobs[0].relPath != "a.ans" {
+		t.Errorf("watchedJobs = %v, %v", jobs, err)
+	}
+
+	// A file added later that collides with another one's outputs.
+	writeFiles(t, dir, map[string]string{"art/a.asc": "a"})
+	if snap, err = scanWatched(filepath.Join(dir, "art"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watchedJobs(filepath.Join(dir, "art"), out, snap); err == nil {
+		t.Error("colliding outputs are not an error")
+	}
+}
+
+func TestRenderWatchedKeepsInput(t *testing.T) {
+	dir := t.TempDir()
+	const art = "\x1b[31mred\x1b[0m"
+	writeFiles(t, dir, map[string]string{"a.ans": art})
+	oldIn, oldOut, oldTo := inPath, outPath, toFormat
+	defer func() { inPath, outPath, toFormat = oldIn, oldOut, oldTo }()
+	// The output spells the input path differently.
+	inPath, outPath, toFormat = filepath.Join(dir, "a.ans"), dir+string(filepath.Separator)+"."+string(filepath.Separator)+"a.ans", "ansi"
+
+	if err := renderWatched(context.Background(), decodeOptions()); err == nil {
+		t.Error("overwriting the watched input is not an error")
+	}
+	if data, _ := os.ReadFile(inPath); string(data) != art {
+		t.Errorf("input was changed to %q", data)
+	}
+}
@@ -0,0 +1,77 @@
+package xbin
+
+import (
+	"a2m2a/canvas"
+	"a2m2a/palette"
+	"image/color"
+)
+
+// Attributes maps the character/attribute byte pairs of binary text formats
+// (XBin, BinaryText, iCE Draw, ArtWorx) to cells and back.
+type Attributes struct {
+	// Palette holds the 16 colors the attribute nibbles index.
+	Palette []color.RGBA
+	// ICE makes the high background bit select bright backgrounds instead
+	// of blinking.
+	ICE bool
+	// Font512 makes the high foreground bit select the second 256 glyphs of
+	// a 512-character font, leaving 8 foreground colors.
+	Font512 bool
+}
+
+// Cell converts a character and attribute byte to a cell.
+func (a Attributes) Cell(ch, attr byte) canvas.Cell {
+	fg, bg := int(attr&0x0F), int(attr>>4)
+	glyph := int(ch)
+	if a.Font512 && fg >= 8 {
+		fg -= 8
+		glyph += 256
+	}
+	blink := false
+	if !a.ICE && bg >= 8 {
+		bg -= 8
+		blink = true
+	}
+	return canvas.Cell{
+		Char:   canvas.GlyphRune(glyph),
+		Fg:     a.color(fg),
+		Bg:     a.color(bg),
+		Bright: fg >= 8,
+		Ice:    bg >= 8 || blink,
+	}
+}
+
+// Bytes converts a cell back to a character and attribute byte, snapping
+// its colors to the palette. Characters outside CP437 become '?'.
+func (a Attributes) Bytes(cell canvas.Cell) (byte, byte) {
+	glyph, ok := canvas.GlyphIndex(cell.Char)
+	if !ok {
+		glyph = '?'
+	}
+	fgMax, bgMax := 16, 16
+	if a.Font512 {
+		fgMax = 8
+	}
+	if !a.ICE {
+		bgMax = 8
+	}
+	fg := palette.Nearest(a.Palette[:fgMax], cell.Fg)
+	bg := palette.Nearest(a.Palette[:bgMax], cell.Bg)
+	if glyph >= 256 {
+		glyph -= 256
+		if a.Font512 {
+			fg += 8
+		}
+	}
+	if !a.ICE && cell.Ice {
+		bg += 8 // Blink.
+	}
+	return byte(glyph), byte(bg<<4 | fg)
+}
+
+func (a Attributes) color(i int) color.RGBA {
+	if i < len(a.Palette) {
+		return a.Palette[i]
+	}
+	return canvas.DefaultFg
+}
@@ -0,0 +1,221 @@
+// Package xbin reads and writes XBin (.xb) files: binary text with an
+// optional embedded palette and font, and an optional RLE compression.
+package xbin
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"a2m2a/internal/stream"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// Magic starts every XBin file.
+const Magic = "XBIN\x1a"
+
+// Header flags.
+const (
+	flagPalette  = 1 << 0
+	flagFont     = 1 << 1
+	flagCompress = 1 << 2
+	flagNonBlink = 1 << 3 // iCE colors: the blink bit selects bright backgrounds.
+	flag512      = 1 << 4
+)
+
+// Compression run types, in the top two bits of the run byte.
+const (
+	runNone = iota
+	runChar
+	runAttr
+	runBoth
+)
+
+// header is the fixed 11-byte file header.
+type header struct {
+	Magic    [5]byte
+	Width    uint16
+	Height   uint16
+	FontSize uint8
+	Flags    uint8
+}
+
+// Parser reads an XBin stream. Unlike the text formats, XBin defines its own
+// dimensions, so the parser creates the canvas.
+type Parser struct {
+	reader *stream.Reader
+	width  int
+
+	// Diagnostics, if not nil, collects the problems found in the image
+	// data: missing cells and compression runs past the end.
+	Diagnostics *diag.Collector
+}
+
+// NewParser creates a new XBin parser.
+func NewParser(r io.Reader) *Parser {
+	return &Parser{reader: stream.NewReader(r)}
+}
+
+// Parse reads the whole file into a new canvas, with the embedded palette and
+// font attached to it.
+func (p *Parser) Parse() (*canvas.Canvas, error) {
+	var h header
+	if err := binary.Read(p.reader, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if string(h.Magic[:]) != Magic {
+		return nil, errors.New("not an XBin file")
+	}
+	if h.Width == 0 {
+		return nil, errors.New("XBin file has zero width")
+	}
+	if cells := int(h.Width) * int(h.Height); cells > canvas.MaxCells {
+		return nil, fmt.Errorf("%w: XBin image of %dx%d cells", canvas.ErrTooLarge, h.Width, h.Height)
+	}
+
+	pal := ansi.PCPalette
+	var embedded []color.RGBA
+	if h.Flags&flagPalette != 0 {
+		raw := make([]byte, 48)
+		if _, err := io.ReadFull(p.reader, raw); err != nil {
+			return nil, fmt.Errorf("reading palette: %w", err)
+		}
+		embedded = DecodePalette(raw)
+		pal = embedded
+	}
+
+	var font *canvas.Font
+	if h.Flags&flagFont != 0 {
+		height := int(h.FontSize)
+		if height == 0 {
+			height = 16
+		}
+		glyphs := 256
+		if h.Flags&flag512 != 0 {
+			glyphs = 512
+		}
+		raw := make([]byte, glyphs*height)
+		if _, err := io.ReadFull(p.reader, raw); err != nil {
+			return nil, fmt.Errorf("reading font: %w", err)
+		}
+		font = canvas.NewFont(height, raw)
+	}
+
+	p.width = int(h.Width)
+	cells := int(h.Width) * int(h.Height)
+	data, err := p.readImage(cells, h.Flags&flagCompress != 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading image data: %w", err)
+	}
+	if len(data) < 2*cells {
+		p.report(p.reader.Offset(), len(data)/2, "image data ends after %d of %d cells", len(data)/2, cells)
+	}
+
+	c := canvas.NewCanvas(int(h.Width))
+	c.Font = font
+	c.Palette = embedded
+	attrs := Attributes{Palette: pal, ICE: h.Flags&flagNonBlink != 0, Font512: font != nil && len(font.Glyphs) == 512}
+	for i := 0; i+1 < len(data); i += 2 {
+		c.Put(attrs.Cell(data[i], data[i+1]))
+	}
+	return c, nil
+}
+
+// readImage reads n character/attribute pairs, expanding compression runs.
+// Truncated files yield the cells that were present, which Parse reports.
+// The buffer grows with the data actually read, so a header claiming a large
+// image costs nothing until the data is there.
+func (p *Parser) readImage(n int, compressed bool) ([]byte, error) {
+	if !compressed {
+		return io.ReadAll(io.LimitReader(p.reader, int64(2*n)))
+	}
+
+	var data []byte
+	var runStart int64
+	for len(data) < 2*n {
+		runStart = p.reader.Offset()
+		run, err := p.reader.ReadByte()
+		if err != nil {
+			break
+		}
+		count := int(run&0x3F) + 1
+		var ch, attr byte
+		switch run >> 6 {
+		case runNone:
+			for i := 0; i < count; i++ {
+				if ch, err = p.reader.ReadByte(); err == nil {
+					attr, err = p.reader.ReadByte()
+				}
+				if err != nil {
+					return data, nil
+				}
+				data = append(data, ch, attr)
+			}
+		case runChar:
+			if ch, err = p.reader.ReadByte(); err != nil {
+				return data, nil
+			}
+			for i := 0; i < count; i++ {
+				if attr, err = p.reader.ReadByte(); err != nil {
+					return data, nil
+				}
+				data = append(data, ch, attr)
+			}
+		case runAttr:
+			if attr, err = p.reader.ReadByte(); err != nil {
+				return data, nil
+			}
+			for i := 0; i < count; i++ {
+				if ch, err = p.reader.ReadByte(); err != nil {
+					return data, nil
+				}
+				data = append(data, ch, attr)
+			}
+		case runBoth:
+			if ch, err = p.reader.ReadByte(); err == nil {
+				attr, err = p.reader.ReadByte()
+			}
+			if err != nil {
+				return data, nil
+			}
+			for i := 0; i < count; i++ {
+				data = append(data, ch, attr)
+			}
+		}
+	}
+	if len(data) > 2*n {
+		p.report(runStart, n-1, "compression run past the end of the image")
+		data = data[:2*n]
+	}
+	return data, nil
+}
+
+// report records an error at offset, at the cell with the given index.
+func (p *Parser) report(offset int64, cell int, format string, args ...any) {
+	p.Diagnostics.Add(diag.Diagnostic{
+		Offset:   offset,
+		Row:      cell / p.width,
+		Col:      cell % p.width,
+		Severity: diag.Error,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// DecodePalette converts RGB triplets of 6-bit VGA DAC values (as used by
+// XBin, iCE Draw and ArtWorx) to colors.
+func DecodePalette(raw []byte) []color.RGBA {
+	pal := make([]color.RGBA, len(raw)/3)
+	for i := range pal {
+		pal[i] = color.RGBA{dac(raw[3*i]), dac(raw[3*i+1]), dac(raw[3*i+2]), 0xff}
+	}
+	return pal
+}
+
+// dac scales a 6-bit DAC value to 8 bits.
+func dac(v byte) uint8 {
+	v &= 0x3F
+	return v<<2 | v>>4
+}
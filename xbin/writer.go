@@ -0,0 +1,154 @@
+package xbin
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// maxRun is the longest run a compression byte can describe.
+const maxRun = 64
+
+// Writer converts a canvas to a compressed XBin file.
+type Writer struct {
+	canvas *canvas.Canvas
+	writer io.Writer
+}
+
+// NewWriter creates a new XBin writer.
+func NewWriter(c *canvas.Canvas, w io.Writer) *Writer {
+	return &Writer{
+		canvas: c,
+		writer: w,
+	}
+}
+
+// Write generates the XBin output. The canvas palette and font are embedded
+// if it has them; otherwise colors are snapped to the ANSI palette and the
+// viewer's default font is used. iCE colors are always enabled.
+func (w *Writer) Write() error {
+	_, maxRow, _, _ := w.canvas.GetContentBounds()
+	width, height := w.canvas.Width(), maxRow+1
+	if width > 0xFFFF || height > 0xFFFF {
+		return fmt.Errorf("XBin stores at most 65535x65535 cells, the art is %dx%d", width, height)
+	}
+
+	pal := ansi.PCPalette
+	flags := byte(flagCompress | flagNonBlink | flagPalette)
+	if len(w.canvas.Palette) >= 16 {
+		pal = w.canvas.Palette[:16]
+	}
+	font := w.canvas.Font
+	fontSize := byte(16)
+	if font != nil {
+		flags |= flagFont
+		fontSize = byte(font.Height)
+		if len(font.Glyphs) > 256 {
+			flags |= flag512
+		}
+	}
+
+	bw := bufio.NewWriter(w.writer)
+	h := header{Width: uint16(width), Height: uint16(height), FontSize: fontSize, Flags: flags}
+	copy(h.Magic[:], Magic)
+	if err := binary.Write(bw, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	bw.Write(EncodePalette(pal))
+	if font != nil {
+		glyphs := 256
+		if flags&flag512 != 0 {
+			glyphs = 512
+		}
+		for i := 0; i < glyphs; i++ {
+			glyph := make([]byte, font.Height)
+			if i < len(font.Glyphs) {
+				copy(glyph, font.Glyphs[i])
+			}
+			bw.Write(glyph)
+		}
+	}
+
+	attrs := Attributes{Palette: pal, ICE: true, Font512: flags&flag512 != 0}
+	row := make([][2]byte, width)
+	for r := 0; r < height; r++ {
+		for col := range row {
+			row[col][0], row[col][1] = attrs.Bytes(w.canvas.Grid[r][col])
+		}
+		writeCompressedRow(bw, row)
+	}
+	return bw.Flush()
+}
+
+// writeCompressedRow RLE-compresses one row; runs never span rows, as the
+// format requires.
+func writeCompressedRow(bw *bufio.Writer, row [][2]byte) {
+	for i := 0; i < len(row); {
+		both, chars, attrs := runLengths(row, i)
+		switch {
+		case both >= 2:
+			bw.WriteByte(runBoth<<6 | byte(both-1))
+			bw.Write(row[i][:])
+			i += both
+		case chars >= 3 && chars >= attrs:
+			bw.WriteByte(runChar<<6 | byte(chars-1))
+			bw.WriteByte(row[i][0])
+			for _, cell := range row[i : i+chars] {
+				bw.WriteByte(cell[1])
+			}
+			i += chars
+		case attrs >= 3:
+			bw.WriteByte(runAttr<<6 | byte(attrs-1))
+			bw.WriteByte(row[i][1])
+			for _, cell := range row[i : i+attrs] {
+				bw.WriteByte(cell[0])
+			}
+			i += attrs
+		default:
+			// Copy literally up to the next spot worth compressing.
+			n := 1
+			for i+n < len(row) && n < maxRun {
+				if both, chars, attrs := runLengths(row, i+n); both >= 2 || chars >= 3 || attrs >= 3 {
+					break
+				}
+				n++
+			}
+			bw.WriteByte(runNone<<6 | byte(n-1))
+			for _, cell := range row[i : i+n] {
+				bw.Write(cell[:])
+			}
+			i += n
+		}
+	}
+}
+
+// runLengths measures the runs of identical cells, characters and attributes
+// starting at i.
+func runLengths(row [][2]byte, i int) (both, chars, attrs int) {
+	both, chars, attrs = 1, 1, 1
+	for j := i + 1; j < len(row) && j-i < maxRun; j++ {
+		if both == j-i && row[j] == row[i] {
+			both++
+		}
+		if chars == j-i && row[j][0] == row[i][0] {
+			chars++
+		}
+		if attrs == j-i && row[j][1] == row[i][1] {
+			attrs++
+		}
+	}
+	return both, chars, attrs
+}
+
+// EncodePalette converts colors to RGB triplets of 6-bit VGA DAC values.
+func EncodePalette(pal []color.RGBA) []byte {
+	raw := make([]byte, 0, 3*len(pal))
+	for _, c := range pal {
+		raw = append(raw, c.R>>2, c.G>>2, c.B>>2)
+	}
+	return raw
+}
@@ -0,0 +1,240 @@
+package xbin
+
+import (
+	"a2m2a/ansi"
+	"a2m2a/canvas"
+	"a2m2a/diag"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// artCanvas is a small canvas using every run type of the compression.
+func artCanvas(width int) *canvas.Canvas {
+	c := canvas.NewCanvas(width)
+	attrs := Attributes{Palette: ansi.PCPalette, ICE: true}
+	for i := 0; i < width*3; i++ {
+		var ch, attr byte
+		switch row := i / width; row {
+		case 0: // Identical cells.
+			ch, attr = 0xDB, 0x1E
+		case 1: // One character in changing colors.
+			ch, attr = 'x', byte(i%16)<<4|0x0F
+		default: // Changing characters, with bright backgrounds.
+			ch, attr = byte('A'+i%26), 0xC3
+		}
+		c.Put(attrs.Cell(ch, attr))
+	}
+	return c
+}
+
+func roundTrip(t *testing.T, c *canvas.Canvas) *canvas.Canvas {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewWriter(c, &buf).Write(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewParser(&buf).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func sameCells(t *testing.T, got, want *canvas.Canvas) {
+	t.Helper()
+	if got.Width() != want.Width() {
+		t.Fatalf("width %d, want %d", got.Width(), want.Width())
+	}
+	_, maxRow, _, _ := want.GetContentBounds()
+	for r := 0; r <= maxRow; r++ {
+		for col := range want.Grid[r] {
+			if g, w := got.Grid[r][col], want.Grid[r][col]; g != w {
+				t.Fatalf("cell %d,%d = %+v, want %+v", r, col, g, w)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, width := range []int{1, 5, 80, 200} {
+		c := artCanvas(width)
+		sameCells(t, roundTrip(t, c), c)
+	}
+}
+
+func TestRoundTripFontAndPalette(t *testing.T) {
+	pal := make([]color.RGBA, 16)
+	for i := range pal {
+		pal[i] = color.RGBA{uint8(i * 16), uint8(255 - i*16), 0x80, 0xff}
+	}
+	for _, glyphs := range []int{256, 512} {
+		raw := make([]byte, glyphs*8)
+		for i := range raw {
+			raw[i] = byte(i * 7)
+		}
+		c := canvas.NewCanvas(4)
+		c.Font = canvas.NewFont(8, raw)
+		c.Palette = pal
+		attrs := Attributes{Palette: pal, ICE: true, Font512: glyphs == 512}
+		for i := 0; i < 8; i++ {
+			c.Put(attrs.Cell(byte(i*37), byte(i*0x13)))
+		}
+
+		got := roundTrip(t, c)
+		if got.Font == nil || got.Font.Height != 8 || len(got.Font.Glyphs) != glyphs {
+			t.Fatalf("%d glyphs: font %+v not kept", glyphs, got.Font)
+		}
+		if !bytes.Equal(bytes.Join(got.Font.Glyphs, nil), raw) {
+			t.Errorf("%d glyphs: font bitmaps changed", glyphs)
+		}
+		// The palette goes through 6-bit DAC values.
+		for i, p := range got.Palette {
+			if p.R>>2 != pal[i].R>>2 || p.G>>2 != pal[i].G>>2 || p.B>>2 != pal[i].B>>2 {
+				t.Errorf("%d glyphs: palette entry %d = %v, want %v", glyphs, i, p, pal[i])
+			}
+		}
+		sameCells(t, got, roundTrip(t, got))
+	}
+}
+
+// file builds an XBin file from a header and data.
+func file(width, height uint16, flags byte, data ...byte) []byte {
+	var buf bytes.Buffer
+	h := header{Width: width, Height: height, FontSize: 16, Flags: flags}
+	copy(h.Magic[:], Magic)
+	binary.Write(&buf, binary.LittleEndian, h)
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantCells string // Characters of the first row.
+		wantErr   bool
+	}{
+		{"uncompressed", file(3, 1, 0, 'a', 7, 'b', 7, 'c', 7), "abc", false},
+		{"truncated", file(3, 1, 0, 'a', 7, 'b'), "a", false},
+		{"runs", file(6, 1, flagCompress,
+			runBoth<<6|1, 'a', 7,
+			runChar<<6|1, 'b', 7, 8,
+			runAttr<<6|1, 7, 'c', 'd'), "aabbcd", false},
+		{"run past the end", file(2, 1, flagCompress, runBoth<<6|63, 'z', 7), "zz", false},
+		{"truncated run", file(4, 1, flagCompress, runNone<<6|3, 'a', 7, 'b'), "a", false},
+		{"not xbin", append([]byte("XBIM\x1a"), make([]byte, 6)...), "", true},
+		{"zero width", file(0, 1, 0), "", true},
+		{"short header", []byte("XBIN\x1a\x01"), "", true},
+		{"truncated palette", file(1, 1, flagPalette, 1, 2, 3), "", true},
+		{"truncated font", file(1, 1, flagFont, make([]byte, 100)...), "", true},
+	}
+	for _, tt := range tests {
+		c, err := NewParser(bytes.NewReader(tt.data)).Parse()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var got []rune
+		for _, cell := range c.Grid[0][:len(tt.wantCells)] {
+			got = append(got, cell.Char)
+		}
+		if string(got) != tt.wantCells {
+			t.Errorf("%s: got %q, want %q", tt.name, string(got), tt.wantCells)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"clean", file(2, 1, 0, 'a', 7, 'b', 7), nil},
+		{"clean runs", file(3, 1, flagCompress, runBoth<<6|2, 'a', 7), nil},
+		{"truncated", file(3, 1, 0, 'a', 7, 'b'), []string{"1:2 (byte 14): error: image data ends after 1 of 3 cells"}},
+		{"truncated run", file(4, 1, flagCompress, runNone<<6|3, 'a', 7, 'b'), []string{"1:2 (byte 15): error: image data ends after 1 of 4 cells"}},
+		{"run past the end", file(2, 1, flagCompress, runNone<<6, 'x', 7, runBoth<<6|63, 'z', 7), []string{"1:2 (byte 14): error: compression run past the end of the image"}},
+	}
+	for _, tt := range tests {
+		p := NewParser(bytes.NewReader(tt.data))
+		p.Diagnostics = &diag.Collector{}
+		if _, err := p.Parse(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, d := range p.Diagnostics.Diagnostics() {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: diagnostics = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseTooLarge(t *testing.T) {
+	for _, flags := range []byte{0, flagCompress} {
+		_, err := NewParser(bytes.NewReader(file(0xFFFF, 0xFFFF, flags, 'a', 7))).Parse()
+		if !errors.Is(err, canvas.ErrTooLarge) {
+			t.Errorf("flags %d: got %v, want ErrTooLarge", flags, err)
+		}
+	}
+	// Within the limits, a lying header only costs the data that is there.
+	c, err := NewParser(bytes.NewReader(file(2000, 2000, 0, 'a', 7))).Parse()
+	if err != nil || c.Grid[0][0].Char != 'a' || len(c.Grid) != 1 {
+		t.Errorf("got %v, %d rows", err, len(c.Grid))
+	}
+}
+
+func TestWriteTooLarge(t *testing.T) {
+	c := canvas.NewCanvas(0x10000)
+	c.SetCursor(0, 0x10000-1)
+	c.Put(canvas.Cell{Char: 'a', Fg: canvas.DefaultFg, Bg: canvas.DefaultBg})
+	var buf bytes.Buffer
+	if err := NewWriter(c, &buf).Write(); err == nil {
+		t.Error("a width past the 16-bit header field is not an error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes of a corrupt file", buf.Len())
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	tests := []struct {
+		attrs Attributes
+		attr  byte
+	}{
+		{Attributes{Palette: ansi.PCPalette, ICE: true}, 0xFF},
+		{Attributes{Palette: ansi.PCPalette, ICE: true}, 0x8E},
+		{Attributes{Palette: ansi.PCPalette}, 0x9E}, // Blink.
+		{Attributes{Palette: ansi.PCPalette, Font512: true}, 0x4B},
+	}
+	for _, tt := range tests {
+		for _, ch := range []byte{1, 'A', 0xB0, 0xFF} { // NUL reads as a space.
+			gotCh, gotAttr := tt.attrs.Bytes(tt.attrs.Cell(ch, tt.attr))
+			if gotCh != ch || gotAttr != tt.attr {
+				t.Errorf("%+v: %02x/%02x came back as %02x/%02x", tt.attrs, ch, tt.attr, gotCh, gotAttr)
+			}
+		}
+	}
+}
+
+func TestWriteCompressedRow(t *testing.T) {
+	row := [][2]byte{{'a', 7}, {'a', 7}, {'b', 1}, {'c', 1}, {'d', 1}, {'e', 2}}
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	writeCompressedRow(bw, row)
+	bw.Flush()
+	want := []byte{runBoth<<6 | 1, 'a', 7, runAttr<<6 | 2, 1, 'b', 'c', 'd', runNone << 6, 'e', 2}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got % x, want % x", buf.Bytes(), want)
+	}
+}